@@ -2,14 +2,24 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"myapp/internal/cache"
 	"myapp/internal/config"
 	"myapp/internal/database"
+	"myapp/internal/decode"
+	"myapp/internal/graphqlapi"
+	"myapp/internal/grpcserver"
 	"myapp/internal/handlers"
 	"myapp/internal/kafka"
+	"myapp/internal/outbox"
 	"myapp/internal/repository"
+	"myapp/internal/schema"
 	"myapp/internal/service"
+	"myapp/internal/stream"
+	"myapp/internal/validation"
+	"myapp/internal/webhook"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -59,10 +69,24 @@ func main() {
 		orderCache = cache.NewInMemoryCache()
 	}
 	statsCache := cache.NewStatsCache(orderCache)
-	orderService := service.NewOrderService(repo, statsCache)
+	validator := validation.New(validation.WithDisabledRules(cfg.ValidationDisabledRules...))
+	if err := validator.CheckDisabledRules(); err != nil {
+		log.Fatalf("Invalid VALIDATION_DISABLED_RULES: %v", err)
+	}
+	decoder := decode.New(
+		decode.WithStrict(cfg.DecodeStrict),
+		decode.WithMaxBytes(cfg.MaxBodyBytes),
+		decode.WithMaxItems(cfg.MaxOrderItems),
+	)
+	orderService := service.NewOrderService(repo, statsCache,
+		service.WithValidator(validator),
+		service.WithDecoder(decoder),
+	)
 
-	if err := orderService.WarmupCache(); err != nil {
-		log.Printf("Warning: Failed to warm up cache: %v", err)
+	if !restoreCacheFromSnapshot(cfg, orderService) {
+		if err := orderService.WarmupCache(context.Background()); err != nil {
+			log.Printf("Warning: Failed to warm up cache: %v", err)
+		}
 	}
 
 	log.Printf("Creating Kafka consumer with brokers: %s, group: %s, topic: %s",
@@ -78,6 +102,16 @@ func main() {
 		log.Fatalf("Failed to create Kafka consumer: %v", err)
 	}
 	defer consumer.Stop()
+	consumer.SetStatusTopic(cfg.KafkaStatusTopic)
+	consumer.SetDecoder(decoder)
+	if cfg.KafkaSchemaValidation {
+		schemaValidator, err := schema.NewOrderValidator()
+		if err != nil {
+			log.Fatalf("Failed to build order schema validator: %v", err)
+		}
+		consumer.SetSchemaValidator(schemaValidator)
+		log.Printf("Validating Kafka orders against schema %s", schemaValidator.Version())
+	}
 
 	dlqProducer, err := kafka.NewProducer(cfg.KafkaBrokers[0], cfg.KafkaDLQTopic)
 	if err != nil {
@@ -87,9 +121,43 @@ func main() {
 		defer dlqProducer.Close()
 	}
 
+	// Without a producer the outbox keeps filling and is drained on the
+	// next start.
+	eventsProducer, err := kafka.NewProducer(cfg.KafkaBrokers[0], cfg.KafkaEventsTopic)
+	if err != nil {
+		log.Printf("Warning: failed to create order events producer: %v", err)
+	} else {
+		defer eventsProducer.Close()
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	var snapshotter *cache.Snapshotter
+	if cfg.CacheSnapshotPath != "" {
+		snapshotter = cache.NewSnapshotter(statsCache, orderService.GetEventHorizon, cfg.CacheSnapshotPath, cfg.CacheSnapshotInterval)
+		go snapshotter.Run(ctx)
+	}
+
+	go runPurgeJob(ctx, orderService, cfg)
+
+	if eventsProducer != nil {
+		relay := outbox.NewRelay(repository.NewOutboxRepository(db), eventsProducer, cfg.OutboxPollInterval)
+		go relay.Run(ctx)
+	}
+
+	broker := stream.NewBroker(orderService, cfg.StreamPollInterval)
+	go broker.Run(ctx)
+
+	webhookService := service.NewWebhookService(repository.NewWebhookRepository(db))
+	dispatcher := webhook.NewDispatcher(webhookService, cfg.WebhookPollInterval,
+		webhook.WithTimeout(cfg.WebhookTimeout),
+		webhook.WithMaxAttempts(cfg.WebhookMaxAttempts),
+		webhook.WithDisableAfter(cfg.WebhookDisableAfter),
+		webhook.WithPrivateNetworks(cfg.WebhookAllowPrivate),
+	)
+	go dispatcher.Run(ctx)
+
 	log.Println("Starting Kafka consumer...")
 	go func() {
 		if err := consumer.Start(ctx); err != nil {
@@ -99,10 +167,15 @@ func main() {
 	log.Println("Kafka consumer started successfully")
 
 	router := mux.NewRouter()
-	handler := handlers.NewHandler(orderService)
+	handler := handlers.NewHandler(orderService,
+		handlers.WithDecoder(decoder),
+		handlers.WithBroker(broker),
+		handlers.WithWebhooks(webhookService),
+	)
 	handler.RegisterRoutes(router)
 
 	router.Handle("/metrics", promhttp.Handler())
+	router.Handle("/graphql", graphqlapi.NewHandler(orderService, graphqlapi.WithDecoder(decoder)))
 
 	router.PathPrefix("/").Handler(otelhttp.NewHandler(http.FileServer(http.Dir("./web/")), "static"))
 
@@ -112,6 +185,9 @@ func main() {
 		Addr:    ":" + strconv.Itoa(cfg.ServerPort),
 		Handler: otelhttp.NewHandler(router, "http_server"),
 	}
+	// Shutdown waits for open requests, and event streams never finish on
+	// their own; clients reconnect to another instance with Last-Event-ID.
+	server.RegisterOnShutdown(broker.Close)
 
 	go func() {
 		log.Printf("Starting HTTP server on port %d", cfg.ServerPort)
@@ -120,6 +196,18 @@ func main() {
 		}
 	}()
 
+	grpcServer := grpcserver.NewGRPCServer(orderService, grpcserver.WithDecoder(decoder))
+	go func() {
+		listener, err := net.Listen("tcp", ":"+strconv.Itoa(cfg.GRPCPort))
+		if err != nil {
+			log.Fatalf("Failed to listen on gRPC port %d: %v", cfg.GRPCPort, err)
+		}
+		log.Printf("Starting gRPC server on port %d", cfg.GRPCPort)
+		if err := grpcServer.Serve(listener); err != nil {
+			log.Fatalf("Failed to start gRPC server: %v", err)
+		}
+	}()
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
@@ -132,6 +220,52 @@ func main() {
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Printf("Server forced to shutdown: %v", err)
 	}
+	grpcServer.GracefulStop()
+
+	if snapshotter != nil {
+		if err := snapshotter.Save(shutdownCtx); err != nil {
+			log.Printf("Failed to save cache snapshot: %v", err)
+		}
+	}
 
 	log.Println("Server exited")
 }
+
+func restoreCacheFromSnapshot(cfg config.Config, orderService service.Service) bool {
+	if cfg.CacheSnapshotPath == "" {
+		return false
+	}
+
+	snapshot, err := cache.ReadSnapshot(cfg.CacheSnapshotPath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Warning: Failed to read cache snapshot: %v", err)
+		}
+		return false
+	}
+
+	if err := orderService.RestoreCache(context.Background(), snapshot); err != nil {
+		log.Printf("Warning: Failed to restore cache from snapshot: %v", err)
+		return false
+	}
+	return true
+}
+
+func runPurgeJob(ctx context.Context, orderService service.Service, cfg config.Config) {
+	ticker := time.NewTicker(cfg.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := orderService.PurgeDeletedOrders(ctx, cfg.OrderRetention); err != nil {
+				log.Printf("Failed to purge deleted orders: %v", err)
+			}
+			if _, err := orderService.PurgeIdempotencyKeys(ctx, cfg.IdempotencyKeyTTL); err != nil {
+				log.Printf("Failed to purge idempotency keys: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"myapp/internal/bulk"
+	"myapp/internal/model"
+	"myapp/internal/validation"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// filterFlags registers the order filter flags shared by list, validate and
+// export, matching the query parameters of GET /api/v1/orders:export.
+func filterFlags(fs *flag.FlagSet) *model.OrderFilter {
+	filter := &model.OrderFilter{}
+	fs.Func("status", "only orders in this status", func(s string) error {
+		filter.Status = model.OrderStatus(s)
+		if !filter.Status.Valid() {
+			return fmt.Errorf("unknown status %q", s)
+		}
+		return nil
+	})
+	fs.StringVar(&filter.CustomerID, "customer", "", "only orders of this customer_id")
+	fs.StringVar(&filter.DeliveryService, "delivery-service", "", "only orders of this delivery_service")
+	fs.Func("created-after", "only orders created at or after this RFC 3339 time", timeFlag(&filter.CreatedAfter))
+	fs.Func("created-before", "only orders created before this RFC 3339 time", timeFlag(&filter.CreatedBefore))
+	fs.BoolVar(&filter.IncludeDeleted, "include-deleted", false, "include soft-deleted orders")
+	return filter
+}
+
+func timeFlag(t *time.Time) func(string) error {
+	return func(s string) error {
+		parsed, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return errors.New("must be an RFC 3339 timestamp")
+		}
+		*t = parsed
+		return nil
+	}
+}
+
+func runGet(ctx context.Context, a *app, fs *flag.FlagSet, args []string) error {
+	includeDeleted := fs.Bool("include-deleted", false, "also find soft-deleted orders")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	svc, err := a.service()
+	if err != nil {
+		return err
+	}
+	order, err := svc.GetOrderByUID(ctx, fs.Arg(0), *includeDeleted)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(order)
+}
+
+func runList(ctx context.Context, a *app, fs *flag.FlagSet, args []string) error {
+	filter := filterFlags(fs)
+	fs.IntVar(&filter.Limit, "limit", 50, "maximum number of orders, 0 for all")
+	fs.IntVar(&filter.Offset, "offset", 0, "number of orders to skip")
+	asJSON := fs.Bool("json", false, "print complete orders as JSON instead of a table")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	svc, err := a.service()
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		orders, err := svc.GetAllOrders(ctx, *filter)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(orders)
+	}
+
+	orders, err := svc.GetOrderHeaders(ctx, *filter)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ORDER_UID\tSTATUS\tCUSTOMER\tDELIVERY_SERVICE\tCREATED\tVERSION\tDELETED")
+	for _, o := range orders {
+		deleted := ""
+		if o.DeletedAt != nil {
+			deleted = o.DeletedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", o.OrderUID, o.Status, o.CustomerID, o.DeliveryService,
+			o.DateCreated.Format(time.RFC3339), o.Version, deleted)
+	}
+	return tw.Flush()
+}
+
+func runDelete(ctx context.Context, a *app, fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	svc, err := a.service()
+	if err != nil {
+		return err
+	}
+	var failed bool
+	for _, uid := range fs.Args() {
+		if err := svc.DeleteOrder(ctx, uid); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", uid, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: deleted\n", uid)
+	}
+	if failed {
+		return errFailed
+	}
+	return nil
+}
+
+// runValidate checks stored orders against the current rules, which may have
+// changed since the orders were saved. It exits non-zero when any order
+// breaks them.
+func runValidate(ctx context.Context, a *app, fs *flag.FlagSet, args []string) error {
+	filter := filterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	svc, err := a.service()
+	if err != nil {
+		return err
+	}
+	validator, err := a.validator()
+	if err != nil {
+		return err
+	}
+	var checked, invalid int
+	err = svc.ExportOrders(ctx, *filter, func(order *model.Order) error {
+		checked++
+		err := validator.Validate(order)
+		if err == nil {
+			return nil
+		}
+		if !validation.IsValidationError(err) {
+			return err
+		}
+		invalid++
+		for _, v := range validation.Violations(err) {
+			fmt.Printf("%s\t%s\t%s: %s\n", order.OrderUID, v.Rule, v.Field, v.Message)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "checked %d orders, %d invalid\n", checked, invalid)
+	if invalid > 0 {
+		return errFailed
+	}
+	return nil
+}
+
+// runWarmup asks a running instance to reload its cache from the database,
+// for example after orders were changed with this tool or with psql.
+func runWarmup(ctx context.Context, a *app, fs *flag.FlagSet, args []string) error {
+	addr := fs.String("addr", "http://localhost:"+strconv.Itoa(a.cfg.ServerPort), "base URL of the running instance")
+	timeout := fs.Duration("timeout", 5*time.Minute, "how long to wait for the warmup to finish")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(*addr, "/")+"/api/v1/cache/warmup", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Client-ID", "ordersctl")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Message string `json:"message"`
+		Detail  string `json:"detail"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("unexpected response %s: %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, body.Detail)
+	}
+	fmt.Println(body.Message)
+	return nil
+}
+
+func runExport(ctx context.Context, a *app, fs *flag.FlagSet, args []string) error {
+	filter := filterFlags(fs)
+	format := fs.String("format", bulk.FormatNDJSON, "ndjson or csv")
+	output := fs.String("o", "-", "output file, - for stdout")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	if *format != bulk.FormatNDJSON && *format != bulk.FormatCSV {
+		return fmt.Errorf("%w %q", bulk.ErrUnknownFormat, *format)
+	}
+	svc, err := a.service()
+	if err != nil {
+		return err
+	}
+
+	out := io.Writer(os.Stdout)
+	var file *os.File
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		file, out = f, f
+	}
+	writer, err := bulk.NewWriter(out, *format)
+	if err != nil {
+		return err
+	}
+	var count int
+	if err := svc.ExportOrders(ctx, *filter, func(order *model.Order) error {
+		count++
+		return writer.Write(order)
+	}); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if file != nil {
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "exported %d orders\n", count)
+	return nil
+}
+
+// runImport creates orders line by line with the limits and rules of
+// POST /api/v1/orders:import. Lines that were not created are printed as
+// bulk.ImportResult JSON; the exit status is non-zero if any was invalid or
+// failed, but not for conflicts, so re-running an import is safe.
+func runImport(ctx context.Context, a *app, fs *flag.FlagSet, args []string) error {
+	input := fs.String("f", "-", "NDJSON file, - for stdin")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	in := io.Reader(os.Stdin)
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	svc, err := a.service()
+	if err != nil {
+		return err
+	}
+	decoder := a.decoder()
+
+	var summary bulk.ImportSummary
+	enc := json.NewEncoder(os.Stdout)
+	lines := bulk.NewLineReader(in, int(decoder.MaxBytes()))
+	for {
+		n, line, err := lines.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var result bulk.ImportResult
+		switch {
+		case errors.Is(err, bulk.ErrLineTooLong):
+			result = bulk.TooLongResult(n, decoder.MaxBytes())
+		case err != nil:
+			return err
+		default:
+			result = bulk.ImportLine(ctx, svc, decoder, n, line)
+		}
+		summary.Add(result.Status)
+		if result.Status != bulk.ImportCreated {
+			if err := enc.Encode(result); err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d lines: %d created, %d invalid, %d conflict, %d failed\n",
+		summary.Lines, summary.Created, summary.Invalid, summary.Conflict, summary.Failed)
+	if summary.Invalid > 0 || summary.Failed > 0 {
+		return errFailed
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+// Command ordersctl administers orders directly through the service layer,
+// so every change goes through the same validation and audit trail as the
+// API. It reads the database settings from config.env like the service.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"myapp/internal/cache"
+	"myapp/internal/config"
+	"myapp/internal/database"
+	"myapp/internal/decode"
+	"myapp/internal/model"
+	"myapp/internal/repository"
+	"myapp/internal/service"
+	"myapp/internal/validation"
+	"os"
+	"os/signal"
+	"os/user"
+	"syscall"
+
+	"github.com/joho/godotenv"
+)
+
+// Commands return errUsage after printing their usage and errFailed after
+// reporting what went wrong; both only set the exit status.
+var (
+	errUsage  = errors.New("usage")
+	errFailed = errors.New("failed")
+)
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, a *app, fs *flag.FlagSet, args []string) error
+}
+
+var commands = []command{
+	{"get", "[-include-deleted] <order_uid>", "print an order as JSON", runGet},
+	{"list", "[filters] [-limit n] [-offset n] [-json]", "list orders", runList},
+	{"delete", "<order_uid>...", "soft-delete orders", runDelete},
+	{"validate", "[filters]", "re-validate stored orders and report violations", runValidate},
+	{"warmup", "[-addr url]", "re-warm the cache of a running instance", runWarmup},
+	{"export", "[filters] [-format ndjson|csv] [-o file]", "export orders to a file", runExport},
+	{"import", "[-f file]", "create orders from an NDJSON file", runImport},
+}
+
+// app opens the database on first use, so commands that only talk to a
+// running instance work without database access.
+type app struct {
+	cfg config.Config
+	db  *sql.DB
+	svc service.Service
+}
+
+func (a *app) service() (service.Service, error) {
+	if a.svc != nil {
+		return a.svc, nil
+	}
+	db, err := database.Connect(a.cfg)
+	if err != nil {
+		return nil, err
+	}
+	validator, err := a.validator()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	a.db = db
+	a.svc = service.NewOrderService(repository.NewPostgresRepository(db), cache.NewInMemoryCache(),
+		service.WithValidator(validator),
+		service.WithDecoder(a.decoder()))
+	return a.svc, nil
+}
+
+func (a *app) decoder() *decode.Decoder {
+	return decode.New(
+		decode.WithStrict(a.cfg.DecodeStrict),
+		decode.WithMaxBytes(a.cfg.MaxBodyBytes),
+		decode.WithMaxItems(a.cfg.MaxOrderItems),
+	)
+}
+
+func (a *app) validator() (*validation.Validator, error) {
+	validator := validation.New(validation.WithDisabledRules(a.cfg.ValidationDisabledRules...))
+	if err := validator.CheckDisabledRules(); err != nil {
+		return nil, fmt.Errorf("invalid VALIDATION_DISABLED_RULES: %w", err)
+	}
+	return validator, nil
+}
+
+func (a *app) close() {
+	if a.db != nil {
+		a.db.Close()
+	}
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ordersctl: ")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == flag.Arg(0) {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		log.Printf("unknown command %q", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	if err := godotenv.Load("config.env"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Warning: failed to read config.env: %v", err)
+	}
+	a := &app{cfg: config.Load()}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	ctx = model.WithActor(ctx, cliActor())
+
+	err := cmd.run(ctx, a, newFlagSet(cmd), flag.Args()[1:])
+	a.close()
+	stop()
+	switch {
+	case err == nil:
+	case errors.Is(err, errUsage):
+		os.Exit(2)
+	case errors.Is(err, errFailed):
+		os.Exit(1)
+	default:
+		log.Printf("%s: %v", cmd.name, err)
+		os.Exit(1)
+	}
+}
+
+// cliActor records changes in the audit log as made by the local user.
+func cliActor() model.Actor {
+	actor := model.Actor{Type: model.ActorCLI}
+	if u, err := user.Current(); err == nil {
+		actor.Client = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		actor.RemoteAddr = host
+	}
+	return actor
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: ordersctl <command> [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-9s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(out, "\nRun ordersctl <command> -h for the arguments of a command.\n")
+}
+
+// newFlagSet returns the flag set a command registers its flags on. It
+// prints its own errors, so a failed Parse should be returned as errUsage.
+func newFlagSet(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet("ordersctl "+cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: ordersctl %s %s\n\n%s.\n\n", cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"myapp/internal/decode"
+	"myapp/internal/model"
+	"myapp/internal/schema"
+	"myapp/internal/validation"
+)
+
+// validateMessages checks up to count messages (0 for all) the way the consumer and
+// OrderService would: against the order schema when schemaValidator is set,
+// then decoding with the consumer's limits and validating with the
+// configured rules. It prints the problems instead of sending anything and
+// returns the number of messages that would be rejected.
+func validateMessages(src source, count int, schemaValidator *schema.Validator, decoder *decode.Decoder, validator *validation.Validator, w io.Writer) (int, error) {
+	var checked, rejected int
+	for count == 0 || checked < count {
+		msg, err := src.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return rejected, err
+		}
+		checked++
+
+		var order model.Order
+		if schemaValidator != nil {
+			err = schemaValidator.Validate(msg.value)
+		}
+		if err == nil {
+			err = decoder.Decode(msg.value, &order)
+		}
+		if err == nil {
+			err = validator.Validate(&order)
+		}
+		if err == nil {
+			continue
+		}
+		rejected++
+		uid := msg.orderUID
+		if uid == "" {
+			uid = "-"
+		}
+		if violations := validation.Violations(err); len(violations) > 0 {
+			for _, v := range violations {
+				fmt.Fprintf(w, "#%d %s\t%s\t%s: %s\n", checked, uid, v.Rule, v.Field, v.Message)
+			}
+		} else {
+			fmt.Fprintf(w, "#%d %s\tdecode\t%v\n", checked, uid, err)
+		}
+	}
+	fmt.Fprintf(w, "Checked %d messages: %d valid, %d rejected\n", checked, checked-rejected, rejected)
+	return rejected, nil
+}
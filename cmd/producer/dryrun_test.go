@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"myapp/internal/decode"
+	"myapp/internal/schema"
+	"myapp/internal/validation"
+)
+
+// sliceSource yields fixed messages, then io.EOF.
+type sliceSource []message
+
+func (s *sliceSource) next() (message, error) {
+	if len(*s) == 0 {
+		return message{}, io.EOF
+	}
+	msg := (*s)[0]
+	*s = (*s)[1:]
+	return msg, nil
+}
+
+func TestValidateMessages_ChecksSchema(t *testing.T) {
+	order := newGenerator(1, 1, 0, 0).order("uid1")
+	data, _ := json.Marshal(order)
+	var fields map[string]interface{}
+	_ = json.Unmarshal(data, &fields)
+	fields["trak_number"] = "typo"
+	value, _ := json.Marshal(fields)
+
+	schemaValidator, err := schema.NewOrderValidator()
+	if err != nil {
+		t.Fatalf("failed to build schema validator: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		schema *schema.Validator
+		want   int
+	}{
+		{name: "without schema", want: 0},
+		{name: "with schema", schema: schemaValidator, want: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			src := &sliceSource{{kind: kindReplay, orderUID: "uid1", value: value}}
+			var out bytes.Buffer
+			rejected, err := validateMessages(src, 0, tc.schema, decode.New(decode.WithStrict(false)), validation.New(), &out)
+			if err != nil {
+				t.Fatalf("validateMessages error: %v", err)
+			}
+			if rejected != tc.want {
+				t.Fatalf("expected %d rejected, got %d:\n%s", tc.want, rejected, out.String())
+			}
+			if tc.want > 0 && !strings.Contains(out.String(), "trak_number") {
+				t.Fatalf("expected the unknown field to be reported, got:\n%s", out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"myapp/internal/model"
+	"strings"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+)
+
+// Kinds of generated messages. Invalid kinds are chosen to exercise each way
+// the consumer rejects an order: malformed and mistyped JSON fail decoding
+// and go to the DLQ, a broken business rule is rejected by the service.
+const (
+	kindValid     = "valid"
+	kindDuplicate = "duplicate"
+	kindMalformed = "invalid_json"
+	kindMistyped  = "invalid_type"
+	kindRule      = "invalid_rule"
+)
+
+var invalidKinds = []string{kindMalformed, kindMistyped, kindRule}
+
+// duplicatePool is how many recent valid payloads duplicates are drawn from.
+const duplicatePool = 1000
+
+// message is a generated payload ready to send.
+type message struct {
+	kind     string
+	orderUID string
+	value    []byte
+}
+
+// generator produces a reproducible sequence of messages from a seed: the
+// same seed and flags give the same order UIDs and contents, except for the
+// creation and payment times, which must stay plausible.
+type generator struct {
+	faker            *gofakeit.Faker
+	items            int
+	invalidPercent   float64
+	duplicatePercent float64
+
+	sent    [][]byte // ring of the last duplicatePool valid payloads
+	total   int
+	invalid int
+}
+
+func newGenerator(seed uint64, items int, invalidPercent, duplicatePercent float64) *generator {
+	return &generator{
+		faker:            gofakeit.New(seed),
+		items:            items,
+		invalidPercent:   invalidPercent,
+		duplicatePercent: duplicatePercent,
+	}
+}
+
+func (g *generator) next() (message, error) {
+	roll := g.faker.Float64() * 100
+	switch {
+	case roll < g.duplicatePercent && len(g.sent) > 0:
+		return g.duplicate()
+	case roll >= g.duplicatePercent && roll < g.duplicatePercent+g.invalidPercent:
+		kind := invalidKinds[g.invalid%len(invalidKinds)]
+		g.invalid++
+		order := g.order(g.orderUID())
+		value, err := corrupt(order, kind)
+		return message{kind: kind, orderUID: order.OrderUID, value: value}, err
+	default:
+		return g.valid()
+	}
+}
+
+func (g *generator) valid() (message, error) {
+	order := g.order(g.orderUID())
+	value, err := json.Marshal(order)
+	if err != nil {
+		return message{}, fmt.Errorf("failed to marshal order: %w", err)
+	}
+	if len(g.sent) < duplicatePool {
+		g.sent = append(g.sent, value)
+	} else {
+		g.sent[g.total%duplicatePool] = value
+	}
+	g.total++
+	return message{kind: kindValid, orderUID: order.OrderUID, value: value}, nil
+}
+
+// duplicate resends the exact payload of a recent valid order.
+func (g *generator) duplicate() (message, error) {
+	value := g.sent[g.faker.IntN(len(g.sent))]
+	return message{kind: kindDuplicate, orderUID: orderUIDOf(value), value: value}, nil
+}
+
+func (g *generator) orderUID() string {
+	return strings.ReplaceAll(g.faker.UUID(), "-", "")
+}
+
+// order builds an order that passes every validation rule.
+func (g *generator) order(orderUID string) *model.Order {
+	f := g.faker
+	trackNumber := f.Numerify("WB#########")
+	deliveryCost := f.Number(100, 2000)
+	customFee := f.Number(0, 100)
+
+	items := make([]model.Item, g.items)
+	goodsTotal := 0
+	for i := range items {
+		price := f.Number(10, 1000)
+		sale := f.Number(0, 80)
+		totalPrice := price * (100 - sale) / 100
+		goodsTotal += totalPrice
+		items[i] = model.Item{
+			ChrtID:      f.Number(1000000, 9999999),
+			TrackNumber: trackNumber,
+			Price:       price,
+			RID:         f.UUID(),
+			Name:        f.ProductName(),
+			Sale:        sale,
+			Size:        fmt.Sprintf("%d", f.Number(0, 54)),
+			TotalPrice:  totalPrice,
+			NMID:        f.Number(100000, 999999),
+			Brand:       f.Company(),
+			Status:      f.Number(100, 300),
+		}
+	}
+
+	return &model.Order{
+		OrderUID:          orderUID,
+		TrackNumber:       trackNumber,
+		Entry:             "WBIL",
+		Locale:            "en",
+		InternalSignature: "",
+		CustomerID:        f.Username(),
+		DeliveryService:   f.Company(),
+		ShardKey:          fmt.Sprintf("%d", f.Number(1, 10)),
+		SMID:              f.Number(1, 1000),
+		DateCreated:       time.Now(),
+		OOFShard:          fmt.Sprintf("%d", f.Number(1, 10)),
+		Delivery: model.Delivery{
+			Name:    f.Name(),
+			Phone:   f.Phone(),
+			Zip:     f.Zip(),
+			City:    f.City(),
+			Address: f.Street(),
+			Region:  f.StateAbr(),
+			Email:   f.Email(),
+		},
+		Payment: model.Payment{
+			Transaction:  orderUID,
+			RequestID:    "",
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       goodsTotal + deliveryCost + customFee,
+			PaymentDT:    time.Now().Unix(),
+			Bank:         f.Company(),
+			DeliveryCost: deliveryCost,
+			GoodsTotal:   goodsTotal,
+			CustomFee:    customFee,
+		},
+		Items: items,
+	}
+}
+
+// corrupt encodes order so that the consumer rejects it in the way kind
+// names.
+func corrupt(order *model.Order, kind string) ([]byte, error) {
+	if kind == kindRule {
+		order.Payment.GoodsTotal++
+	}
+	value, err := json.Marshal(order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal order: %w", err)
+	}
+
+	switch kind {
+	case kindMalformed:
+		return value[:len(value)/2], nil
+	case kindMistyped:
+		var fields map[string]interface{}
+		if err := json.Unmarshal(value, &fields); err != nil {
+			return nil, err
+		}
+		fields["sm_id"] = fmt.Sprint(order.SMID)
+		return json.Marshal(fields)
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"myapp/internal/decode"
+	"myapp/internal/model"
+	"myapp/internal/validation"
+)
+
+func generate(t *testing.T, g *generator, n int) []message {
+	t.Helper()
+	messages := make([]message, n)
+	for i := range messages {
+		msg, err := g.next()
+		if err != nil {
+			t.Fatalf("next error: %v", err)
+		}
+		messages[i] = msg
+	}
+	return messages
+}
+
+func TestGenerator_SeedIsReproducible(t *testing.T) {
+	summary := func(messages []message) []string {
+		var s []string
+		for _, msg := range messages {
+			s = append(s, msg.kind+":"+msg.orderUID)
+		}
+		return s
+	}
+
+	first := summary(generate(t, newGenerator(42, 2, 20, 20), 50))
+	second := summary(generate(t, newGenerator(42, 2, 20, 20), 50))
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("same seed gave different runs:\n%v\n%v", first, second)
+	}
+	other := summary(generate(t, newGenerator(43, 2, 20, 20), 50))
+	if reflect.DeepEqual(first, other) {
+		t.Fatal("different seeds gave the same run")
+	}
+}
+
+func TestGenerator_Mix(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		invalid, duplicate float64
+		want               map[string]bool
+	}{
+		{name: "valid only", want: map[string]bool{kindValid: true}},
+		{name: "invalid only", invalid: 100, want: map[string]bool{kindMalformed: true, kindMistyped: true, kindRule: true}},
+		{name: "mixed", invalid: 30, duplicate: 30,
+			want: map[string]bool{kindValid: true, kindDuplicate: true, kindMalformed: true, kindMistyped: true, kindRule: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := map[string]bool{}
+			for _, msg := range generate(t, newGenerator(7, 1, tc.invalid, tc.duplicate), 200) {
+				got[msg.kind] = true
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected kinds %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestGenerator_DuplicatesResendValidPayloads(t *testing.T) {
+	valid := map[string]bool{}
+	duplicates := 0
+	for _, msg := range generate(t, newGenerator(3, 1, 0, 50), 100) {
+		switch msg.kind {
+		case kindValid:
+			valid[string(msg.value)] = true
+		case kindDuplicate:
+			duplicates++
+			if !valid[string(msg.value)] {
+				t.Fatalf("duplicate %s does not repeat an earlier valid payload", msg.orderUID)
+			}
+		}
+	}
+	if duplicates == 0 {
+		t.Fatal("expected some duplicates")
+	}
+}
+
+// TestCorrupt_FailsIntendedStage checks that every invalid kind is rejected
+// where the consumer is meant to reject it: broken JSON by the decoder, a
+// broken rule by the validator.
+func TestCorrupt_FailsIntendedStage(t *testing.T) {
+	decoder := decode.New()
+	validator := validation.New()
+
+	for _, tc := range []struct {
+		kind           string
+		wantDecodeErr  bool
+		wantViolations bool
+	}{
+		{kind: kindValid},
+		{kind: kindMalformed, wantDecodeErr: true},
+		{kind: kindMistyped, wantDecodeErr: true},
+		{kind: kindRule, wantViolations: true},
+	} {
+		t.Run(tc.kind, func(t *testing.T) {
+			value, err := corrupt(newGenerator(1, 2, 0, 0).order("uid1"), tc.kind)
+			if err != nil {
+				t.Fatalf("corrupt error: %v", err)
+			}
+
+			var order model.Order
+			err = decoder.Decode(value, &order)
+			if (err != nil) != tc.wantDecodeErr {
+				t.Fatalf("decode error = %v, want error %v", err, tc.wantDecodeErr)
+			}
+			if tc.wantDecodeErr {
+				return
+			}
+
+			err = validator.Validate(&order)
+			var violations *validation.ViolationsError
+			if errors.As(err, &violations) != tc.wantViolations {
+				t.Fatalf("validate error = %v, want violations %v", err, tc.wantViolations)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"myapp/internal/kafka"
+	"sort"
+	"sync"
+	"time"
+)
+
+// sender is the part of kafka.Producer the load run needs.
+type sender interface {
+	SendRecords(ctx context.Context, records []kafka.Record) error
+}
+
+// source yields the messages of a run and io.EOF after the last one.
+type source interface {
+	next() (message, error)
+}
+
+type loadOptions struct {
+	count       int     // messages to send, 0 for all the source has
+	rate        float64 // messages per second, 0 for unlimited
+	concurrency int     // messages awaiting delivery at once
+	keyByUID    bool    // use order_uid as the message key
+	headers     map[string]string
+}
+
+func (o loadOptions) record(msg message) kafka.Record {
+	record := kafka.Record{Value: msg.value, Headers: o.headers}
+	if o.keyByUID && msg.orderUID != "" {
+		record.Key = []byte(msg.orderUID)
+	}
+	return record
+}
+
+// runLoad sends messages from src until count is reached, the source ends
+// or ctx is cancelled. Messages already handed to a worker are still
+// delivered and counted after cancellation.
+func runLoad(ctx context.Context, p sender, src source, opts loadOptions) (*report, error) {
+	r := newReport()
+	messages := make(chan message)
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range messages {
+				start := time.Now()
+				err := p.SendRecords(context.Background(), []kafka.Record{opts.record(msg)})
+				r.record(msg, time.Since(start), err)
+			}
+		}()
+	}
+
+	var interval time.Duration
+	if opts.rate > 0 {
+		interval = time.Duration(float64(time.Second) / opts.rate)
+	}
+
+	var err error
+feed:
+	for i := 0; opts.count == 0 || i < opts.count; i++ {
+		if interval > 0 {
+			// Scheduling against the start keeps the average rate even
+			// when a single wait oversleeps.
+			if wait := time.Until(r.start.Add(time.Duration(i) * interval)); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					break feed
+				}
+			}
+		}
+
+		msg, nextErr := src.next()
+		if errors.Is(nextErr, io.EOF) {
+			break
+		}
+		if nextErr != nil {
+			err = nextErr
+			break
+		}
+		select {
+		case messages <- msg:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(messages)
+	wg.Wait()
+	r.elapsed = time.Since(r.start)
+	return r, err
+}
+
+// report collects the outcome of a load run.
+type report struct {
+	start   time.Time
+	elapsed time.Duration
+
+	mu        sync.Mutex
+	kinds     map[string]int
+	sent      int
+	failed    int
+	bytes     int64
+	errors    map[string]int
+	latencies []time.Duration
+}
+
+func newReport() *report {
+	return &report{start: time.Now(), kinds: map[string]int{}, errors: map[string]int{}}
+}
+
+func (r *report) record(msg message, latency time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kinds[msg.kind]++
+	if err != nil {
+		r.failed++
+		r.errors[err.Error()]++
+		return
+	}
+	r.sent++
+	r.bytes += int64(len(msg.value))
+	r.latencies = append(r.latencies, latency)
+}
+
+func (r *report) print(w io.Writer) {
+	seconds := r.elapsed.Seconds()
+	fmt.Fprintf(w, "Sent %d of %d messages in %s (%.1f msg/s, %.2f MB/s)\n",
+		r.sent, r.sent+r.failed, r.elapsed.Round(time.Millisecond),
+		float64(r.sent)/seconds, float64(r.bytes)/seconds/(1<<20))
+
+	kinds := make([]string, 0, len(r.kinds))
+	for kind := range r.kinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(w, "  %-13s %d\n", kind, r.kinds[kind])
+	}
+
+	if len(r.latencies) > 0 {
+		sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+		percentile := func(p float64) time.Duration {
+			return r.latencies[int(p*float64(len(r.latencies)-1))].Round(time.Microsecond)
+		}
+		fmt.Fprintf(w, "Delivery latency: p50 %s, p95 %s, p99 %s, max %s\n",
+			percentile(0.50), percentile(0.95), percentile(0.99), percentile(1))
+	}
+
+	fmt.Fprintf(w, "Delivery errors: %d\n", r.failed)
+	for msg, n := range r.errors {
+		fmt.Fprintf(w, "  %6d  %s\n", n, msg)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"myapp/internal/kafka"
+)
+
+// fakeSender records what a load run sends and fails the values in fail.
+type fakeSender struct {
+	mu      sync.Mutex
+	records []kafka.Record
+	fail    map[string]error
+}
+
+func (f *fakeSender) SendRecords(ctx context.Context, records []kafka.Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.records = append(f.records, records...)
+	for _, record := range records {
+		if err := f.fail[string(record.Value)]; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestLoadOptions_Record(t *testing.T) {
+	headers := map[string]string{"source": "load"}
+	for _, tc := range []struct {
+		name     string
+		keyByUID bool
+		orderUID string
+		wantKey  string
+	}{
+		{name: "keyed by UID", keyByUID: true, orderUID: "uid1", wantKey: "uid1"},
+		{name: "no UID to key by", keyByUID: true},
+		{name: "unkeyed", orderUID: "uid1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := loadOptions{keyByUID: tc.keyByUID, headers: headers}
+			record := opts.record(message{kind: kindReplay, orderUID: tc.orderUID, value: []byte("{}")})
+			if string(record.Key) != tc.wantKey {
+				t.Fatalf("expected key %q, got %q", tc.wantKey, record.Key)
+			}
+			if tc.wantKey == "" && record.Key != nil {
+				t.Fatalf("expected no key, got %q", record.Key)
+			}
+			if string(record.Value) != "{}" || record.Headers["source"] != "load" {
+				t.Fatalf("unexpected record: %+v", record)
+			}
+		})
+	}
+}
+
+func TestRunLoad_KeysRecordsByUID(t *testing.T) {
+	p := &fakeSender{}
+	src := &sliceSource{
+		{kind: kindReplay, orderUID: "a", value: []byte(`{"order_uid":"a"}`)},
+		{kind: kindReplay, value: []byte(`{`)},
+	}
+
+	report, err := runLoad(context.Background(), p, src, loadOptions{concurrency: 1, keyByUID: true})
+	if err != nil {
+		t.Fatalf("runLoad error: %v", err)
+	}
+	if report.sent != 2 || len(p.records) != 2 {
+		t.Fatalf("expected 2 records sent, got %d (%d recorded)", report.sent, len(p.records))
+	}
+	if string(p.records[0].Key) != "a" || p.records[1].Key != nil {
+		t.Fatalf("unexpected keys %q and %q", p.records[0].Key, p.records[1].Key)
+	}
+}
+
+func TestRunLoad(t *testing.T) {
+	messages := func(n int) *sliceSource {
+		src := sliceSource{}
+		for i := 0; i < n; i++ {
+			src = append(src, message{kind: kindValid, value: []byte{byte('a' + i)}})
+		}
+		return &src
+	}
+
+	for _, tc := range []struct {
+		name        string
+		src         source
+		opts        loadOptions
+		fail        map[string]error
+		wantSent    int
+		wantFailed  int
+		wantErr     bool
+		minDuration time.Duration
+	}{
+		{name: "whole source", src: messages(5), opts: loadOptions{concurrency: 2}, wantSent: 5},
+		{name: "count stops early", src: messages(5), opts: loadOptions{count: 3, concurrency: 1}, wantSent: 3},
+		{name: "delivery failures", src: messages(4), opts: loadOptions{concurrency: 3},
+			fail: map[string]error{"b": errors.New("broker down"), "d": errors.New("broker down")}, wantSent: 2, wantFailed: 2},
+		{name: "source error", src: &errSource{messages(2)}, opts: loadOptions{concurrency: 1}, wantSent: 2, wantErr: true},
+		// Five messages at 100/s are due at 0, 10, ..., 40ms after the start.
+		{name: "rate", src: messages(5), opts: loadOptions{rate: 100, concurrency: 5}, wantSent: 5, minDuration: 40 * time.Millisecond},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &fakeSender{fail: tc.fail}
+			report, err := runLoad(context.Background(), p, tc.src, tc.opts)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("runLoad error = %v, want error %v", err, tc.wantErr)
+			}
+			if report.sent != tc.wantSent || report.failed != tc.wantFailed {
+				t.Fatalf("expected %d sent and %d failed, got %d and %d", tc.wantSent, tc.wantFailed, report.sent, report.failed)
+			}
+			if report.elapsed < tc.minDuration {
+				t.Fatalf("expected the run to take at least %s, took %s", tc.minDuration, report.elapsed)
+			}
+		})
+	}
+}
+
+func TestRunLoad_StopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	p := &fakeSender{}
+	report, err := runLoad(ctx, p, newGenerator(1, 1, 0, 0), loadOptions{rate: 1, concurrency: 1})
+	if err != nil {
+		t.Fatalf("runLoad error: %v", err)
+	}
+	// The first message is due immediately; the second waits a second and
+	// is cancelled.
+	if report.sent > 1 || len(p.records) > 1 {
+		t.Fatalf("expected at most one message after cancellation, sent %d", report.sent)
+	}
+}
+
+func TestReport_Print(t *testing.T) {
+	r := newReport()
+	r.record(message{kind: kindValid, value: []byte("1234")}, 10*time.Millisecond, nil)
+	r.record(message{kind: kindValid, value: []byte("12")}, 30*time.Millisecond, nil)
+	r.record(message{kind: kindDuplicate, value: []byte("12")}, 20*time.Millisecond, nil)
+	r.record(message{kind: kindMalformed, value: []byte("1")}, time.Millisecond, errors.New("timed out"))
+	r.elapsed = 2 * time.Second
+
+	if r.sent != 3 || r.failed != 1 || r.bytes != 8 {
+		t.Fatalf("expected 3 sent, 1 failed and 8 bytes, got %d, %d and %d", r.sent, r.failed, r.bytes)
+	}
+
+	var out bytes.Buffer
+	r.print(&out)
+	for _, want := range []string{
+		"Sent 3 of 4 messages in 2s (1.5 msg/s, 0.00 MB/s)",
+		"  duplicate     1\n",
+		"  invalid_json  1\n",
+		"  valid         2\n",
+		"Delivery latency: p50 20ms, p95 20ms, p99 20ms, max 30ms",
+		"Delivery errors: 1\n",
+		"       1  timed out",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %q in report:\n%s", want, out.String())
+		}
+	}
+}
+
+// errSource fails once the wrapped source is exhausted.
+type errSource struct {
+	source
+}
+
+func (s *errSource) next() (message, error) {
+	msg, err := s.source.next()
+	if err != nil {
+		return message{}, errors.New("read failed")
+	}
+	return msg, nil
+}
@@ -1,76 +1,157 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"myapp/internal/config"
+	"myapp/internal/decode"
 	"myapp/internal/kafka"
 	"myapp/internal/model"
+	"myapp/internal/schema"
+	"myapp/internal/validation"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/brianvoe/gofakeit/v7"
+	"github.com/joho/godotenv"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		log.Fatal("Usage: go run cmd/producer/main.go <order_uid>")
+	if err := godotenv.Load("config.env"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Warning: failed to read config.env: %v", err)
 	}
+	cfg := config.Load()
 
-	orderUID := os.Args[1]
-
-	gofakeit.Seed(time.Now().UnixNano())
-	order := &model.Order{
-		OrderUID:          orderUID,
-		TrackNumber:       gofakeit.Numerify("WB#########"),
-		Entry:             "WBIL",
-		Locale:            "en",
-		InternalSignature: "",
-		CustomerID:        gofakeit.Username(),
-		DeliveryService:   gofakeit.Company(),
-		ShardKey:          fmt.Sprintf("%d", gofakeit.Number(1, 10)),
-		SMID:              gofakeit.Number(1, 1000),
-		DateCreated:       time.Now(),
-		OOFShard:          fmt.Sprintf("%d", gofakeit.Number(1, 10)),
-		Delivery: model.Delivery{
-			Name:    gofakeit.Name(),
-			Phone:   gofakeit.Phone(),
-			Zip:     gofakeit.Zip(),
-			City:    gofakeit.City(),
-			Address: gofakeit.Street(),
-			Region:  gofakeit.StateAbr(),
-			Email:   gofakeit.Email(),
-		},
-		Payment: model.Payment{
-			Transaction:  orderUID,
-			RequestID:    "",
-			Currency:     "USD",
-			Provider:     "wbpay",
-			Amount:       gofakeit.Number(100, 10000),
-			PaymentDT:    time.Now().Unix(),
-			Bank:         gofakeit.Company(),
-			DeliveryCost: gofakeit.Number(100, 2000),
-			GoodsTotal:   gofakeit.Number(100, 5000),
-			CustomFee:    gofakeit.Number(0, 100),
-		},
-		Items: []model.Item{
-			{
-				ChrtID:      gofakeit.Number(1000000, 9999999),
-				TrackNumber: gofakeit.Numerify("WB#########"),
-				Price:       gofakeit.Number(10, 1000),
-				RID:         gofakeit.UUID(),
-				Name:        gofakeit.ProductName(),
-				Sale:        gofakeit.Number(0, 80),
-				Size:        fmt.Sprintf("%d", gofakeit.Number(0, 54)),
-				TotalPrice:  gofakeit.Number(10, 3000),
-				NMID:        gofakeit.Number(100000, 999999),
-				Brand:       gofakeit.Company(),
-				Status:      gofakeit.Number(100, 300),
-			},
-		},
+	brokers := flag.String("brokers", strings.Join(cfg.KafkaBrokers, ","), "Kafka bootstrap servers")
+	topic := flag.String("topic", cfg.KafkaTopic, "topic for orders")
+	statusTopic := flag.String("status-topic", cfg.KafkaStatusTopic, "topic for status changes")
+	count := flag.Int("count", 0, "number of orders to send (default 1 generated order, or every order of -file/-dir)")
+	rate := flag.Float64("rate", 0, "messages per second, 0 for as fast as possible")
+	concurrency := flag.Int("concurrency", 1, "messages awaiting delivery at once")
+	items := flag.Int("items", 1, "items per order")
+	seed := flag.Uint64("seed", 0, "seed for reproducible orders, 0 for a random one")
+	invalid := flag.Float64("invalid", 0, "percentage of orders that the consumer must reject")
+	duplicate := flag.Float64("duplicate", 0, "percentage of messages that resend an earlier order")
+	file := flag.String("file", "", "send the orders of a JSON or NDJSON file as stored, - for NDJSON on stdin")
+	dir := flag.String("dir", "", "send the orders of every .json, .ndjson and .jsonl file in a fixture directory")
+	keyByUID := flag.Bool("key", false, "set the message key to order_uid")
+	headers := headerFlag{}
+	flag.Var(headers, "header", "message header as key=value; repeatable")
+	dryRun := flag.Bool("dry-run", false, "validate orders with the OrderService rules instead of sending them")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"Usage: producer [flags]                       generate or replay and send orders\n"+
+				"       producer [flags] <order_uid>           send one order with this UID\n"+
+				"       producer [flags] <order_uid> <status>  send a status change\n\nFlags:\n")
+		flag.PrintDefaults()
 	}
+	flag.Parse()
 
-	producer, err := kafka.NewProducer("localhost:9092", "orders")
+	switch {
+	case *count < 0 || *concurrency < 1 || *items < 1 || *rate < 0:
+		log.Fatal("concurrency and items must be positive, count and rate not negative")
+	case *invalid < 0 || *duplicate < 0 || *invalid+*duplicate > 100:
+		log.Fatal("invalid and duplicate must be percentages adding up to at most 100")
+	case *file != "" && *dir != "":
+		log.Fatal("-file and -dir cannot be combined")
+	case flag.NArg() > 2, flag.NArg() > 0 && (*file != "" || *dir != ""):
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if flag.NArg() == 2 {
+		sendStatusChange(*brokers, *statusTopic, flag.Arg(0), model.OrderStatus(flag.Arg(1)))
+		return
+	}
+
+	var src source
+	switch {
+	case *file != "":
+		src = newFileSource(*file)
+	case *dir != "":
+		dirSource, err := newDirSource(*dir)
+		if err != nil {
+			log.Fatalf("Failed to read fixtures: %v", err)
+		}
+		src = dirSource
+	default:
+		if *seed == 0 {
+			*seed = uint64(time.Now().UnixNano())
+		}
+		gen := newGenerator(*seed, *items, *invalid, *duplicate)
+		if flag.NArg() == 1 {
+			sendOrder(*brokers, *topic, gen.order(flag.Arg(0)))
+			return
+		}
+		if *count == 0 {
+			*count = 1
+		}
+		log.Printf("Generating orders with seed %d", *seed)
+		src = gen
+	}
+
+	if *dryRun {
+		decoder := decode.New(
+			decode.WithStrict(cfg.DecodeStrict),
+			decode.WithMaxBytes(cfg.MaxBodyBytes),
+			decode.WithMaxItems(cfg.MaxOrderItems),
+		)
+		validator := validation.New(validation.WithDisabledRules(cfg.ValidationDisabledRules...))
+		if err := validator.CheckDisabledRules(); err != nil {
+			log.Fatalf("Invalid VALIDATION_DISABLED_RULES: %v", err)
+		}
+		var schemaValidator *schema.Validator
+		if cfg.KafkaSchemaValidation {
+			v, err := schema.NewOrderValidator()
+			if err != nil {
+				log.Fatalf("Failed to build order schema validator: %v", err)
+			}
+			schemaValidator = v
+		}
+		rejected, err := validateMessages(src, *count, schemaValidator, decoder, validator, os.Stdout)
+		if err != nil {
+			log.Fatalf("Failed to read orders: %v", err)
+		}
+		if rejected > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	producer, err := kafka.NewProducer(*brokers, *topic)
+	if err != nil {
+		log.Fatalf("Failed to create producer: %v", err)
+	}
+	defer producer.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Sending orders to %s on %s", *topic, *brokers)
+	report, err := runLoad(ctx, producer, src, loadOptions{
+		count:       *count,
+		rate:        *rate,
+		concurrency: *concurrency,
+		keyByUID:    *keyByUID,
+		headers:     headers,
+	})
+	report.print(os.Stdout)
+	if err != nil {
+		log.Fatalf("Failed to read orders: %v", err)
+	}
+	if report.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func sendOrder(brokers, topic string, order *model.Order) {
+	producer, err := kafka.NewProducer(brokers, topic)
 	if err != nil {
 		log.Fatalf("Failed to create producer: %v", err)
 	}
@@ -81,5 +162,20 @@ func main() {
 	}
 
 	jsonData, _ := json.MarshalIndent(order, "", "  ")
-	fmt.Printf("Order sent successfully!\nOrder UID: %s\nJSON:\n%s\n", orderUID, string(jsonData))
+	fmt.Printf("Order sent successfully!\nOrder UID: %s\nJSON:\n%s\n", order.OrderUID, string(jsonData))
+}
+
+func sendStatusChange(brokers, topic, orderUID string, status model.OrderStatus) {
+	producer, err := kafka.NewProducer(brokers, topic)
+	if err != nil {
+		log.Fatalf("Failed to create producer: %v", err)
+	}
+	defer producer.Close()
+
+	change := &model.StatusChange{OrderUID: orderUID, Status: status}
+	if err := producer.SendStatusChange(change); err != nil {
+		log.Fatalf("Failed to send status change: %v", err)
+	}
+
+	fmt.Printf("Status change sent successfully!\nOrder UID: %s\nStatus: %s\n", orderUID, status)
 }
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"myapp/internal/bulk"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// kindReplay marks messages read from files rather than generated.
+const kindReplay = "replay"
+
+// maxLineBytes bounds an NDJSON line. It is well above any message size the
+// broker accepts, so replayed payloads are never cut.
+const maxLineBytes = 64 << 20
+
+// replaySource yields payloads from files exactly as stored, so a malformed
+// message can be replayed as it was received. NDJSON files (.ndjson, .jsonl
+// and stdin) hold one payload per line; any other file holds a JSON array of
+// orders or a single payload.
+type replaySource struct {
+	files []string
+	lines *bulk.LineReader
+	name  string
+	queue [][]byte
+	close func() error
+}
+
+// newFileSource reads one file, or NDJSON from stdin for "-".
+func newFileSource(path string) *replaySource {
+	return &replaySource{files: []string{path}}
+}
+
+// newDirSource reads every .json, .ndjson and .jsonl file of a fixture
+// directory in name order.
+func newDirSource(dir string) (*replaySource, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		switch filepath.Ext(entry.Name()) {
+		case ".json", ".ndjson", ".jsonl":
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .json, .ndjson or .jsonl files in %s", dir)
+	}
+	sort.Strings(files)
+	return &replaySource{files: files}, nil
+}
+
+func (s *replaySource) next() (message, error) {
+	for {
+		if len(s.queue) > 0 {
+			value := s.queue[0]
+			s.queue = s.queue[1:]
+			return message{kind: kindReplay, orderUID: orderUIDOf(value), value: value}, nil
+		}
+
+		if s.lines != nil {
+			n, line, err := s.lines.Next()
+			switch {
+			case err == nil:
+				return message{kind: kindReplay, orderUID: orderUIDOf(line), value: line}, nil
+			case errors.Is(err, bulk.ErrLineTooLong):
+				return message{}, fmt.Errorf("%s:%d: line exceeds %d bytes", s.name, n, maxLineBytes)
+			case !errors.Is(err, io.EOF):
+				return message{}, fmt.Errorf("%s: %w", s.name, err)
+			}
+			s.lines = nil
+			if err := s.close(); err != nil {
+				return message{}, err
+			}
+		}
+
+		if len(s.files) == 0 {
+			return message{}, io.EOF
+		}
+		if err := s.open(s.files[0]); err != nil {
+			return message{}, err
+		}
+		s.files = s.files[1:]
+	}
+}
+
+func (s *replaySource) open(path string) error {
+	s.name = path
+	if path == "-" {
+		s.name = "stdin"
+		s.lines = bulk.NewLineReader(os.Stdin, maxLineBytes)
+		s.close = func() error { return nil }
+		return nil
+	}
+
+	switch filepath.Ext(path) {
+	case ".ndjson", ".jsonl":
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		s.lines = bulk.NewLineReader(f, maxLineBytes)
+		s.close = f.Close
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	data = bytes.TrimSpace(data)
+	var orders []json.RawMessage
+	if len(data) > 0 && data[0] == '[' && json.Unmarshal(data, &orders) == nil {
+		for _, order := range orders {
+			s.queue = append(s.queue, order)
+		}
+	} else if len(data) > 0 {
+		s.queue = append(s.queue, data)
+	}
+	return nil
+}
+
+// orderUIDOf reads order_uid from a payload, or returns "" if it cannot.
+func orderUIDOf(value []byte) string {
+	var order struct {
+		OrderUID string `json:"order_uid"`
+	}
+	if err := json.Unmarshal(value, &order); err != nil {
+		return ""
+	}
+	return order.OrderUID
+}
+
+// headerFlag collects repeated -header key=value flags.
+type headerFlag map[string]string
+
+func (h headerFlag) String() string {
+	pairs := make([]string, 0, len(h))
+	for key, value := range h {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (h headerFlag) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return errors.New("must be key=value")
+	}
+	h[key] = value
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// drain reads src to the end and returns the order UIDs and payloads.
+func drain(t *testing.T, src source) ([]string, []string) {
+	t.Helper()
+	var uids, values []string
+	for {
+		msg, err := src.next()
+		if errors.Is(err, io.EOF) {
+			return uids, values
+		}
+		if err != nil {
+			t.Fatalf("next error: %v", err)
+		}
+		if msg.kind != kindReplay {
+			t.Fatalf("expected kind %q, got %q", kindReplay, msg.kind)
+		}
+		uids = append(uids, msg.orderUID)
+		values = append(values, string(msg.value))
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestReplaySource_Files(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name       string
+		file       string
+		content    string
+		wantUIDs   []string
+		wantValues []string
+	}{
+		{
+			name:       "json array",
+			file:       "orders.json",
+			content:    `[{"order_uid":"a"}, {"order_uid":"b"}]`,
+			wantUIDs:   []string{"a", "b"},
+			wantValues: []string{`{"order_uid":"a"}`, `{"order_uid":"b"}`},
+		},
+		{
+			name:       "single object",
+			file:       "order.json",
+			content:    "  {\"order_uid\":\"a\"}\n",
+			wantUIDs:   []string{"a"},
+			wantValues: []string{`{"order_uid":"a"}`},
+		},
+		{
+			name:       "malformed payload kept as stored",
+			file:       "broken.json",
+			content:    `{"order_uid":`,
+			wantUIDs:   []string{""},
+			wantValues: []string{`{"order_uid":`},
+		},
+		{
+			name:       "ndjson",
+			file:       "orders.ndjson",
+			content:    "{\"order_uid\":\"a\"}\n\n{\"order_uid\":\"b\"}\n",
+			wantUIDs:   []string{"a", "b"},
+			wantValues: []string{`{"order_uid":"a"}`, `{"order_uid":"b"}`},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			uids, values := drain(t, newFileSource(writeFile(t, dir, tc.file, tc.content)))
+			if !reflect.DeepEqual(uids, tc.wantUIDs) || !reflect.DeepEqual(values, tc.wantValues) {
+				t.Fatalf("got UIDs %q and values %q, want %q and %q", uids, values, tc.wantUIDs, tc.wantValues)
+			}
+		})
+	}
+}
+
+func TestReplaySource_Stdin(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+
+	go func() {
+		w.WriteString("{\"order_uid\":\"a\"}\n{\"order_uid\":\"b\"}\n")
+		w.Close()
+	}()
+
+	uids, _ := drain(t, newFileSource("-"))
+	if !reflect.DeepEqual(uids, []string{"a", "b"}) {
+		t.Fatalf("unexpected UIDs from stdin: %q", uids)
+	}
+}
+
+func TestReplaySource_FixtureDir(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "b.ndjson", "{\"order_uid\":\"b1\"}\n{\"order_uid\":\"b2\"}\n")
+	writeFile(t, dir, "a.json", `[{"order_uid":"a1"},{"order_uid":"a2"}]`)
+	writeFile(t, dir, "c.jsonl", `{"order_uid":"c1"}`)
+	writeFile(t, dir, "notes.txt", "not an order")
+	if err := os.Mkdir(filepath.Join(dir, "skip.json"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	src, err := newDirSource(dir)
+	if err != nil {
+		t.Fatalf("newDirSource error: %v", err)
+	}
+	uids, _ := drain(t, src)
+	if want := []string{"a1", "a2", "b1", "b2", "c1"}; !reflect.DeepEqual(uids, want) {
+		t.Fatalf("expected %q, got %q", want, uids)
+	}
+
+	if _, err := newDirSource(t.TempDir()); err == nil {
+		t.Fatal("expected an error for a directory without fixtures")
+	}
+}
+
+func TestHeaderFlag_Set(t *testing.T) {
+	h := headerFlag{}
+	for _, value := range []string{"source=load", "trace=a=b", "empty="} {
+		if err := h.Set(value); err != nil {
+			t.Fatalf("Set(%q) error: %v", value, err)
+		}
+	}
+	for _, value := range []string{"novalue", "=x"} {
+		if err := h.Set(value); err == nil {
+			t.Fatalf("expected Set(%q) to fail", value)
+		}
+	}
+
+	want := headerFlag{"source": "load", "trace": "a=b", "empty": ""}
+	if !reflect.DeepEqual(h, want) {
+		t.Fatalf("expected %v, got %v", want, h)
+	}
+	if got := h.String(); got != "empty=,source=load,trace=a=b" {
+		t.Fatalf("unexpected String(): %q", got)
+	}
+}
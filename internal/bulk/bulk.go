@@ -0,0 +1,195 @@
+// Package bulk reads and writes orders in the line-oriented formats used for
+// import and export: NDJSON, one order per line, and CSV, one row per item.
+package bulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"myapp/internal/model"
+	"strconv"
+	"time"
+)
+
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown format")
+	ErrLineTooLong   = errors.New("line too long")
+)
+
+// ContentType returns the media type of a format.
+func ContentType(format string) string {
+	if format == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// Writer encodes orders one at a time. Output is buffered until Flush.
+type Writer interface {
+	Write(order *model.Order) error
+	Flush() error
+}
+
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case FormatNDJSON:
+		buf := bufio.NewWriter(w)
+		return &ndjsonWriter{buf: buf, enc: json.NewEncoder(buf)}, nil
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+	}
+}
+
+type ndjsonWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(order *model.Order) error {
+	return w.enc.Encode(order)
+}
+
+func (w *ndjsonWriter) Flush() error {
+	return w.buf.Flush()
+}
+
+// CSVHeader names the CSV columns: the order, its delivery and payment, then
+// one item. Each item of an order is a row repeating the order columns; an
+// order without items is a single row with empty item columns.
+var CSVHeader = []string{
+	"order_uid", "track_number", "entry", "locale", "internal_signature", "customer_id",
+	"delivery_service", "shardkey", "sm_id", "date_created", "oof_shard", "status", "version", "deleted_at",
+	"delivery_name", "delivery_phone", "delivery_zip", "delivery_city", "delivery_address", "delivery_region", "delivery_email",
+	"payment_transaction", "payment_request_id", "payment_currency", "payment_provider", "payment_amount", "payment_dt",
+	"payment_bank", "payment_delivery_cost", "payment_goods_total", "payment_custom_fee",
+	"item_chrt_id", "item_track_number", "item_price", "item_rid", "item_name", "item_sale", "item_size",
+	"item_total_price", "item_nm_id", "item_brand", "item_status",
+}
+
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (w *csvWriter) Write(order *model.Order) error {
+	if !w.header {
+		if err := w.w.Write(CSVHeader); err != nil {
+			return err
+		}
+		w.header = true
+	}
+	for _, row := range csvRows(order) {
+		if err := w.w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes the header even when no order was written, so an empty
+// export is still a valid CSV file.
+func (w *csvWriter) Flush() error {
+	if !w.header {
+		if err := w.w.Write(CSVHeader); err != nil {
+			return err
+		}
+		w.header = true
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func csvRows(o *model.Order) [][]string {
+	deletedAt := ""
+	if o.DeletedAt != nil {
+		deletedAt = o.DeletedAt.Format(time.RFC3339)
+	}
+	d, p := o.Delivery, o.Payment
+	order := []string{
+		o.OrderUID, o.TrackNumber, o.Entry, o.Locale, o.InternalSignature, o.CustomerID,
+		o.DeliveryService, o.ShardKey, strconv.Itoa(o.SMID), o.DateCreated.Format(time.RFC3339), o.OOFShard,
+		string(o.Status), strconv.FormatInt(o.Version, 10), deletedAt,
+		d.Name, d.Phone, d.Zip, d.City, d.Address, d.Region, d.Email,
+		p.Transaction, p.RequestID, p.Currency, p.Provider, strconv.Itoa(p.Amount), strconv.FormatInt(p.PaymentDT, 10),
+		p.Bank, strconv.Itoa(p.DeliveryCost), strconv.Itoa(p.GoodsTotal), strconv.Itoa(p.CustomFee),
+	}
+
+	if len(o.Items) == 0 {
+		return [][]string{append(order, make([]string, len(CSVHeader)-len(order))...)}
+	}
+	rows := make([][]string, len(o.Items))
+	for i, item := range o.Items {
+		row := make([]string, 0, len(CSVHeader))
+		row = append(row, order...)
+		rows[i] = append(row,
+			strconv.Itoa(item.ChrtID), item.TrackNumber, strconv.Itoa(item.Price), item.RID, item.Name,
+			strconv.Itoa(item.Sale), item.Size, strconv.Itoa(item.TotalPrice), strconv.Itoa(item.NMID),
+			item.Brand, strconv.Itoa(item.Status),
+		)
+	}
+	return rows
+}
+
+// LineReader splits an NDJSON stream into lines without holding more than
+// one line in memory.
+type LineReader struct {
+	r        *bufio.Reader
+	maxBytes int
+	line     int
+}
+
+// NewLineReader reads lines of at most maxBytes, not counting the line
+// break.
+func NewLineReader(r io.Reader, maxBytes int) *LineReader {
+	return &LineReader{r: bufio.NewReader(r), maxBytes: maxBytes}
+}
+
+// Next returns the next non-blank line and its 1-based number, or io.EOF
+// after the last one. A line longer than the limit is skipped and reported
+// as ErrLineTooLong; reading may continue after it.
+func (lr *LineReader) Next() (int, []byte, error) {
+	for {
+		lr.line++
+		var (
+			line    []byte
+			tooLong bool
+		)
+		for {
+			chunk, err := lr.r.ReadSlice('\n')
+			if !tooLong {
+				if len(line)+len(bytes.TrimRight(chunk, "\r\n")) > lr.maxBytes {
+					tooLong, line = true, nil
+				} else {
+					line = append(line, chunk...)
+				}
+			}
+			if errors.Is(err, bufio.ErrBufferFull) {
+				continue
+			}
+			if err != nil && !errors.Is(err, io.EOF) {
+				return lr.line, nil, err
+			}
+			if tooLong {
+				return lr.line, nil, ErrLineTooLong
+			}
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				return lr.line, line, nil
+			}
+			if err != nil {
+				return 0, nil, io.EOF
+			}
+			break
+		}
+	}
+}
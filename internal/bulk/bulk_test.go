@@ -0,0 +1,82 @@
+package bulk
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"myapp/internal/model"
+)
+
+func TestLineReader_SkipsBlankAndOversizedLines(t *testing.T) {
+	input := "{\"a\":1}\n\n" + strings.Repeat("x", 5000) + "\r\n{\"b\":2}"
+	lr := NewLineReader(strings.NewReader(input), 100)
+
+	type line struct {
+		n    int
+		data string
+		err  error
+	}
+	var got []line
+	for {
+		n, data, err := lr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		got = append(got, line{n, string(data), err})
+	}
+
+	want := []line{{1, `{"a":1}`, nil}, {3, "", ErrLineTooLong}, {4, `{"b":2}`, nil}}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i].n != want[i].n || got[i].data != want[i].data || !errors.Is(got[i].err, want[i].err) {
+			t.Fatalf("line %d: expected %v, got %v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestCSVWriter_FlattensItems(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, FormatCSV)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	orders := []*model.Order{
+		{OrderUID: "uid1", Delivery: model.Delivery{City: "Moscow, Center"}, Items: []model.Item{{RID: "r1"}, {RID: "r2"}}},
+		{OrderUID: "uid2"},
+	}
+	for _, order := range orders {
+		if err := w.Write(order); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid csv: %v", err)
+	}
+	if len(rows) != 4 || rows[0][0] != "order_uid" {
+		t.Fatalf("expected header and 3 rows, got %v", rows)
+	}
+	rid := len(CSVHeader) - 8
+	if CSVHeader[rid] != "item_rid" || rows[1][rid] != "r1" || rows[2][rid] != "r2" || rows[3][rid] != "" {
+		t.Fatalf("unexpected item columns: %v", rows)
+	}
+	if rows[2][0] != "uid1" || rows[2][17] != "Moscow, Center" {
+		t.Fatalf("expected order columns repeated per item, got %v", rows[2])
+	}
+}
+
+func TestNewWriter_RejectsUnknownFormat(t *testing.T) {
+	if _, err := NewWriter(io.Discard, "xml"); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("expected ErrUnknownFormat, got %v", err)
+	}
+}
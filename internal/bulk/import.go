@@ -0,0 +1,96 @@
+package bulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"myapp/internal/decode"
+	"myapp/internal/model"
+	"myapp/internal/service"
+	"myapp/internal/validation"
+)
+
+// Outcomes of an imported line.
+const (
+	ImportCreated  = "created"
+	ImportInvalid  = "invalid"
+	ImportConflict = "conflict"
+	ImportFailed   = "failed"
+)
+
+// ImportResult reports the outcome of one line of an import.
+type ImportResult struct {
+	Line     int                    `json:"line"`
+	OrderUID string                 `json:"order_uid,omitempty"`
+	Status   string                 `json:"status"`
+	Error    string                 `json:"error,omitempty"`
+	Errors   []validation.Violation `json:"errors,omitempty"`
+}
+
+type ImportSummary struct {
+	Lines    int `json:"lines"`
+	Created  int `json:"created"`
+	Invalid  int `json:"invalid"`
+	Conflict int `json:"conflict"`
+	Failed   int `json:"failed"`
+}
+
+func (s *ImportSummary) Add(status string) {
+	s.Lines++
+	switch status {
+	case ImportCreated:
+		s.Created++
+	case ImportInvalid:
+		s.Invalid++
+	case ImportConflict:
+		s.Conflict++
+	default:
+		s.Failed++
+	}
+}
+
+// OrderCreator is the part of service.Service an import needs.
+type OrderCreator interface {
+	CreateOrder(ctx context.Context, order *model.Order) error
+}
+
+// TooLongResult reports a line rejected by LineReader for exceeding the
+// decoder's size limit.
+func TooLongResult(line int, maxBytes int64) ImportResult {
+	return ImportResult{Line: line, Status: ImportInvalid, Error: fmt.Sprintf("line exceeds %d bytes", maxBytes)}
+}
+
+// ImportLine decodes one line with the limits of a single order request and
+// creates the order.
+func ImportLine(ctx context.Context, svc OrderCreator, decoder *decode.Decoder, line int, data []byte) ImportResult {
+	result := ImportResult{Line: line}
+
+	var order model.Order
+	if err := decoder.Decode(data, &order); err != nil {
+		result.Status, result.Error = ImportInvalid, err.Error()
+		var decodeErr *decode.Error
+		if errors.As(err, &decodeErr) && decodeErr.Field != "" {
+			result.Errors = []validation.Violation{{Rule: decodeErr.Rule, Field: decodeErr.Field, Message: decodeErr.Message}}
+		}
+		return result
+	}
+	result.OrderUID = order.OrderUID
+
+	err := svc.CreateOrder(ctx, &order)
+	switch {
+	case err == nil:
+		result.Status = ImportCreated
+	case validation.IsValidationError(err):
+		result.Status, result.Error = ImportInvalid, "Order validation failed"
+		result.Errors = validation.Violations(err)
+	case errors.Is(err, service.ErrAlreadyExists):
+		result.Status, result.Error = ImportConflict, "Order already exists"
+	case errors.Is(err, service.ErrDuplicateTransaction):
+		result.Status, result.Error = ImportConflict, "Payment transaction is already recorded for another order"
+	default:
+		log.Printf("Error importing order %s: %v", order.OrderUID, err)
+		result.Status, result.Error = ImportFailed, "Failed to create order"
+	}
+	return result
+}
@@ -1,9 +1,11 @@
 package cache
 
 import (
+	"encoding/json"
+	"log"
 	"myapp/internal/model"
 	"sync"
-	"time"
+	"sync/atomic"
 
 	lru "github.com/hashicorp/golang-lru/v2"
 )
@@ -11,34 +13,83 @@ import (
 type Cache interface {
 	Set(orderUID string, order *model.Order)
 	Get(orderUID string) (*model.Order, bool)
+	// Peek is Get for bulk reads: it is not counted in the statistics and
+	// does not refresh the entry's recency.
+	Peek(orderUID string) (*model.Order, bool)
+	GetJSON(orderUID string) (data []byte, version int64, ok bool)
 	Delete(orderUID string)
 	GetAll() map[string]*model.Order
 	Clear()
 	Size() int
 }
 
+// entry is never modified after creation: Set stores a private copy of the
+// order together with its JSON encoding, and readers only ever get copies.
+type entry struct {
+	order *model.Order
+	json  []byte
+}
+
+func newEntry(order *model.Order) *entry {
+	e := &entry{order: order.Clone()}
+	data, err := json.Marshal(e.order)
+	if err != nil {
+		log.Printf("Failed to pre-encode cached order %s: %v", order.OrderUID, err)
+		return e
+	}
+	e.json = data
+	return e
+}
+
+func (e *entry) jsonCopy() ([]byte, int64, bool) {
+	if e.json == nil {
+		return nil, 0, false
+	}
+	data := make([]byte, len(e.json))
+	copy(data, e.json)
+	return data, e.order.Version, true
+}
+
 type InMemoryCache struct {
 	mu    sync.RWMutex
-	items map[string]*model.Order
+	items map[string]*entry
 }
 
 func NewInMemoryCache() Cache {
 	return &InMemoryCache{
-		items: make(map[string]*model.Order),
+		items: make(map[string]*entry),
 	}
 }
 
 func (c *InMemoryCache) Set(orderUID string, order *model.Order) {
+	e := newEntry(order)
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.items[orderUID] = order
+	c.items[orderUID] = e
 }
 
 func (c *InMemoryCache) Get(orderUID string) (*model.Order, bool) {
 	c.mu.RLock()
-	defer c.mu.RUnlock()
-	order, exists := c.items[orderUID]
-	return order, exists
+	e, exists := c.items[orderUID]
+	c.mu.RUnlock()
+	if !exists {
+		return nil, false
+	}
+	return e.order.Clone(), true
+}
+
+func (c *InMemoryCache) Peek(orderUID string) (*model.Order, bool) {
+	return c.Get(orderUID)
+}
+
+func (c *InMemoryCache) GetJSON(orderUID string) ([]byte, int64, bool) {
+	c.mu.RLock()
+	e, exists := c.items[orderUID]
+	c.mu.RUnlock()
+	if !exists {
+		return nil, 0, false
+	}
+	return e.jsonCopy()
 }
 
 func (c *InMemoryCache) Delete(orderUID string) {
@@ -53,7 +104,7 @@ func (c *InMemoryCache) GetAll() map[string]*model.Order {
 
 	result := make(map[string]*model.Order)
 	for k, v := range c.items {
-		result[k] = v
+		result[k] = v.order.Clone()
 	}
 	return result
 }
@@ -61,7 +112,7 @@ func (c *InMemoryCache) GetAll() map[string]*model.Order {
 func (c *InMemoryCache) Clear() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.items = make(map[string]*model.Order)
+	c.items = make(map[string]*entry)
 }
 
 func (c *InMemoryCache) Size() int {
@@ -71,11 +122,12 @@ func (c *InMemoryCache) Size() int {
 }
 
 type LRUCache struct {
-	cache *lru.Cache[string, *model.Order]
+	cache     *lru.Cache[string, *entry]
+	evictions atomic.Int64
 }
 
 func NewLRUCache(capacity int) (Cache, error) {
-	c, err := lru.New[string, *model.Order](capacity)
+	c, err := lru.New[string, *entry](capacity)
 	if err != nil {
 		return nil, err
 	}
@@ -83,11 +135,33 @@ func NewLRUCache(capacity int) (Cache, error) {
 }
 
 func (c *LRUCache) Set(orderUID string, order *model.Order) {
-	c.cache.Add(orderUID, order)
+	if evicted := c.cache.Add(orderUID, newEntry(order)); evicted {
+		c.evictions.Add(1)
+	}
 }
 
 func (c *LRUCache) Get(orderUID string) (*model.Order, bool) {
-	return c.cache.Get(orderUID)
+	e, exists := c.cache.Get(orderUID)
+	if !exists {
+		return nil, false
+	}
+	return e.order.Clone(), true
+}
+
+func (c *LRUCache) Peek(orderUID string) (*model.Order, bool) {
+	e, exists := c.cache.Peek(orderUID)
+	if !exists {
+		return nil, false
+	}
+	return e.order.Clone(), true
+}
+
+func (c *LRUCache) GetJSON(orderUID string) ([]byte, int64, bool) {
+	e, exists := c.cache.Get(orderUID)
+	if !exists {
+		return nil, 0, false
+	}
+	return e.jsonCopy()
 }
 
 func (c *LRUCache) Delete(orderUID string) {
@@ -98,7 +172,7 @@ func (c *LRUCache) GetAll() map[string]*model.Order {
 	result := make(map[string]*model.Order)
 	for _, key := range c.cache.Keys() {
 		if val, ok := c.cache.Peek(key); ok {
-			result[key] = val
+			result[key] = val.order.Clone()
 		}
 	}
 	return result
@@ -112,59 +186,6 @@ func (c *LRUCache) Size() int {
 	return c.cache.Len()
 }
 
-type CacheStats struct {
-	Size      int           `json:"size"`
-	HitRate   float64       `json:"hit_rate"`
-	MissRate  float64       `json:"miss_rate"`
-	TotalHits int64         `json:"total_hits"`
-	TotalMiss int64         `json:"total_miss"`
-	Uptime    time.Duration `json:"uptime"`
-}
-
-type StatsCache struct {
-	Cache
-	stats     CacheStats
-	startTime time.Time
-	mu        sync.RWMutex
-}
-
-func NewStatsCache(cache Cache) *StatsCache {
-	return &StatsCache{
-		Cache:     cache,
-		startTime: time.Now(),
-	}
-}
-
-func (sc *StatsCache) Get(orderUID string) (*model.Order, bool) {
-	order, exists := sc.Cache.Get(orderUID)
-
-	sc.mu.Lock()
-	if exists {
-		sc.stats.TotalHits++
-	} else {
-		sc.stats.TotalMiss++
-	}
-	sc.updateRates()
-	sc.mu.Unlock()
-
-	return order, exists
-}
-
-func (sc *StatsCache) GetStats() CacheStats {
-	sc.mu.RLock()
-	defer sc.mu.RUnlock()
-
-	stats := sc.stats
-	stats.Size = sc.Cache.Size()
-	stats.Uptime = time.Since(sc.startTime)
-
-	return stats
-}
-
-func (sc *StatsCache) updateRates() {
-	total := sc.stats.TotalHits + sc.stats.TotalMiss
-	if total > 0 {
-		sc.stats.HitRate = float64(sc.stats.TotalHits) / float64(total)
-		sc.stats.MissRate = float64(sc.stats.TotalMiss) / float64(total)
-	}
+func (c *LRUCache) Evictions() int64 {
+	return c.evictions.Load()
 }
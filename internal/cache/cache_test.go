@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"myapp/internal/model"
+)
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	c := NewInMemoryCache()
+	c.Set("uid1", &model.Order{OrderUID: "uid1", DateCreated: time.Now().UTC(), Items: []model.Item{{RID: "r1"}}})
+	c.Set("uid2", &model.Order{OrderUID: "uid2"})
+
+	path := filepath.Join(t.TempDir(), "cache.snap")
+	horizon := func(context.Context) (model.EventPosition, error) {
+		return model.EventPosition{XID: 42}, nil
+	}
+	if err := NewSnapshotter(c, horizon, path, time.Minute).Save(context.Background()); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	snap, err := ReadSnapshot(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if snap.Position.XID != 42 {
+		t.Fatalf("expected the horizon to be saved, got %+v", snap.Position)
+	}
+	if len(snap.Orders) != 2 {
+		t.Fatalf("expected 2 orders, got %d", len(snap.Orders))
+	}
+	for _, order := range snap.Orders {
+		if order.OrderUID == "uid1" && (len(order.Items) != 1 || order.Items[0].RID != "r1") {
+			t.Fatalf("items not restored: %+v", order.Items)
+		}
+	}
+}
+
+func TestSnapshot_DetectsCorruption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snap")
+	if err := WriteSnapshot(path, &Snapshot{TakenAt: time.Now(), Orders: []*model.Order{{OrderUID: "uid1"}}}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	if _, err := ReadSnapshot(path); !errors.Is(err, ErrSnapshotCorrupted) {
+		t.Fatalf("expected ErrSnapshotCorrupted, got %v", err)
+	}
+}
+
+func TestStatsCache_TracksOperationsAndResets(t *testing.T) {
+	lruCache, err := NewLRUCache(1)
+	if err != nil {
+		t.Fatalf("lru: %v", err)
+	}
+	sc := NewStatsCache(lruCache)
+
+	sc.Set("uid1", &model.Order{OrderUID: "uid1"})
+	sc.Set("uid2", &model.Order{OrderUID: "uid2"})
+	sc.Get("uid1")
+	sc.Get("uid2")
+	sc.Delete("uid2")
+	sc.RecordWarmup(2, time.Millisecond)
+
+	stats := sc.GetStats()
+	if stats.TotalSets != 2 || stats.TotalDeletes != 1 || stats.Evictions != 1 || stats.Warmups != 1 {
+		t.Fatalf("unexpected counters: %+v", stats)
+	}
+	if stats.TotalHits != 1 || stats.TotalMiss != 1 || stats.HitRate != 0.5 {
+		t.Fatalf("unexpected hit/miss: %+v", stats)
+	}
+	if stats.Latencies["get"].Count != 2 {
+		t.Fatalf("expected 2 get latency samples, got %d", stats.Latencies["get"].Count)
+	}
+
+	sc.ResetStats()
+	stats = sc.GetStats()
+	if stats.TotalSets != 0 || stats.TotalHits != 0 || stats.Evictions != 0 || stats.Latencies["get"].Count != 0 {
+		t.Fatalf("expected counters to be reset: %+v", stats)
+	}
+}
+
+func TestCache_ReturnsCopies(t *testing.T) {
+	lruCache, err := NewLRUCache(10)
+	if err != nil {
+		t.Fatalf("lru: %v", err)
+	}
+
+	for name, c := range map[string]Cache{"memory": NewInMemoryCache(), "lru": lruCache} {
+		t.Run(name, func(t *testing.T) {
+			order := &model.Order{OrderUID: "uid1", TrackNumber: "trk", Items: []model.Item{{RID: "r1"}}}
+			c.Set("uid1", order)
+
+			order.TrackNumber = "mutated-before-get"
+			got, _ := c.Get("uid1")
+			got.TrackNumber = "mutated-after-get"
+			got.Items[0].RID = "mutated"
+
+			again, _ := c.Get("uid1")
+			if again.TrackNumber != "trk" || again.Items[0].RID != "r1" {
+				t.Fatalf("cached order was mutated: %+v", again)
+			}
+
+			data, _, ok := c.GetJSON("uid1")
+			if !ok {
+				t.Fatalf("expected pre-encoded JSON")
+			}
+			var decoded model.Order
+			if err := json.Unmarshal(data, &decoded); err != nil || decoded.TrackNumber != "trk" {
+				t.Fatalf("unexpected JSON %s: %v", data, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"myapp/internal/model"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const snapshotVersion uint16 = 2
+
+var snapshotMagic = [4]byte{'O', 'S', 'N', 'P'}
+
+var (
+	ErrSnapshotCorrupted = errors.New("cache snapshot is corrupted")
+	ErrSnapshotVersion   = errors.New("unsupported cache snapshot version")
+)
+
+// Snapshot is a point-in-time copy of the cache contents. Position is the
+// audit log horizon read from the database before the cache, so every change
+// the copy may lack has an event after it.
+type Snapshot struct {
+	TakenAt  time.Time
+	Position model.EventPosition
+	Orders   []*model.Order
+}
+
+type snapshotHeader struct {
+	Magic    [4]byte
+	Version  uint16
+	Checksum uint32
+	Length   uint64
+}
+
+// HorizonFunc reports the audit log position up to which all changes have
+// finished.
+type HorizonFunc func(ctx context.Context) (model.EventPosition, error)
+
+func TakeSnapshot(c Cache, position model.EventPosition) *Snapshot {
+	snap := &Snapshot{TakenAt: time.Now(), Position: position}
+	for _, order := range c.GetAll() {
+		snap.Orders = append(snap.Orders, order)
+	}
+	return snap
+}
+
+func WriteSnapshot(path string, snap *Snapshot) error {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(snap); err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	header := snapshotHeader{
+		Magic:    snapshotMagic,
+		Version:  snapshotVersion,
+		Checksum: crc32.ChecksumIEEE(payload.Bytes()),
+		Length:   uint64(payload.Len()),
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if err := binary.Write(w, binary.BigEndian, header); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot header: %w", err)
+	}
+	if _, err := w.Write(payload.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot payload: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to flush snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace snapshot file: %w", err)
+	}
+	return nil
+}
+
+func ReadSnapshot(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var header snapshotHeader
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("%w: failed to read header: %v", ErrSnapshotCorrupted, err)
+	}
+	if header.Magic != snapshotMagic {
+		return nil, fmt.Errorf("%w: bad magic", ErrSnapshotCorrupted)
+	}
+	if header.Version != snapshotVersion {
+		return nil, fmt.Errorf("%w: %d", ErrSnapshotVersion, header.Version)
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(r, int64(header.Length)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot payload: %w", err)
+	}
+	if uint64(len(payload)) != header.Length {
+		return nil, fmt.Errorf("%w: truncated payload", ErrSnapshotCorrupted)
+	}
+	if crc32.ChecksumIEEE(payload) != header.Checksum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrSnapshotCorrupted)
+	}
+
+	var snap Snapshot
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSnapshotCorrupted, err)
+	}
+	return &snap, nil
+}
+
+type Snapshotter struct {
+	cache    Cache
+	horizon  HorizonFunc
+	path     string
+	interval time.Duration
+}
+
+func NewSnapshotter(cache Cache, horizon HorizonFunc, path string, interval time.Duration) *Snapshotter {
+	return &Snapshotter{
+		cache:    cache,
+		horizon:  horizon,
+		path:     path,
+		interval: interval,
+	}
+}
+
+// Save writes a snapshot, reading the horizon first so that the snapshot can
+// be brought up to date from the audit log on restore.
+func (s *Snapshotter) Save(ctx context.Context) error {
+	position, err := s.horizon(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read event horizon: %w", err)
+	}
+	snap := TakeSnapshot(s.cache, position)
+	if err := WriteSnapshot(s.path, snap); err != nil {
+		return err
+	}
+	log.Printf("Cache snapshot saved to %s (%d orders)", s.path, len(snap.Orders))
+	return nil
+}
+
+func (s *Snapshotter) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Save(ctx); err != nil {
+				log.Printf("Failed to save cache snapshot: %v", err)
+			}
+		}
+	}
+}
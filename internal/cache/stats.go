@@ -0,0 +1,230 @@
+package cache
+
+import (
+	"myapp/internal/model"
+	"sync/atomic"
+	"time"
+)
+
+// StatsReporter is implemented by caches that collect usage statistics.
+type StatsReporter interface {
+	GetStats() CacheStats
+	ResetStats()
+	RecordWarmup(loaded int, duration time.Duration)
+}
+
+type evictionCounter interface {
+	Evictions() int64
+}
+
+var latencyBuckets = []time.Duration{
+	time.Microsecond,
+	5 * time.Microsecond,
+	10 * time.Microsecond,
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+}
+
+type CacheStats struct {
+	Size               int                     `json:"size"`
+	HitRate            float64                 `json:"hit_rate"`
+	MissRate           float64                 `json:"miss_rate"`
+	TotalHits          int64                   `json:"total_hits"`
+	TotalMiss          int64                   `json:"total_miss"`
+	TotalSets          int64                   `json:"total_sets"`
+	TotalDeletes       int64                   `json:"total_deletes"`
+	Evictions          int64                   `json:"evictions"`
+	Warmups            int64                   `json:"warmups"`
+	LastWarmupOrders   int64                   `json:"last_warmup_orders"`
+	LastWarmupDuration time.Duration           `json:"last_warmup_duration"`
+	Latencies          map[string]LatencyStats `json:"latencies,omitempty"`
+	Uptime             time.Duration           `json:"uptime"`
+	SinceReset         time.Duration           `json:"since_reset"`
+}
+
+type LatencyStats struct {
+	Count     int64           `json:"count"`
+	AvgMicros float64         `json:"avg_us"`
+	Buckets   []LatencyBucket `json:"buckets"`
+}
+
+type LatencyBucket struct {
+	UpperBound string `json:"le"`
+	Count      int64  `json:"count"`
+}
+
+type latencyHistogram struct {
+	count   atomic.Int64
+	totalNs atomic.Int64
+	buckets []atomic.Int64
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{buckets: make([]atomic.Int64, len(latencyBuckets)+1)}
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	h.count.Add(1)
+	h.totalNs.Add(int64(d))
+	for i, bound := range latencyBuckets {
+		if d <= bound {
+			h.buckets[i].Add(1)
+			return
+		}
+	}
+	h.buckets[len(latencyBuckets)].Add(1)
+}
+
+func (h *latencyHistogram) reset() {
+	h.count.Store(0)
+	h.totalNs.Store(0)
+	for i := range h.buckets {
+		h.buckets[i].Store(0)
+	}
+}
+
+func (h *latencyHistogram) snapshot() LatencyStats {
+	stats := LatencyStats{Count: h.count.Load()}
+	if stats.Count > 0 {
+		stats.AvgMicros = float64(h.totalNs.Load()) / float64(stats.Count) / float64(time.Microsecond)
+	}
+	for i := range h.buckets {
+		bound := "+Inf"
+		if i < len(latencyBuckets) {
+			bound = latencyBuckets[i].String()
+		}
+		stats.Buckets = append(stats.Buckets, LatencyBucket{UpperBound: bound, Count: h.buckets[i].Load()})
+	}
+	return stats
+}
+
+type StatsCache struct {
+	Cache
+	startTime time.Time
+	resetAt   atomic.Int64
+
+	hits          atomic.Int64
+	misses        atomic.Int64
+	sets          atomic.Int64
+	deletes       atomic.Int64
+	evictionsBase atomic.Int64
+	warmups       atomic.Int64
+	warmupOrders  atomic.Int64
+	warmupNs      atomic.Int64
+
+	getLatency    *latencyHistogram
+	setLatency    *latencyHistogram
+	deleteLatency *latencyHistogram
+}
+
+func NewStatsCache(cache Cache) *StatsCache {
+	now := time.Now()
+	sc := &StatsCache{
+		Cache:         cache,
+		startTime:     now,
+		getLatency:    newLatencyHistogram(),
+		setLatency:    newLatencyHistogram(),
+		deleteLatency: newLatencyHistogram(),
+	}
+	sc.resetAt.Store(now.UnixNano())
+	return sc
+}
+
+func (sc *StatsCache) Get(orderUID string) (*model.Order, bool) {
+	start := time.Now()
+	order, exists := sc.Cache.Get(orderUID)
+	sc.getLatency.observe(time.Since(start))
+
+	if exists {
+		sc.hits.Add(1)
+	} else {
+		sc.misses.Add(1)
+	}
+	return order, exists
+}
+
+func (sc *StatsCache) GetJSON(orderUID string) ([]byte, int64, bool) {
+	start := time.Now()
+	data, version, exists := sc.Cache.GetJSON(orderUID)
+	sc.getLatency.observe(time.Since(start))
+
+	if exists {
+		sc.hits.Add(1)
+	} else {
+		sc.misses.Add(1)
+	}
+	return data, version, exists
+}
+
+func (sc *StatsCache) Set(orderUID string, order *model.Order) {
+	start := time.Now()
+	sc.Cache.Set(orderUID, order)
+	sc.setLatency.observe(time.Since(start))
+	sc.sets.Add(1)
+}
+
+func (sc *StatsCache) Delete(orderUID string) {
+	start := time.Now()
+	sc.Cache.Delete(orderUID)
+	sc.deleteLatency.observe(time.Since(start))
+	sc.deletes.Add(1)
+}
+
+func (sc *StatsCache) RecordWarmup(loaded int, duration time.Duration) {
+	sc.warmups.Add(1)
+	sc.warmupOrders.Store(int64(loaded))
+	sc.warmupNs.Store(int64(duration))
+}
+
+func (sc *StatsCache) GetStats() CacheStats {
+	stats := CacheStats{
+		Size:               sc.Cache.Size(),
+		TotalHits:          sc.hits.Load(),
+		TotalMiss:          sc.misses.Load(),
+		TotalSets:          sc.sets.Load(),
+		TotalDeletes:       sc.deletes.Load(),
+		Evictions:          sc.evictions() - sc.evictionsBase.Load(),
+		Warmups:            sc.warmups.Load(),
+		LastWarmupOrders:   sc.warmupOrders.Load(),
+		LastWarmupDuration: time.Duration(sc.warmupNs.Load()),
+		Latencies: map[string]LatencyStats{
+			"get":    sc.getLatency.snapshot(),
+			"set":    sc.setLatency.snapshot(),
+			"delete": sc.deleteLatency.snapshot(),
+		},
+		Uptime:     time.Since(sc.startTime),
+		SinceReset: time.Since(time.Unix(0, sc.resetAt.Load())),
+	}
+
+	if total := stats.TotalHits + stats.TotalMiss; total > 0 {
+		stats.HitRate = float64(stats.TotalHits) / float64(total)
+		stats.MissRate = float64(stats.TotalMiss) / float64(total)
+	}
+	return stats
+}
+
+func (sc *StatsCache) ResetStats() {
+	sc.hits.Store(0)
+	sc.misses.Store(0)
+	sc.sets.Store(0)
+	sc.deletes.Store(0)
+	sc.evictionsBase.Store(sc.evictions())
+	sc.warmups.Store(0)
+	sc.warmupOrders.Store(0)
+	sc.warmupNs.Store(0)
+	sc.getLatency.reset()
+	sc.setLatency.reset()
+	sc.deleteLatency.reset()
+	sc.resetAt.Store(time.Now().UnixNano())
+}
+
+func (sc *StatsCache) evictions() int64 {
+	if ec, ok := sc.Cache.(evictionCounter); ok {
+		return ec.Evictions()
+	}
+	return 0
+}
@@ -3,23 +3,53 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	DBHost         string
-	DBPort         int
-	DBUser         string
-	DBPassword     string
-	DBName         string
-	DBSSLMode      string
-	KafkaBrokers   []string
-	KafkaTopic     string
-	KafkaGroupID   string
-	ServerPort     int
-	MigrationsPath string
-	CacheType      string
-	CacheLRUSize   int
-	KafkaDLQTopic  string
+	DBHost           string
+	DBPort           int
+	DBUser           string
+	DBPassword       string
+	DBName           string
+	DBSSLMode        string
+	KafkaBrokers     []string
+	KafkaTopic       string
+	KafkaGroupID     string
+	ServerPort       int
+	GRPCPort         int
+	MigrationsPath   string
+	CacheType        string
+	CacheLRUSize     int
+	KafkaDLQTopic    string
+	KafkaStatusTopic string
+	KafkaEventsTopic string
+
+	CacheSnapshotPath     string
+	CacheSnapshotInterval time.Duration
+
+	OrderRetention    time.Duration
+	PurgeInterval     time.Duration
+	IdempotencyKeyTTL time.Duration
+
+	ValidationDisabledRules []string
+
+	DecodeStrict  bool
+	MaxBodyBytes  int64
+	MaxOrderItems int
+
+	KafkaSchemaValidation bool
+
+	StreamPollInterval time.Duration
+
+	WebhookPollInterval time.Duration
+	WebhookTimeout      time.Duration
+	WebhookMaxAttempts  int
+	WebhookDisableAfter int
+	WebhookAllowPrivate bool
+
+	OutboxPollInterval time.Duration
 }
 
 func Load() Config {
@@ -38,20 +68,48 @@ func Load() Config {
 	}
 
 	return Config{
-		DBHost:         getEnv("DB_HOST", "localhost"),
-		DBPort:         dbPort,
-		DBUser:         getEnv("DB_USER", "myapp_user"),
-		DBPassword:     getEnv("DB_PASSWORD", "myapp_password"),
-		DBName:         getEnv("DB_NAME", "myapp_db"),
-		DBSSLMode:      getEnv("DB_SSLMODE", "disable"),
-		KafkaBrokers:   []string{getEnv("KAFKA_BROKERS", "localhost:9092")},
-		KafkaTopic:     getEnv("KAFKA_TOPIC", "orders"),
-		KafkaGroupID:   getEnv("KAFKA_GROUP_ID", "order-service"),
-		ServerPort:     serverPort,
-		MigrationsPath: getEnv("MIGRATIONS_PATH", "./migrations"),
-		CacheType:      getEnv("CACHE_TYPE", "memory"),
-		CacheLRUSize:   getIntEnv("CACHE_LRU_SIZE", 1000),
-		KafkaDLQTopic:  getEnv("KAFKA_DLQ_TOPIC", "orders-dlq"),
+		DBHost:           getEnv("DB_HOST", "localhost"),
+		DBPort:           dbPort,
+		DBUser:           getEnv("DB_USER", "myapp_user"),
+		DBPassword:       getEnv("DB_PASSWORD", "myapp_password"),
+		DBName:           getEnv("DB_NAME", "myapp_db"),
+		DBSSLMode:        getEnv("DB_SSLMODE", "disable"),
+		KafkaBrokers:     []string{getEnv("KAFKA_BROKERS", "localhost:9092")},
+		KafkaTopic:       getEnv("KAFKA_TOPIC", "orders"),
+		KafkaGroupID:     getEnv("KAFKA_GROUP_ID", "order-service"),
+		ServerPort:       serverPort,
+		GRPCPort:         getIntEnv("GRPC_PORT", 9090),
+		MigrationsPath:   getEnv("MIGRATIONS_PATH", "./migrations"),
+		CacheType:        getEnv("CACHE_TYPE", "memory"),
+		CacheLRUSize:     getIntEnv("CACHE_LRU_SIZE", 1000),
+		KafkaDLQTopic:    getEnv("KAFKA_DLQ_TOPIC", "orders-dlq"),
+		KafkaStatusTopic: getEnv("KAFKA_STATUS_TOPIC", "order-status"),
+		KafkaEventsTopic: getEnv("KAFKA_EVENTS_TOPIC", "order-events"),
+
+		CacheSnapshotPath:     getEnv("CACHE_SNAPSHOT_PATH", ""),
+		CacheSnapshotInterval: getDurationEnv("CACHE_SNAPSHOT_INTERVAL", 5*time.Minute),
+
+		OrderRetention:    getDurationEnv("ORDER_RETENTION", 30*24*time.Hour),
+		PurgeInterval:     getDurationEnv("PURGE_INTERVAL", time.Hour),
+		IdempotencyKeyTTL: getDurationEnv("IDEMPOTENCY_KEY_TTL", 7*24*time.Hour),
+
+		ValidationDisabledRules: getListEnv("VALIDATION_DISABLED_RULES"),
+
+		DecodeStrict:  getBoolEnv("DECODE_STRICT", true),
+		MaxBodyBytes:  int64(getIntEnv("MAX_BODY_BYTES", 1<<20)),
+		MaxOrderItems: getIntEnv("MAX_ORDER_ITEMS", 100),
+
+		KafkaSchemaValidation: getBoolEnv("KAFKA_SCHEMA_VALIDATION", false),
+
+		StreamPollInterval: getDurationEnv("STREAM_POLL_INTERVAL", 500*time.Millisecond),
+
+		WebhookPollInterval: getDurationEnv("WEBHOOK_POLL_INTERVAL", time.Second),
+		WebhookTimeout:      getDurationEnv("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookMaxAttempts:  getIntEnv("WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookDisableAfter: getIntEnv("WEBHOOK_DISABLE_AFTER", 20),
+		WebhookAllowPrivate: getBoolEnv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", false),
+
+		OutboxPollInterval: getDurationEnv("OUTBOX_POLL_INTERVAL", 500*time.Millisecond),
 	}
 }
 
@@ -70,3 +128,31 @@ func getIntEnv(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getBoolEnv(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+func getListEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
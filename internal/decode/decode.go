@@ -0,0 +1,214 @@
+// Package decode reads JSON request bodies and Kafka messages with the same
+// limits and reports failures in the same shape.
+package decode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"myapp/internal/model"
+	"net/http"
+	"strings"
+)
+
+const (
+	DefaultMaxBytes = 1 << 20
+	DefaultMaxItems = 100
+)
+
+// Rules reported in Error.Rule.
+const (
+	RuleEmpty        = "empty"
+	RuleSyntax       = "syntax"
+	RuleType         = "type"
+	RuleUnknownField = "unknown_field"
+	RuleTrailingData = "trailing_data"
+	RuleBodySize     = "max_bytes"
+	RuleMaxItems     = "max_items"
+)
+
+// Error describes why a payload was rejected. Field is the JSON path of the
+// offending value when one is known.
+type Error struct {
+	Rule    string
+	Field   string
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("invalid JSON: %s: %s", e.Field, e.Message)
+	}
+	return "invalid JSON: " + e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// IsDecodeError reports whether err is, or wraps, a rejected payload.
+func IsDecodeError(err error) bool {
+	var decodeErr *Error
+	return errors.As(err, &decodeErr)
+}
+
+// Decoder holds the decoding limits shared by HTTP handlers and the Kafka
+// consumer.
+type Decoder struct {
+	strict   bool
+	maxBytes int64
+	maxItems int
+}
+
+type Option func(*Decoder)
+
+// WithStrict rejects fields the target type does not declare.
+func WithStrict(strict bool) Option {
+	return func(d *Decoder) {
+		d.strict = strict
+	}
+}
+
+// WithMaxBytes caps the payload size. Zero or less keeps the default.
+func WithMaxBytes(n int64) Option {
+	return func(d *Decoder) {
+		if n > 0 {
+			d.maxBytes = n
+		}
+	}
+}
+
+// WithMaxItems caps the number of items in an order. Zero or less keeps the
+// default.
+func WithMaxItems(n int) Option {
+	return func(d *Decoder) {
+		if n > 0 {
+			d.maxItems = n
+		}
+	}
+}
+
+func New(opts ...Option) *Decoder {
+	d := &Decoder{
+		strict:   true,
+		maxBytes: DefaultMaxBytes,
+		maxItems: DefaultMaxItems,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+func (d *Decoder) Strict() bool    { return d.strict }
+func (d *Decoder) MaxBytes() int64 { return d.maxBytes }
+func (d *Decoder) MaxItems() int   { return d.maxItems }
+
+// DecodeRequest decodes the request body into v, refusing bodies over the size
+// limit before reading them in full.
+func (d *Decoder) DecodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	return d.decode(http.MaxBytesReader(w, r.Body, d.maxBytes), v)
+}
+
+// ReadRequest reads a raw body, such as a patch, under the same size limit.
+func (d *Decoder) ReadRequest(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, d.maxBytes))
+	if err != nil {
+		return nil, d.translate(err)
+	}
+	return data, nil
+}
+
+// Decode decodes a complete payload, such as a Kafka message value, into v.
+func (d *Decoder) Decode(data []byte, v interface{}) error {
+	if int64(len(data)) > d.maxBytes {
+		return d.tooLarge(nil)
+	}
+	return d.decode(bytes.NewReader(data), v)
+}
+
+func (d *Decoder) decode(r io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(r)
+	if d.strict {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(v); err != nil {
+		return d.translate(err)
+	}
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		if err != nil && isSizeError(err) {
+			return d.tooLarge(err)
+		}
+		return &Error{Rule: RuleTrailingData, Message: "unexpected data after the JSON value", Err: err}
+	}
+	return d.CheckItems(v)
+}
+
+// CheckItems rejects an order or item list with more items than allowed, for
+// orders that grow other than by decoding, such as a patch or a new item.
+func (d *Decoder) CheckItems(v interface{}) error {
+	var items int
+	switch t := v.(type) {
+	case *model.Order:
+		items = len(t.Items)
+	case *[]model.Item:
+		items = len(*t)
+	}
+	if items > d.maxItems {
+		return &Error{
+			Rule:    RuleMaxItems,
+			Field:   "items",
+			Message: fmt.Sprintf("must contain at most %d items, got %d", d.maxItems, items),
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) translate(err error) error {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case isSizeError(err):
+		return d.tooLarge(err)
+	case errors.Is(err, io.EOF):
+		return &Error{Rule: RuleEmpty, Message: "body is empty", Err: err}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &Error{Rule: RuleSyntax, Message: "body is truncated", Err: err}
+	case errors.As(err, &syntaxErr):
+		return &Error{Rule: RuleSyntax, Message: fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset), Err: err}
+	case errors.As(err, &typeErr):
+		return &Error{Rule: RuleType, Field: typeErr.Field, Message: "must be a JSON " + jsonTypeName(typeErr.Type.Kind().String()), Err: err}
+	}
+	// encoding/json has no error type for unknown fields.
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return &Error{Rule: RuleUnknownField, Field: strings.Trim(name, `"`), Message: "is not a known field", Err: err}
+	}
+	return &Error{Rule: RuleSyntax, Message: err.Error(), Err: err}
+}
+
+func (d *Decoder) tooLarge(err error) error {
+	return &Error{Rule: RuleBodySize, Message: fmt.Sprintf("must not exceed %d bytes", d.maxBytes), Err: err}
+}
+
+func isSizeError(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+func jsonTypeName(kind string) string {
+	switch kind {
+	case "string":
+		return "string"
+	case "bool":
+		return "boolean"
+	case "slice", "array":
+		return "array"
+	case "struct", "map", "ptr":
+		return "object"
+	default:
+		return "number"
+	}
+}
@@ -0,0 +1,63 @@
+package decode
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"myapp/internal/model"
+)
+
+func TestDecode_ReportsRule(t *testing.T) {
+	items := `{"items":[` + strings.TrimSuffix(strings.Repeat(`{"rid":"r"},`, 3), ",") + `]}`
+
+	for _, tc := range []struct {
+		name      string
+		decoder   *Decoder
+		data      string
+		wantRule  string
+		wantField string
+	}{
+		{name: "unknown field", decoder: New(), data: `{"order_uid":"u","trak_number":"t"}`, wantRule: RuleUnknownField, wantField: "trak_number"},
+		{name: "wrong type", decoder: New(), data: `{"payment":{"amount":"ten"}}`, wantRule: RuleType, wantField: "payment.amount"},
+		{name: "trailing data", decoder: New(), data: `{"order_uid":"u"} {}`, wantRule: RuleTrailingData},
+		{name: "empty", decoder: New(), data: ``, wantRule: RuleEmpty},
+		{name: "too large", decoder: New(WithMaxBytes(8)), data: `{"order_uid":"u"}`, wantRule: RuleBodySize},
+		{name: "too many items", decoder: New(WithMaxItems(2)), data: items, wantRule: RuleMaxItems, wantField: "items"},
+	} {
+		var order model.Order
+		err := tc.decoder.Decode([]byte(tc.data), &order)
+
+		var decodeErr *Error
+		if !errors.As(err, &decodeErr) {
+			t.Fatalf("%s: expected *Error, got %v", tc.name, err)
+		}
+		if decodeErr.Rule != tc.wantRule || decodeErr.Field != tc.wantField {
+			t.Fatalf("%s: expected %s on %q, got %+v", tc.name, tc.wantRule, tc.wantField, decodeErr)
+		}
+	}
+}
+
+func TestDecode_LenientModeAllowsUnknownFields(t *testing.T) {
+	var order model.Order
+	if err := New(WithStrict(false)).Decode([]byte(`{"order_uid":"u","extra":1}`), &order); err != nil {
+		t.Fatalf("expected unknown field to be ignored, got %v", err)
+	}
+	if order.OrderUID != "u" {
+		t.Fatalf("unexpected order: %+v", order)
+	}
+}
+
+func TestDecodeRequest_LimitsBody(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"order_uid":"`+strings.Repeat("u", 64)+`"}`))
+
+	var order model.Order
+	err := New(WithMaxBytes(32)).DecodeRequest(httptest.NewRecorder(), req, &order)
+
+	var decodeErr *Error
+	if !errors.As(err, &decodeErr) || decodeErr.Rule != RuleBodySize {
+		t.Fatalf("expected %s error, got %v", RuleBodySize, err)
+	}
+}
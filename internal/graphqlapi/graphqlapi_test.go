@@ -0,0 +1,193 @@
+package graphqlapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"myapp/internal/model"
+	"myapp/internal/service"
+	"myapp/internal/validation"
+)
+
+// fakeService implements the calls the resolvers make; the embedded
+// interface panics on anything else.
+type fakeService struct {
+	service.Service
+	orders  []*model.Order
+	created *model.Order
+	actor   model.Actor
+	err     error
+
+	mu         sync.Mutex
+	partsCalls map[model.OrderParts]int
+}
+
+func (f *fakeService) GetOrderByUID(ctx context.Context, orderUID string, includeDeleted bool) (*model.Order, error) {
+	for _, order := range f.orders {
+		if order.OrderUID == orderUID {
+			return order, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to get order: %w", service.ErrNotFound)
+}
+
+func (f *fakeService) GetOrderHeaders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, error) {
+	var headers []*model.Order
+	for _, order := range f.orders {
+		headers = append(headers, &model.Order{OrderUID: order.OrderUID, Status: order.Status})
+	}
+	return headers, nil
+}
+
+func (f *fakeService) GetOrderParts(ctx context.Context, orderUIDs []string, parts model.OrderParts) (map[string]*model.Order, error) {
+	f.mu.Lock()
+	f.partsCalls[parts]++
+	f.mu.Unlock()
+
+	result := make(map[string]*model.Order, len(orderUIDs))
+	for _, order := range f.orders {
+		result[order.OrderUID] = order
+	}
+	return result, nil
+}
+
+func (f *fakeService) CreateOrder(ctx context.Context, order *model.Order) error {
+	f.created = order
+	f.actor = model.ActorFromContext(ctx)
+	return f.err
+}
+
+func testOrder(uid, city string) *model.Order {
+	return &model.Order{
+		OrderUID: uid,
+		Status:   model.StatusCreated,
+		Delivery: model.Delivery{City: city},
+		Payment:  model.Payment{Amount: 10, PaymentDT: 1700000000000},
+		Items:    []model.Item{{RID: uid + "-1"}, {RID: uid + "-2"}},
+	}
+}
+
+type response struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string `json:"message"`
+		Extensions struct {
+			Code       string                 `json:"code"`
+			Violations []validation.Violation `json:"violations"`
+		} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func execute(t *testing.T, svc service.Service, query string, variables map[string]interface{}) (int, response) {
+	t.Helper()
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	req.Header.Set("X-Client-ID", "test-client")
+	rec := httptest.NewRecorder()
+	NewHandler(svc).ServeHTTP(rec, req)
+
+	var resp response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, resp
+}
+
+func TestOrders_BatchesNestedFields(t *testing.T) {
+	svc := &fakeService{
+		orders:     []*model.Order{testOrder("uid1", "Moscow"), testOrder("uid2", "Kazan"), testOrder("uid3", "Omsk")},
+		partsCalls: map[model.OrderParts]int{},
+	}
+
+	status, resp := execute(t, svc, `{
+		orders(limit: 10) {
+			orderUid
+			delivery { city }
+			payment { paymentDt }
+			items { rid }
+		}
+	}`, nil)
+	if status != http.StatusOK || len(resp.Errors) > 0 {
+		t.Fatalf("unexpected response %d: %+v", status, resp.Errors)
+	}
+
+	var data struct {
+		Orders []struct {
+			OrderUID string `json:"orderUid"`
+			Delivery struct{ City string }
+			Payment  struct{ PaymentDt int64 }
+			Items    []struct{ RID string }
+		}
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		t.Fatalf("decode data: %v", err)
+	}
+	if len(data.Orders) != 3 || data.Orders[1].Delivery.City != "Kazan" || len(data.Orders[2].Items) != 2 {
+		t.Fatalf("unexpected orders: %+v", data.Orders)
+	}
+	if data.Orders[0].Payment.PaymentDt != 1700000000000 {
+		t.Fatalf("expected 64-bit paymentDt, got %d", data.Orders[0].Payment.PaymentDt)
+	}
+	for _, part := range []model.OrderParts{model.PartDelivery, model.PartPayment, model.PartItems} {
+		if svc.partsCalls[part] != 1 {
+			t.Fatalf("expected one batched load per part, got %v", svc.partsCalls)
+		}
+	}
+}
+
+func TestOrder_MissingIsNull(t *testing.T) {
+	svc := &fakeService{orders: []*model.Order{testOrder("uid1", "Moscow")}}
+
+	_, resp := execute(t, svc, `query($uid: String!) { order(uid: $uid) { delivery { city } } }`,
+		map[string]interface{}{"uid": "missing"})
+	if len(resp.Errors) > 0 || string(resp.Data) != `{"order":null}` {
+		t.Fatalf("expected null order, got %s %+v", resp.Data, resp.Errors)
+	}
+}
+
+func TestCreateOrder_ReportsViolations(t *testing.T) {
+	svc := &fakeService{err: fmt.Errorf("order validation failed: %w", &validation.ViolationsError{
+		Violations: []validation.Violation{{Rule: "required", Field: "delivery.phone", Message: "is required"}},
+	})}
+
+	status, resp := execute(t, svc, `mutation($order: OrderInput!) {
+		createOrder(order: $order, idempotencyKey: "key-1") { orderUid }
+	}`, map[string]interface{}{"order": map[string]interface{}{
+		"orderUid": "uid1",
+		"delivery": map[string]interface{}{"city": "Moscow"},
+		"payment":  map[string]interface{}{"paymentDt": 1700000000000},
+		"items":    []interface{}{map[string]interface{}{"rid": "rid1", "price": 10}},
+	}})
+	if status != http.StatusOK || len(resp.Errors) != 1 {
+		t.Fatalf("expected one error, got %d: %+v", status, resp.Errors)
+	}
+	ext := resp.Errors[0].Extensions
+	if ext.Code != codeValidationFailed || len(ext.Violations) != 1 || ext.Violations[0].Field != "delivery.phone" {
+		t.Fatalf("unexpected extensions: %+v", ext)
+	}
+	if svc.created.Payment.PaymentDT != 1700000000000 || svc.created.Items[0].Price != 10 {
+		t.Fatalf("unexpected converted order: %+v", svc.created)
+	}
+	if svc.actor.Type != model.ActorGraphQL || svc.actor.Client != "test-client" {
+		t.Fatalf("unexpected actor: %+v", svc.actor)
+	}
+}
+
+func TestHandler_RejectsMalformedRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query": 1}`))
+	rec := httptest.NewRecorder()
+	NewHandler(&fakeService{}).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), codeBadRequest) {
+		t.Fatalf("expected 400 with %s, got %d %s", codeBadRequest, rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,163 @@
+// Package graphqlapi serves orders over GraphQL at /graphql.
+package graphqlapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"log"
+	"myapp/internal/decode"
+	"myapp/internal/model"
+	"myapp/internal/service"
+	"myapp/internal/validation"
+	"net/http"
+
+	"github.com/graph-gophers/graphql-go"
+)
+
+//go:embed schema.graphql
+var schemaSDL string
+
+// maxDepth bounds query nesting; the deepest useful query is
+// orders → items → field.
+const maxDepth = 8
+
+// Error codes reported in extensions.code.
+const (
+	codeBadRequest       = "BAD_REQUEST"
+	codeBadUserInput     = "BAD_USER_INPUT"
+	codeValidationFailed = "VALIDATION_FAILED"
+	codeNotFound         = "NOT_FOUND"
+	codeAlreadyExists    = "ALREADY_EXISTS"
+	codeVersionConflict  = "VERSION_CONFLICT"
+	codeInternal         = "INTERNAL"
+)
+
+type Handler struct {
+	schema  *graphql.Schema
+	decoder *decode.Decoder
+}
+
+type Option func(*Handler)
+
+// WithDecoder sets the limits applied to request bodies and order inputs.
+func WithDecoder(decoder *decode.Decoder) Option {
+	return func(h *Handler) {
+		h.decoder = decoder
+	}
+}
+
+func NewHandler(service service.Service, opts ...Option) *Handler {
+	h := &Handler{decoder: decode.New()}
+	for _, opt := range opts {
+		opt(h)
+	}
+	resolver := &Resolver{service: service, maxItems: h.decoder.MaxItems()}
+	h.schema = graphql.MustParseSchema(schemaSDL, resolver, graphql.MaxDepth(maxDepth))
+	return h
+}
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    map[string]interface{} `json:"extensions"`
+}
+
+// ServeHTTP executes a POSTed GraphQL request. Execution errors are returned
+// with 200 as the spec requires; only unreadable requests get 4xx.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeErrors(w, http.StatusMethodNotAllowed, &gqlError{message: "GraphQL requests must use POST", code: codeBadRequest})
+		return
+	}
+
+	var req request
+	if err := h.decoder.DecodeRequest(w, r, &req); err != nil {
+		status := http.StatusBadRequest
+		var decodeErr *decode.Error
+		if errors.As(err, &decodeErr) && decodeErr.Rule == decode.RuleBodySize {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeErrors(w, status, &gqlError{message: err.Error(), code: codeBadRequest})
+		return
+	}
+	if req.Query == "" {
+		writeErrors(w, http.StatusBadRequest, &gqlError{message: "query is required", code: codeBadRequest})
+		return
+	}
+
+	client := r.Header.Get("X-Client-ID")
+	if client == "" {
+		client = r.UserAgent()
+	}
+	ctx := model.WithActor(r.Context(), model.Actor{
+		Type:       model.ActorGraphQL,
+		Client:     client,
+		RemoteAddr: r.RemoteAddr,
+	})
+
+	response := h.schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding GraphQL response: %v", err)
+	}
+}
+
+func writeErrors(w http.ResponseWriter, status int, errs ...*gqlError) {
+	body := struct {
+		Errors []map[string]interface{} `json:"errors"`
+	}{}
+	for _, err := range errs {
+		body.Errors = append(body.Errors, map[string]interface{}{
+			"message":    err.message,
+			"extensions": err.Extensions(),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Error encoding GraphQL errors: %v", err)
+	}
+}
+
+// gqlError is a resolver error whose code and field violations end up in
+// the error's extensions.
+type gqlError struct {
+	message    string
+	code       string
+	violations []validation.Violation
+}
+
+func (e *gqlError) Error() string { return e.message }
+
+func (e *gqlError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": e.code}
+	if len(e.violations) > 0 {
+		extensions["violations"] = e.violations
+	}
+	return extensions
+}
+
+// resolverError maps service errors onto error codes the way the REST
+// handlers map them onto status codes.
+func resolverError(err error) error {
+	switch {
+	case validation.IsValidationError(err):
+		return &gqlError{message: "order validation failed", code: codeValidationFailed, violations: validation.Violations(err)}
+	case errors.Is(err, service.ErrNotFound):
+		return &gqlError{message: "order not found", code: codeNotFound}
+	case errors.Is(err, service.ErrAlreadyExists):
+		return &gqlError{message: "order already exists", code: codeAlreadyExists}
+	case errors.Is(err, service.ErrDuplicateTransaction):
+		return &gqlError{message: "payment transaction is already recorded for another order", code: codeAlreadyExists}
+	case errors.Is(err, service.ErrIdempotencyMismatch):
+		return &gqlError{message: "idempotency key was already used with a different request", code: codeBadUserInput}
+	case errors.Is(err, service.ErrVersionConflict):
+		return &gqlError{message: "order was modified concurrently", code: codeVersionConflict}
+	default:
+		log.Printf("GraphQL resolver error: %v", err)
+		return &gqlError{message: "internal error", code: codeInternal}
+	}
+}
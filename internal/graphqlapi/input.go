@@ -0,0 +1,117 @@
+package graphqlapi
+
+import (
+	"myapp/internal/model"
+
+	"github.com/graph-gophers/graphql-go"
+)
+
+type orderInput struct {
+	OrderUID          string
+	TrackNumber       string
+	Entry             string
+	Delivery          deliveryInput
+	Payment           paymentInput
+	Items             []itemInput
+	Locale            string
+	InternalSignature string
+	CustomerID        string
+	DeliveryService   string
+	ShardKey          string
+	SMID              int32
+	DateCreated       *graphql.Time
+	OOFShard          string
+}
+
+type deliveryInput struct {
+	Name    string
+	Phone   string
+	Zip     string
+	City    string
+	Address string
+	Region  string
+	Email   string
+}
+
+type paymentInput struct {
+	Transaction  string
+	RequestID    string
+	Currency     string
+	Provider     string
+	Amount       int32
+	PaymentDT    Long
+	Bank         string
+	DeliveryCost int32
+	GoodsTotal   int32
+	CustomFee    int32
+}
+
+type itemInput struct {
+	ChrtID      int32
+	TrackNumber string
+	Price       int32
+	RID         string
+	Name        string
+	Sale        int32
+	Size        string
+	TotalPrice  int32
+	NMID        int32
+	Brand       string
+	Status      int32
+}
+
+func (in orderInput) toModel() *model.Order {
+	order := &model.Order{
+		OrderUID:          in.OrderUID,
+		TrackNumber:       in.TrackNumber,
+		Entry:             in.Entry,
+		Delivery:          model.Delivery(in.Delivery),
+		Payment:           in.Payment.toModel(),
+		Items:             make([]model.Item, len(in.Items)),
+		Locale:            in.Locale,
+		InternalSignature: in.InternalSignature,
+		CustomerID:        in.CustomerID,
+		DeliveryService:   in.DeliveryService,
+		ShardKey:          in.ShardKey,
+		SMID:              int(in.SMID),
+		OOFShard:          in.OOFShard,
+	}
+	if in.DateCreated != nil {
+		order.DateCreated = in.DateCreated.Time
+	}
+	for i, item := range in.Items {
+		order.Items[i] = item.toModel()
+	}
+	return order
+}
+
+func (in paymentInput) toModel() model.Payment {
+	return model.Payment{
+		Transaction:  in.Transaction,
+		RequestID:    in.RequestID,
+		Currency:     in.Currency,
+		Provider:     in.Provider,
+		Amount:       int(in.Amount),
+		PaymentDT:    int64(in.PaymentDT),
+		Bank:         in.Bank,
+		DeliveryCost: int(in.DeliveryCost),
+		GoodsTotal:   int(in.GoodsTotal),
+		CustomFee:    int(in.CustomFee),
+	}
+}
+
+func (in itemInput) toModel() model.Item {
+	return model.Item{
+		ChrtID:      int(in.ChrtID),
+		TrackNumber: in.TrackNumber,
+		Price:       int(in.Price),
+		RID:         in.RID,
+		Name:        in.Name,
+		Sale:        int(in.Sale),
+		Size:        in.Size,
+		TotalPrice:  int(in.TotalPrice),
+		NMID:        int(in.NMID),
+		Brand:       in.Brand,
+		Status:      int(in.Status),
+	}
+}
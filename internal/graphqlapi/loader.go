@@ -0,0 +1,47 @@
+package graphqlapi
+
+import (
+	"context"
+	"myapp/internal/model"
+	"myapp/internal/service"
+	"sync"
+)
+
+// partsLoader batches the nested fields of one orders page. The first
+// resolver asking for a part loads it for every order on the page; the
+// others wait for that result instead of querying per order.
+type partsLoader struct {
+	service service.Service
+	uids    []string
+	batches map[model.OrderParts]*partBatch
+}
+
+type partBatch struct {
+	once   sync.Once
+	orders map[string]*model.Order
+	err    error
+}
+
+func newPartsLoader(svc service.Service, orders []*model.Order) *partsLoader {
+	uids := make([]string, len(orders))
+	for i, order := range orders {
+		uids[i] = order.OrderUID
+	}
+	return &partsLoader{
+		service: svc,
+		uids:    uids,
+		batches: map[model.OrderParts]*partBatch{
+			model.PartDelivery: {},
+			model.PartPayment:  {},
+			model.PartItems:    {},
+		},
+	}
+}
+
+func (l *partsLoader) load(ctx context.Context, part model.OrderParts) (map[string]*model.Order, error) {
+	batch := l.batches[part]
+	batch.once.Do(func() {
+		batch.orders, batch.err = l.service.GetOrderParts(ctx, l.uids, part)
+	})
+	return batch.orders, batch.err
+}
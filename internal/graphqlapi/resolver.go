@@ -0,0 +1,258 @@
+package graphqlapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myapp/internal/decode"
+	"myapp/internal/model"
+	"myapp/internal/service"
+	"myapp/internal/validation"
+
+	"github.com/graph-gophers/graphql-go"
+)
+
+// maxLimit caps the page size of the orders query.
+const maxLimit = 500
+
+// Resolver is the root resolver for schema.graphql.
+type Resolver struct {
+	service  service.Service
+	maxItems int
+}
+
+func (r *Resolver) Order(ctx context.Context, args struct {
+	UID            string
+	IncludeDeleted bool
+}) (*orderResolver, error) {
+	order, err := r.service.GetOrderByUID(ctx, args.UID, args.IncludeDeleted)
+	if err != nil {
+		if errors.Is(err, service.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, resolverError(err)
+	}
+	return &orderResolver{order: order}, nil
+}
+
+type orderFilterInput struct {
+	Status          string
+	CustomerID      string
+	DeliveryService string
+	CreatedAfter    *graphql.Time
+	CreatedBefore   *graphql.Time
+	IncludeDeleted  bool
+}
+
+// Orders lists order headers in one query. Nested delivery, payment and
+// items are fetched per part for the whole page by a shared partsLoader.
+func (r *Resolver) Orders(ctx context.Context, args struct {
+	Filter *orderFilterInput
+	Limit  int32
+	Offset int32
+}) ([]*orderResolver, error) {
+	if args.Limit < 1 || args.Limit > maxLimit {
+		return nil, &gqlError{message: fmt.Sprintf("limit must be between 1 and %d", maxLimit), code: codeBadUserInput}
+	}
+	if args.Offset < 0 {
+		return nil, &gqlError{message: "offset must not be negative", code: codeBadUserInput}
+	}
+
+	filter := model.OrderFilter{Limit: int(args.Limit), Offset: int(args.Offset)}
+	if f := args.Filter; f != nil {
+		filter.Status = model.OrderStatus(f.Status)
+		filter.CustomerID = f.CustomerID
+		filter.DeliveryService = f.DeliveryService
+		filter.IncludeDeleted = f.IncludeDeleted
+		if f.CreatedAfter != nil {
+			filter.CreatedAfter = f.CreatedAfter.Time
+		}
+		if f.CreatedBefore != nil {
+			filter.CreatedBefore = f.CreatedBefore.Time
+		}
+	}
+
+	orders, err := r.service.GetOrderHeaders(ctx, filter)
+	if err != nil {
+		return nil, resolverError(err)
+	}
+
+	loader := newPartsLoader(r.service, orders)
+	resolvers := make([]*orderResolver, len(orders))
+	for i, order := range orders {
+		resolvers[i] = &orderResolver{order: order, loader: loader}
+	}
+	return resolvers, nil
+}
+
+func (r *Resolver) CreateOrder(ctx context.Context, args struct {
+	Order          orderInput
+	IdempotencyKey *string
+}) (*orderResolver, error) {
+	if args.IdempotencyKey != nil && *args.IdempotencyKey != "" {
+		ctx = model.WithIdempotencyKey(ctx, model.HTTPIdempotencyKey(*args.IdempotencyKey))
+	}
+
+	order, err := r.inputOrder(args.Order)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.service.CreateOrder(ctx, order); err != nil && !errors.Is(err, service.ErrDuplicateMessage) {
+		return nil, resolverError(err)
+	}
+	return &orderResolver{order: order}, nil
+}
+
+func (r *Resolver) UpdateOrder(ctx context.Context, args struct {
+	UID             string
+	Order           orderInput
+	ExpectedVersion *Long
+}) (*orderResolver, error) {
+	order, err := r.inputOrder(args.Order)
+	if err != nil {
+		return nil, err
+	}
+	order.OrderUID = args.UID
+	if args.ExpectedVersion != nil {
+		order.Version = int64(*args.ExpectedVersion)
+	}
+	if err := r.service.UpdateOrder(ctx, order); err != nil {
+		return nil, resolverError(err)
+	}
+	return &orderResolver{order: order}, nil
+}
+
+// inputOrder converts a mutation input, enforcing the item limit the REST
+// and Kafka decoders apply.
+func (r *Resolver) inputOrder(in orderInput) (*model.Order, error) {
+	if r.maxItems > 0 && len(in.Items) > r.maxItems {
+		return nil, &gqlError{
+			message: "order validation failed",
+			code:    codeValidationFailed,
+			violations: []validation.Violation{{
+				Rule:    decode.RuleMaxItems,
+				Field:   "items",
+				Message: fmt.Sprintf("must contain at most %d items", r.maxItems),
+			}},
+		}
+	}
+	return in.toModel(), nil
+}
+
+func (r *Resolver) DeleteOrder(ctx context.Context, args struct{ UID string }) (bool, error) {
+	if err := r.service.DeleteOrder(ctx, args.UID); err != nil {
+		return false, resolverError(err)
+	}
+	return true, nil
+}
+
+// orderResolver resolves an Order. Orders from a list carry only their
+// header and load the rest through loader; single orders are complete.
+type orderResolver struct {
+	order  *model.Order
+	loader *partsLoader
+}
+
+func (r *orderResolver) part(ctx context.Context, part model.OrderParts) (*model.Order, error) {
+	if r.loader == nil {
+		return r.order, nil
+	}
+	orders, err := r.loader.load(ctx, part)
+	if err != nil {
+		return nil, resolverError(err)
+	}
+	order, ok := orders[r.order.OrderUID]
+	if !ok {
+		return nil, resolverError(fmt.Errorf("order %s: %w", r.order.OrderUID, service.ErrNotFound))
+	}
+	return order, nil
+}
+
+func (r *orderResolver) OrderUID() string          { return r.order.OrderUID }
+func (r *orderResolver) TrackNumber() string       { return r.order.TrackNumber }
+func (r *orderResolver) Entry() string             { return r.order.Entry }
+func (r *orderResolver) Locale() string            { return r.order.Locale }
+func (r *orderResolver) InternalSignature() string { return r.order.InternalSignature }
+func (r *orderResolver) CustomerID() string        { return r.order.CustomerID }
+func (r *orderResolver) DeliveryService() string   { return r.order.DeliveryService }
+func (r *orderResolver) ShardKey() string          { return r.order.ShardKey }
+func (r *orderResolver) SMID() int32               { return int32(r.order.SMID) }
+func (r *orderResolver) OOFShard() string          { return r.order.OOFShard }
+func (r *orderResolver) Status() string            { return string(r.order.Status) }
+func (r *orderResolver) Version() Long             { return Long(r.order.Version) }
+
+func (r *orderResolver) DateCreated() graphql.Time {
+	return graphql.Time{Time: r.order.DateCreated}
+}
+
+func (r *orderResolver) DeletedAt() *graphql.Time {
+	if r.order.DeletedAt == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *r.order.DeletedAt}
+}
+
+func (r *orderResolver) Delivery(ctx context.Context) (*deliveryResolver, error) {
+	order, err := r.part(ctx, model.PartDelivery)
+	if err != nil {
+		return nil, err
+	}
+	return &deliveryResolver{order.Delivery}, nil
+}
+
+func (r *orderResolver) Payment(ctx context.Context) (*paymentResolver, error) {
+	order, err := r.part(ctx, model.PartPayment)
+	if err != nil {
+		return nil, err
+	}
+	return &paymentResolver{order.Payment}, nil
+}
+
+func (r *orderResolver) Items(ctx context.Context) ([]*itemResolver, error) {
+	order, err := r.part(ctx, model.PartItems)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*itemResolver, len(order.Items))
+	for i, item := range order.Items {
+		items[i] = &itemResolver{item}
+	}
+	return items, nil
+}
+
+type deliveryResolver struct{ d model.Delivery }
+
+func (r *deliveryResolver) Name() string    { return r.d.Name }
+func (r *deliveryResolver) Phone() string   { return r.d.Phone }
+func (r *deliveryResolver) Zip() string     { return r.d.Zip }
+func (r *deliveryResolver) City() string    { return r.d.City }
+func (r *deliveryResolver) Address() string { return r.d.Address }
+func (r *deliveryResolver) Region() string  { return r.d.Region }
+func (r *deliveryResolver) Email() string   { return r.d.Email }
+
+type paymentResolver struct{ p model.Payment }
+
+func (r *paymentResolver) Transaction() string { return r.p.Transaction }
+func (r *paymentResolver) RequestID() string   { return r.p.RequestID }
+func (r *paymentResolver) Currency() string    { return r.p.Currency }
+func (r *paymentResolver) Provider() string    { return r.p.Provider }
+func (r *paymentResolver) Amount() int32       { return int32(r.p.Amount) }
+func (r *paymentResolver) PaymentDT() Long     { return Long(r.p.PaymentDT) }
+func (r *paymentResolver) Bank() string        { return r.p.Bank }
+func (r *paymentResolver) DeliveryCost() int32 { return int32(r.p.DeliveryCost) }
+func (r *paymentResolver) GoodsTotal() int32   { return int32(r.p.GoodsTotal) }
+func (r *paymentResolver) CustomFee() int32    { return int32(r.p.CustomFee) }
+
+type itemResolver struct{ i model.Item }
+
+func (r *itemResolver) ChrtID() int32       { return int32(r.i.ChrtID) }
+func (r *itemResolver) TrackNumber() string { return r.i.TrackNumber }
+func (r *itemResolver) Price() int32        { return int32(r.i.Price) }
+func (r *itemResolver) RID() string         { return r.i.RID }
+func (r *itemResolver) Name() string        { return r.i.Name }
+func (r *itemResolver) Sale() int32         { return int32(r.i.Sale) }
+func (r *itemResolver) Size() string        { return r.i.Size }
+func (r *itemResolver) TotalPrice() int32   { return int32(r.i.TotalPrice) }
+func (r *itemResolver) NMID() int32         { return int32(r.i.NMID) }
+func (r *itemResolver) Brand() string       { return r.i.Brand }
+func (r *itemResolver) Status() int32       { return int32(r.i.Status) }
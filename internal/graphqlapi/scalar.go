@@ -0,0 +1,42 @@
+package graphqlapi
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Long is the 64-bit integer scalar used for versions and payment
+// timestamps, which overflow GraphQL's 32-bit Int.
+type Long int64
+
+func (Long) ImplementsGraphQLType(name string) bool { return name == "Long" }
+
+func (l *Long) UnmarshalGraphQL(input interface{}) error {
+	switch v := input.(type) {
+	case int32:
+		*l = Long(v)
+	case int:
+		*l = Long(v)
+	case int64:
+		*l = Long(v)
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v > math.MaxInt64 {
+			return fmt.Errorf("not a 64-bit integer: %v", v)
+		}
+		*l = Long(v)
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("not a 64-bit integer: %q", v)
+		}
+		*l = Long(n)
+	default:
+		return fmt.Errorf("wrong type for Long: %T", input)
+	}
+	return nil
+}
+
+func (l Long) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, int64(l), 10), nil
+}
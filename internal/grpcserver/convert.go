@@ -0,0 +1,169 @@
+package grpcserver
+
+import (
+	orderv1 "myapp/api/order/v1"
+	"myapp/internal/cache"
+	"myapp/internal/model"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func toProtoOrder(o *model.Order) *orderv1.Order {
+	order := &orderv1.Order{
+		OrderUid:          o.OrderUID,
+		TrackNumber:       o.TrackNumber,
+		Entry:             o.Entry,
+		Delivery:          toProtoDelivery(o.Delivery),
+		Payment:           toProtoPayment(o.Payment),
+		Items:             make([]*orderv1.Item, len(o.Items)),
+		Locale:            o.Locale,
+		InternalSignature: o.InternalSignature,
+		CustomerId:        o.CustomerID,
+		DeliveryService:   o.DeliveryService,
+		Shardkey:          o.ShardKey,
+		SmId:              int64(o.SMID),
+		DateCreated:       timestamppb.New(o.DateCreated),
+		OofShard:          o.OOFShard,
+		Status:            string(o.Status),
+		Version:           o.Version,
+	}
+	for i, item := range o.Items {
+		order.Items[i] = toProtoItem(item)
+	}
+	if o.DeletedAt != nil {
+		order.DeletedAt = timestamppb.New(*o.DeletedAt)
+	}
+	return order
+}
+
+func toProtoDelivery(d model.Delivery) *orderv1.Delivery {
+	return &orderv1.Delivery{
+		Name:    d.Name,
+		Phone:   d.Phone,
+		Zip:     d.Zip,
+		City:    d.City,
+		Address: d.Address,
+		Region:  d.Region,
+		Email:   d.Email,
+	}
+}
+
+func toProtoPayment(p model.Payment) *orderv1.Payment {
+	return &orderv1.Payment{
+		Transaction:  p.Transaction,
+		RequestId:    p.RequestID,
+		Currency:     p.Currency,
+		Provider:     p.Provider,
+		Amount:       int64(p.Amount),
+		PaymentDt:    p.PaymentDT,
+		Bank:         p.Bank,
+		DeliveryCost: int64(p.DeliveryCost),
+		GoodsTotal:   int64(p.GoodsTotal),
+		CustomFee:    int64(p.CustomFee),
+	}
+}
+
+func toProtoItem(i model.Item) *orderv1.Item {
+	return &orderv1.Item{
+		ChrtId:      int64(i.ChrtID),
+		TrackNumber: i.TrackNumber,
+		Price:       int64(i.Price),
+		Rid:         i.RID,
+		Name:        i.Name,
+		Sale:        int64(i.Sale),
+		Size:        i.Size,
+		TotalPrice:  int64(i.TotalPrice),
+		NmId:        int64(i.NMID),
+		Brand:       i.Brand,
+		Status:      int64(i.Status),
+	}
+}
+
+// fromProtoOrder ignores deleted_at, which clients cannot set.
+func fromProtoOrder(o *orderv1.Order) *model.Order {
+	order := &model.Order{
+		OrderUID:          o.GetOrderUid(),
+		TrackNumber:       o.GetTrackNumber(),
+		Entry:             o.GetEntry(),
+		Delivery:          fromProtoDelivery(o.GetDelivery()),
+		Payment:           fromProtoPayment(o.GetPayment()),
+		Locale:            o.GetLocale(),
+		InternalSignature: o.GetInternalSignature(),
+		CustomerID:        o.GetCustomerId(),
+		DeliveryService:   o.GetDeliveryService(),
+		ShardKey:          o.GetShardkey(),
+		SMID:              int(o.GetSmId()),
+		OOFShard:          o.GetOofShard(),
+		Status:            model.OrderStatus(o.GetStatus()),
+		Version:           o.GetVersion(),
+	}
+	if o.GetDateCreated() != nil {
+		order.DateCreated = o.GetDateCreated().AsTime()
+	}
+	for _, item := range o.GetItems() {
+		order.Items = append(order.Items, fromProtoItem(item))
+	}
+	return order
+}
+
+func fromProtoDelivery(d *orderv1.Delivery) model.Delivery {
+	return model.Delivery{
+		Name:    d.GetName(),
+		Phone:   d.GetPhone(),
+		Zip:     d.GetZip(),
+		City:    d.GetCity(),
+		Address: d.GetAddress(),
+		Region:  d.GetRegion(),
+		Email:   d.GetEmail(),
+	}
+}
+
+func fromProtoPayment(p *orderv1.Payment) model.Payment {
+	return model.Payment{
+		Transaction:  p.GetTransaction(),
+		RequestID:    p.GetRequestId(),
+		Currency:     p.GetCurrency(),
+		Provider:     p.GetProvider(),
+		Amount:       int(p.GetAmount()),
+		PaymentDT:    p.GetPaymentDt(),
+		Bank:         p.GetBank(),
+		DeliveryCost: int(p.GetDeliveryCost()),
+		GoodsTotal:   int(p.GetGoodsTotal()),
+		CustomFee:    int(p.GetCustomFee()),
+	}
+}
+
+func fromProtoItem(i *orderv1.Item) model.Item {
+	return model.Item{
+		ChrtID:      int(i.GetChrtId()),
+		TrackNumber: i.GetTrackNumber(),
+		Price:       int(i.GetPrice()),
+		RID:         i.GetRid(),
+		Name:        i.GetName(),
+		Sale:        int(i.GetSale()),
+		Size:        i.GetSize(),
+		TotalPrice:  int(i.GetTotalPrice()),
+		NMID:        int(i.GetNmId()),
+		Brand:       i.GetBrand(),
+		Status:      int(i.GetStatus()),
+	}
+}
+
+func toProtoCacheStats(s cache.CacheStats) *orderv1.CacheStats {
+	return &orderv1.CacheStats{
+		Size:               int64(s.Size),
+		HitRate:            s.HitRate,
+		MissRate:           s.MissRate,
+		TotalHits:          s.TotalHits,
+		TotalMiss:          s.TotalMiss,
+		TotalSets:          s.TotalSets,
+		TotalDeletes:       s.TotalDeletes,
+		Evictions:          s.Evictions,
+		Warmups:            s.Warmups,
+		LastWarmupOrders:   s.LastWarmupOrders,
+		LastWarmupDuration: durationpb.New(s.LastWarmupDuration),
+		Uptime:             durationpb.New(s.Uptime),
+		SinceReset:         durationpb.New(s.SinceReset),
+	}
+}
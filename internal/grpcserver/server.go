@@ -0,0 +1,227 @@
+// Package grpcserver exposes service.Service over gRPC as order.v1.OrderService.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"log"
+	orderv1 "myapp/api/order/v1"
+	"myapp/internal/decode"
+	"myapp/internal/model"
+	"myapp/internal/service"
+	"myapp/internal/validation"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type Server struct {
+	orderv1.UnimplementedOrderServiceServer
+	service service.Service
+	decoder *decode.Decoder
+}
+
+type Option func(*Server)
+
+// WithDecoder sets the limits applied to incoming orders, so the item limit
+// matches the HTTP and Kafka paths.
+func WithDecoder(decoder *decode.Decoder) Option {
+	return func(s *Server) {
+		s.decoder = decoder
+	}
+}
+
+func NewServer(service service.Service, opts ...Option) *Server {
+	s := &Server{service: service, decoder: decode.New()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// NewGRPCServer registers the order service together with the standard health
+// and reflection services.
+func NewGRPCServer(service service.Service, opts ...Option) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(actorUnaryInterceptor),
+		grpc.StreamInterceptor(actorStreamInterceptor),
+	)
+	orderv1.RegisterOrderServiceServer(server, NewServer(service, opts...))
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(orderv1.OrderService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	reflection.Register(server)
+	return server
+}
+
+func (s *Server) GetOrder(ctx context.Context, req *orderv1.GetOrderRequest) (*orderv1.Order, error) {
+	if req.GetOrderUid() == "" {
+		return nil, status.Error(codes.InvalidArgument, "order_uid is required")
+	}
+
+	order, err := s.service.GetOrderByUID(ctx, req.GetOrderUid(), req.GetIncludeDeleted())
+	if err != nil {
+		return nil, statusError(err, "Error getting order "+req.GetOrderUid())
+	}
+	return toProtoOrder(order), nil
+}
+
+// ListOrders streams orders from the export cursor as they are read, so the
+// table is never held in memory at once.
+func (s *Server) ListOrders(req *orderv1.ListOrdersRequest, stream orderv1.OrderService_ListOrdersServer) error {
+	var sendErr error
+	filter := model.OrderFilter{IncludeDeleted: req.GetIncludeDeleted()}
+	err := s.service.ExportOrders(stream.Context(), filter, func(order *model.Order) error {
+		sendErr = stream.Send(toProtoOrder(order))
+		return sendErr
+	})
+	if sendErr != nil {
+		return sendErr
+	}
+	if err != nil {
+		return statusError(err, "Error listing orders")
+	}
+	return nil
+}
+
+func (s *Server) CreateOrder(ctx context.Context, req *orderv1.CreateOrderRequest) (*orderv1.Order, error) {
+	if req.GetOrder() == nil {
+		return nil, status.Error(codes.InvalidArgument, "order is required")
+	}
+
+	if key := req.GetIdempotencyKey(); key != "" {
+		ctx = model.WithIdempotencyKey(ctx, model.HTTPIdempotencyKey(key))
+	}
+
+	order := fromProtoOrder(req.GetOrder())
+	if err := s.decoder.CheckItems(order); err != nil {
+		return nil, statusError(err, "Error creating order")
+	}
+	if err := s.service.CreateOrder(ctx, order); err != nil {
+		if !errors.Is(err, service.ErrDuplicateMessage) {
+			return nil, statusError(err, "Error creating order")
+		}
+		if err := grpc.SetHeader(ctx, metadata.Pairs("idempotent-replayed", "true")); err != nil {
+			log.Printf("Error setting gRPC header: %v", err)
+		}
+	}
+	return toProtoOrder(order), nil
+}
+
+func (s *Server) UpdateOrder(ctx context.Context, req *orderv1.UpdateOrderRequest) (*orderv1.Order, error) {
+	if req.GetOrder().GetOrderUid() == "" {
+		return nil, status.Error(codes.InvalidArgument, "order.order_uid is required")
+	}
+
+	order := fromProtoOrder(req.GetOrder())
+	order.Version = req.GetExpectedVersion()
+	if err := s.decoder.CheckItems(order); err != nil {
+		return nil, statusError(err, "Error updating order "+order.OrderUID)
+	}
+	if err := s.service.UpdateOrder(ctx, order); err != nil {
+		return nil, statusError(err, "Error updating order "+order.OrderUID)
+	}
+	return toProtoOrder(order), nil
+}
+
+func (s *Server) DeleteOrder(ctx context.Context, req *orderv1.DeleteOrderRequest) (*emptypb.Empty, error) {
+	if req.GetOrderUid() == "" {
+		return nil, status.Error(codes.InvalidArgument, "order_uid is required")
+	}
+
+	if err := s.service.DeleteOrder(ctx, req.GetOrderUid()); err != nil {
+		return nil, statusError(err, "Error deleting order "+req.GetOrderUid())
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) GetCacheStats(ctx context.Context, _ *emptypb.Empty) (*orderv1.CacheStats, error) {
+	return toProtoCacheStats(s.service.GetCacheStats()), nil
+}
+
+// statusError maps service errors onto gRPC codes the way the HTTP handlers
+// map them onto status codes. Validation failures and rejected payloads carry
+// a BadRequest detail with one violation per field.
+func statusError(err error, message string) error {
+	log.Printf("%s: %v", message, err)
+	var decodeErr *decode.Error
+	switch {
+	case validation.IsValidationError(err):
+		return badRequestError(validation.Violations(err))
+	case errors.As(err, &decodeErr):
+		return badRequestError([]validation.Violation{{Rule: decodeErr.Rule, Field: decodeErr.Field, Message: decodeErr.Message}})
+	case errors.Is(err, service.ErrNotFound):
+		return status.Error(codes.NotFound, "order not found")
+	case errors.Is(err, service.ErrAlreadyExists):
+		return status.Error(codes.AlreadyExists, "order already exists")
+	case errors.Is(err, service.ErrDuplicateTransaction):
+		return status.Error(codes.AlreadyExists, "payment transaction is already recorded for another order")
+	case errors.Is(err, service.ErrIdempotencyMismatch):
+		return status.Error(codes.InvalidArgument, "idempotency key was already used with a different request")
+	case errors.Is(err, service.ErrVersionConflict):
+		return status.Error(codes.Aborted, "order was modified concurrently")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+func badRequestError(violations []validation.Violation) error {
+	st := status.New(codes.InvalidArgument, "order validation failed")
+	badRequest := &errdetails.BadRequest{}
+	for _, v := range violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       v.Field,
+			Description: v.Rule + ": " + v.Message,
+		})
+	}
+	if detailed, detailErr := st.WithDetails(badRequest); detailErr == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+func actorUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(withActor(ctx), req)
+}
+
+func actorStreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &actorStream{ServerStream: stream, ctx: withActor(stream.Context())})
+}
+
+type actorStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *actorStream) Context() context.Context { return s.ctx }
+
+// withActor records the caller for the audit log, like the HTTP actor
+// middleware: x-client-id metadata, falling back to the user agent.
+func withActor(ctx context.Context) context.Context {
+	actor := model.Actor{Type: model.ActorGRPC}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-client-id"); len(values) > 0 {
+			actor.Client = values[0]
+		} else if values := md.Get("user-agent"); len(values) > 0 {
+			actor.Client = values[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		actor.RemoteAddr = p.Addr.String()
+	}
+	return model.WithActor(ctx, actor)
+}
@@ -0,0 +1,176 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	orderv1 "myapp/api/order/v1"
+	"myapp/internal/cache"
+	"myapp/internal/decode"
+	"myapp/internal/model"
+	"myapp/internal/service"
+	"myapp/internal/validation"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeService implements the calls the gRPC server makes; the embedded
+// interface panics on anything else.
+type fakeService struct {
+	service.Service
+	orders  map[string]*model.Order
+	created *model.Order
+	actor   model.Actor
+	err     error
+}
+
+func (f *fakeService) GetOrderByUID(ctx context.Context, orderUID string, includeDeleted bool) (*model.Order, error) {
+	if order, ok := f.orders[orderUID]; ok {
+		return order, nil
+	}
+	return nil, fmt.Errorf("failed to get order: %w", service.ErrNotFound)
+}
+
+func (f *fakeService) ExportOrders(ctx context.Context, filter model.OrderFilter, fn func(*model.Order) error) error {
+	for _, order := range f.orders {
+		if err := fn(order); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeService) CreateOrder(ctx context.Context, order *model.Order) error {
+	f.created = order
+	f.actor = model.ActorFromContext(ctx)
+	return f.err
+}
+
+func (f *fakeService) GetCacheStats() cache.CacheStats { return cache.CacheStats{Size: len(f.orders)} }
+
+func dial(t *testing.T, svc service.Service, opts ...Option) *grpc.ClientConn {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := NewGRPCServer(svc, opts...)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestOrderService_GetAndList(t *testing.T) {
+	svc := &fakeService{orders: map[string]*model.Order{
+		"uid1": {OrderUID: "uid1", Items: []model.Item{{RID: "r1", Price: 10}}, Version: 2},
+		"uid2": {OrderUID: "uid2"},
+	}}
+	client := orderv1.NewOrderServiceClient(dial(t, svc))
+	ctx := context.Background()
+
+	order, err := client.GetOrder(ctx, &orderv1.GetOrderRequest{OrderUid: "uid1"})
+	if err != nil {
+		t.Fatalf("GetOrder failed: %v", err)
+	}
+	if order.GetVersion() != 2 || len(order.GetItems()) != 1 || order.GetItems()[0].GetPrice() != 10 {
+		t.Fatalf("unexpected order: %v", order)
+	}
+
+	if _, err := client.GetOrder(ctx, &orderv1.GetOrderRequest{OrderUid: "missing"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+
+	stream, err := client.ListOrders(ctx, &orderv1.ListOrdersRequest{})
+	if err != nil {
+		t.Fatalf("ListOrders failed: %v", err)
+	}
+	received := 0
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("ListOrders stream failed: %v", err)
+		}
+		received++
+	}
+	if received != 2 {
+		t.Fatalf("expected 2 streamed orders, got %d", received)
+	}
+}
+
+func TestOrderService_CreateReportsFieldViolations(t *testing.T) {
+	svc := &fakeService{err: fmt.Errorf("invalid order: %w", validation.New().Validate(&model.Order{}))}
+	client := orderv1.NewOrderServiceClient(dial(t, svc))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-client-id", "billing")
+	_, err := client.CreateOrder(ctx, &orderv1.CreateOrderRequest{Order: &orderv1.Order{OrderUid: "uid1"}})
+
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	var fields []string
+	for _, detail := range st.Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range badRequest.GetFieldViolations() {
+				fields = append(fields, v.GetField())
+			}
+		}
+	}
+	if len(fields) == 0 {
+		t.Fatal("expected field violations in the status details")
+	}
+	if svc.created.OrderUID != "uid1" || svc.actor.Type != model.ActorGRPC || svc.actor.Client != "billing" {
+		t.Fatalf("unexpected call: order %+v, actor %+v", svc.created, svc.actor)
+	}
+}
+
+func TestOrderService_CreateEnforcesMaxItems(t *testing.T) {
+	svc := &fakeService{}
+	client := orderv1.NewOrderServiceClient(dial(t, svc, WithDecoder(decode.New(decode.WithMaxItems(1)))))
+
+	order := &orderv1.Order{OrderUid: "uid1", Items: []*orderv1.Item{{Rid: "r1"}, {Rid: "r2"}}}
+	_, err := client.CreateOrder(context.Background(), &orderv1.CreateOrderRequest{Order: order})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	if svc.created != nil {
+		t.Fatal("order over the item limit reached the service")
+	}
+	var fields []string
+	for _, detail := range status.Convert(err).Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range badRequest.GetFieldViolations() {
+				fields = append(fields, v.GetField())
+			}
+		}
+	}
+	if len(fields) != 1 || fields[0] != "items" {
+		t.Fatalf("expected a violation on items, got %v", fields)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	client := healthpb.NewHealthClient(dial(t, &fakeService{}))
+
+	resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: orderv1.OrderService_ServiceDesc.ServiceName})
+	if err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expected SERVING, got %v, %v", resp, err)
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"myapp/internal/bulk"
+	"myapp/internal/model"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// exportFlushEvery is how many orders are buffered before the export
+// response is flushed to the client.
+const exportFlushEvery = 100
+
+var ndjsonMediaTypes = map[string]bool{
+	"application/x-ndjson": true,
+	"application/jsonl":    true,
+	"application/json":     true,
+}
+
+// ImportOrders creates an order from each line of an NDJSON body. Lines are
+// decoded and validated as they arrive, each with the limits of a single
+// POST /api/v1/orders, and the response streams one bulk.ImportResult per line
+// followed by {"summary": ...}. Failed lines do not stop the import.
+func (h *Handler) ImportOrders(w http.ResponseWriter, r *http.Request) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || !ndjsonMediaTypes[mediaType] {
+			writeProblem(w, http.StatusUnsupportedMediaType, "Import expects application/x-ndjson")
+			return
+		}
+	}
+
+	// Results are written while the body is still being read.
+	rc := http.NewResponseController(w)
+	if err := rc.EnableFullDuplex(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("Error enabling full duplex for import: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+
+	var summary bulk.ImportSummary
+	lines := bulk.NewLineReader(r.Body, int(h.decoder.MaxBytes()))
+	for {
+		n, line, err := lines.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var result bulk.ImportResult
+		switch {
+		case errors.Is(err, bulk.ErrLineTooLong):
+			result = bulk.TooLongResult(n, h.decoder.MaxBytes())
+		case err != nil:
+			log.Printf("Error reading import body: %v", err)
+			return
+		default:
+			result = bulk.ImportLine(r.Context(), h.service, h.decoder, n, line)
+		}
+
+		summary.Add(result.Status)
+		if err := enc.Encode(result); err != nil {
+			log.Printf("Error writing import result: %v", err)
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			log.Printf("Error flushing import result: %v", err)
+			return
+		}
+	}
+
+	log.Printf("Imported orders: %+v", summary)
+	if err := enc.Encode(map[string]bulk.ImportSummary{"summary": summary}); err != nil {
+		log.Printf("Error writing import summary: %v", err)
+	}
+}
+
+// ExportOrders streams matching orders as NDJSON or, with format=csv, as CSV
+// with one row per item. Orders are read from a database cursor and written
+// as they arrive; a failure after the first bytes were sent aborts the
+// connection so the client does not mistake a partial export for a full one.
+func (h *Handler) ExportOrders(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = bulk.FormatNDJSON
+	}
+	filter, err := parseOrderFilter(query)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	writer, err := bulk.NewWriter(w, format)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "format must be ndjson or csv")
+		return
+	}
+
+	var (
+		count   int
+		flushed bool
+	)
+	flush := func() error {
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		flushed = true
+		return rc.Flush()
+	}
+
+	w.Header().Set("Content-Type", bulk.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="orders.`+format+`"`)
+	err = h.service.ExportOrders(r.Context(), filter, func(order *model.Order) error {
+		if err := writer.Write(order); err != nil {
+			return err
+		}
+		if count++; count%exportFlushEvery == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		log.Printf("Error exporting orders after %d: %v", count, err)
+		if !flushed {
+			w.Header().Del("Content-Disposition")
+			writeProblem(w, http.StatusInternalServerError, "Failed to export orders")
+			return
+		}
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// parseOrderFilter reads the order filter query parameters shared by list
+// style endpoints.
+func parseOrderFilter(query url.Values) (model.OrderFilter, error) {
+	filter := model.OrderFilter{
+		Status:          model.OrderStatus(query.Get("status")),
+		CustomerID:      query.Get("customer_id"),
+		DeliveryService: query.Get("delivery_service"),
+	}
+	if filter.Status != "" && !filter.Status.Valid() {
+		return filter, fmt.Errorf("unknown status %q", filter.Status)
+	}
+	if raw := query.Get("include_deleted"); raw != "" {
+		include, err := strconv.ParseBool(raw)
+		if err != nil {
+			return filter, fmt.Errorf("include_deleted must be a boolean")
+		}
+		filter.IncludeDeleted = include
+	}
+	for name, field := range map[string]*time.Time{
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+	} {
+		if raw := query.Get(name); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+			}
+			*field = t
+		}
+	}
+	return filter, nil
+}
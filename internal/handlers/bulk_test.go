@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"myapp/internal/bulk"
+	"myapp/internal/model"
+	"myapp/internal/model/modeltest"
+	"myapp/internal/service"
+	"myapp/internal/validation"
+
+	"github.com/gorilla/mux"
+)
+
+func TestImportOrders_ReportsEachLine(t *testing.T) {
+	fs := &fakeService{createErrs: map[string]error{
+		"taken": service.ErrAlreadyExists,
+		"bad": &validation.ViolationsError{
+			Violations: []validation.Violation{{Rule: "required", Field: "delivery.phone", Message: "is required"}},
+		},
+	}}
+	r := mux.NewRouter()
+	NewHandler(fs).RegisterRoutes(r)
+
+	body := strings.Join([]string{
+		`{"order_uid":"new"}`,
+		`{"order_uid":"taken"}`,
+		``,
+		`{"order_uid":"bad"}`,
+		`{"order_uid":`,
+		`{"order_uid":"new2","unknown":1}`,
+	}, "\n")
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/orders:import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	var results []bulk.ImportResult
+	var summary struct{ Summary bulk.ImportSummary }
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), `{"summary"`) {
+			if err := json.Unmarshal(scanner.Bytes(), &summary); err != nil {
+				t.Fatalf("decode summary: %v", err)
+			}
+			continue
+		}
+		var result bulk.ImportResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("decode result %q: %v", scanner.Text(), err)
+		}
+		results = append(results, result)
+	}
+
+	want := []struct {
+		line   int
+		status string
+	}{{1, bulk.ImportCreated}, {2, bulk.ImportConflict}, {4, bulk.ImportInvalid}, {5, bulk.ImportInvalid}, {6, bulk.ImportInvalid}}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d results, got %+v", len(want), results)
+	}
+	for i, w := range want {
+		if results[i].Line != w.line || results[i].Status != w.status {
+			t.Fatalf("result %d: expected line %d %s, got %+v", i, w.line, w.status, results[i])
+		}
+	}
+	if len(results[2].Errors) != 1 || results[2].Errors[0].Field != "delivery.phone" {
+		t.Fatalf("expected the validation violation, got %+v", results[2])
+	}
+	if len(results[4].Errors) != 1 || results[4].Errors[0].Field != "unknown" {
+		t.Fatalf("expected the unknown field violation, got %+v", results[4])
+	}
+	if summary.Summary != (bulk.ImportSummary{Lines: 5, Created: 1, Invalid: 3, Conflict: 1}) {
+		t.Fatalf("unexpected summary: %+v", summary.Summary)
+	}
+	if len(fs.created) != 1 || fs.created[0] != "new" {
+		t.Fatalf("expected only the valid order created, got %v", fs.created)
+	}
+}
+
+func TestExportOrders(t *testing.T) {
+	order := modeltest.Order()
+	r := mux.NewRouter()
+	NewHandler(&fakeService{exported: []*model.Order{order, order}}).RegisterRoutes(r)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/orders:export?format=csv&status=created", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("expected csv, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil || len(rows) != 3 {
+		t.Fatalf("expected header and two rows, got %v, %v", rows, err)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/orders:export", nil))
+	if lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n"); rec.Code != http.StatusOK || len(lines) != 2 {
+		t.Fatalf("expected two NDJSON lines, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	for _, target := range []string{"/api/v1/orders:export?format=xml", "/api/v1/orders:export?created_after=yesterday"} {
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", target, rec.Code)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	NewHandler(&fakeService{err: errors.New("db down")}).ExportOrders(rec, httptest.NewRequest(http.MethodGet, "/api/v1/orders:export", nil))
+	if rec.Code != http.StatusInternalServerError || rec.Header().Get("Content-Disposition") != "" {
+		t.Fatalf("expected a 500 problem before any output, got %d %v", rec.Code, rec.Header())
+	}
+}
@@ -2,11 +2,18 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
+	"mime"
+	"myapp/internal/decode"
 	"myapp/internal/model"
+	"myapp/internal/schema"
 	"myapp/internal/service"
+	"myapp/internal/stream"
+	"myapp/internal/validation"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -14,23 +21,74 @@ import (
 
 type Handler struct {
 	service service.Service
+	decoder *decode.Decoder
+	broker  *stream.Broker
+
+	webhooks service.WebhookService
+}
+
+type Option func(*Handler)
+
+// WithDecoder sets the limits request bodies are decoded with.
+func WithDecoder(d *decode.Decoder) Option {
+	return func(h *Handler) {
+		h.decoder = d
+	}
 }
 
-func NewHandler(service service.Service) *Handler {
-	return &Handler{
+func NewHandler(service service.Service, opts ...Option) *Handler {
+	h := &Handler{
 		service: service,
+		decoder: decode.New(),
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
-	api := router.PathPrefix("/api/v1").Subrouter()
+	// Unknown API paths and methods get problems from the API's own router,
+	// so a catch-all route the caller adds, such as the static files, does
+	// not answer them.
+	apiRoot := router.PathPrefix("/api/").Subrouter()
+	apiRoot.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+	apiRoot.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowedHandler)
+
+	api := apiRoot.PathPrefix("/v1").Subrouter()
+	api.Use(actorMiddleware)
 	api.HandleFunc("/orders", h.CreateOrder).Methods("POST")
+	api.HandleFunc("/orders:import", h.ImportOrders).Methods("POST")
+	api.HandleFunc("/orders:export", h.ExportOrders).Methods("GET")
+	api.HandleFunc("/orders/stream", h.StreamOrders).Methods("GET")
+	api.HandleFunc("/orders/stream/ws", h.StreamOrdersWS).Methods("GET")
 	api.HandleFunc("/orders/{order_uid}", h.GetOrderByUID).Methods("GET")
 	api.HandleFunc("/orders", h.GetAllOrders).Methods("GET")
 	api.HandleFunc("/orders/{order_uid}", h.UpdateOrder).Methods("PUT")
+	api.HandleFunc("/orders/{order_uid}", h.PatchOrder).Methods("PATCH")
 	api.HandleFunc("/orders/{order_uid}", h.DeleteOrder).Methods("DELETE")
+	api.HandleFunc("/orders/{order_uid}/status", h.ChangeOrderStatus).Methods("POST")
+	api.HandleFunc("/orders/{order_uid}/restore", h.RestoreOrder).Methods("POST")
+	api.HandleFunc("/orders/{order_uid}/history", h.GetOrderHistory).Methods("GET")
+	api.HandleFunc("/orders/{order_uid}/items", h.GetOrderItems).Methods("GET")
+	api.HandleFunc("/orders/{order_uid}/items", h.AddOrderItem).Methods("POST")
+	api.HandleFunc("/orders/{order_uid}/items/{rid}", h.GetOrderItem).Methods("GET")
+	api.HandleFunc("/orders/{order_uid}/items/{rid}", h.UpdateOrderItem).Methods("PUT")
+	api.HandleFunc("/orders/{order_uid}/items/{rid}", h.DeleteOrderItem).Methods("DELETE")
 	api.HandleFunc("/cache/stats", h.GetCacheStats).Methods("GET")
+	api.HandleFunc("/cache/stats/reset", h.ResetCacheStats).Methods("POST")
 	api.HandleFunc("/cache/warmup", h.WarmupCache).Methods("POST")
+	api.HandleFunc("/webhooks", h.CreateWebhook).Methods("POST")
+	api.HandleFunc("/webhooks", h.ListWebhooks).Methods("GET")
+	api.HandleFunc("/webhooks/{id}", h.GetWebhook).Methods("GET")
+	api.HandleFunc("/webhooks/{id}", h.UpdateWebhook).Methods("PUT")
+	api.HandleFunc("/webhooks/{id}", h.DeleteWebhook).Methods("DELETE")
+	api.HandleFunc("/webhooks/{id}/deliveries", h.GetWebhookDeliveries).Methods("GET")
+	api.HandleFunc("/schema/order", h.GetOrderSchema).Methods("GET")
+	api.HandleFunc("/openapi.json", h.GetOpenAPISpec).Methods("GET")
+	api.HandleFunc("/docs", h.SwaggerUI).Methods("GET")
+	api.HandleFunc("/docs/swagger-ui.css", h.SwaggerAsset).Methods("GET")
+	api.HandleFunc("/docs/swagger-ui-bundle.js", h.SwaggerAsset).Methods("GET")
 
 	router.HandleFunc("/order/{order_uid}", h.GetOrderByUID).Methods("GET")
 
@@ -39,23 +97,47 @@ func (h *Handler) RegisterRoutes(router *mux.Router) {
 
 func (h *Handler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 	var order model.Order
-	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if err := h.decoder.DecodeRequest(w, r, &order); err != nil {
+		writeDecodeProblem(w, err)
 		return
 	}
 
-	if err := h.service.ProcessOrder(&order); err != nil {
+	ctx := r.Context()
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		ctx = model.WithIdempotencyKey(ctx, model.HTTPIdempotencyKey(key))
+	}
+
+	status := http.StatusCreated
+	if err := h.service.CreateOrder(ctx, &order); err != nil {
 		log.Printf("Error creating order: %v", err)
-		http.Error(w, "Failed to create order", http.StatusInternalServerError)
-		return
+		switch {
+		case errors.Is(err, service.ErrDuplicateMessage):
+			w.Header().Set("Idempotent-Replayed", "true")
+			status = http.StatusOK
+		case validation.IsValidationError(err):
+			writeValidationProblem(w, err)
+			return
+		case errors.Is(err, service.ErrAlreadyExists):
+			writeProblem(w, http.StatusConflict, "Order already exists")
+			return
+		case errors.Is(err, service.ErrDuplicateTransaction):
+			writeProblem(w, http.StatusConflict, "Payment transaction is already recorded for another order")
+			return
+		case errors.Is(err, service.ErrIdempotencyMismatch):
+			writeProblem(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request body")
+			return
+		default:
+			writeProblem(w, http.StatusInternalServerError, "Failed to create order")
+			return
+		}
 	}
 
+	w.Header().Set("ETag", formatETag(order.Version))
+	w.Header().Set("Location", "/api/v1/orders/"+order.OrderUID)
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(order); err != nil {
 		log.Printf("Error encoding created order: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
 	}
 }
 
@@ -64,22 +146,38 @@ func (h *Handler) GetOrderByUID(w http.ResponseWriter, r *http.Request) {
 	orderUID := vars["order_uid"]
 
 	if orderUID == "" {
-		http.Error(w, "order_uid is required", http.StatusBadRequest)
+		writeProblem(w, http.StatusBadRequest, "order_uid is required")
 		return
 	}
 
-	order, err := h.service.GetOrderByUID(orderUID)
+	var (
+		data    []byte
+		version int64
+		err     error
+	)
+	if includeDeleted(r) {
+		var order *model.Order
+		if order, err = h.service.GetOrderByUID(r.Context(), orderUID, true); err == nil {
+			version = order.Version
+			data, err = json.Marshal(order)
+		}
+	} else {
+		data, version, err = h.service.GetOrderJSON(r.Context(), orderUID)
+	}
 	if err != nil {
 		log.Printf("Error getting order %s: %v", orderUID, err)
-		http.Error(w, "Order not found", http.StatusNotFound)
+		if errors.Is(err, service.ErrNotFound) {
+			writeProblem(w, http.StatusNotFound, "Order not found")
+			return
+		}
+		writeProblem(w, http.StatusInternalServerError, "Failed to get order")
 		return
 	}
 
+	w.Header().Set("ETag", formatETag(version))
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(order); err != nil {
-		log.Printf("Error encoding order: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+	if _, err := w.Write(data); err != nil {
+		log.Printf("Error writing order: %v", err)
 	}
 }
 
@@ -102,10 +200,10 @@ func (h *Handler) GetAllOrders(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	orders, err := h.service.GetAllOrders()
+	orders, err := h.service.GetAllOrders(r.Context(), model.OrderFilter{IncludeDeleted: includeDeleted(r)})
 	if err != nil {
 		log.Printf("Error getting orders: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeProblem(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -135,8 +233,6 @@ func (h *Handler) GetAllOrders(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.Printf("Error encoding orders: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
 	}
 }
 
@@ -145,30 +241,193 @@ func (h *Handler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
 	orderUID := vars["order_uid"]
 
 	if orderUID == "" {
-		http.Error(w, "order_uid is required", http.StatusBadRequest)
+		writeProblem(w, http.StatusBadRequest, "order_uid is required")
 		return
 	}
 
 	var order model.Order
-	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if err := h.decoder.DecodeRequest(w, r, &order); err != nil {
+		writeDecodeProblem(w, err)
 		return
 	}
 
 	order.OrderUID = orderUID
 
-	if err := h.service.UpdateOrder(&order); err != nil {
+	ifMatch, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	if ifMatch != 0 {
+		order.Version = ifMatch
+	}
+	if order.Version == 0 {
+		writeProblem(w, http.StatusPreconditionRequired, "Order updates require If-Match with the order ETag or a version in the body")
+		return
+	}
+
+	if err := h.service.UpdateOrder(r.Context(), &order); err != nil {
 		log.Printf("Error updating order %s: %v", orderUID, err)
-		http.Error(w, "Failed to update order", http.StatusInternalServerError)
+		switch {
+		case validation.IsValidationError(err):
+			writeValidationProblem(w, err)
+		case errors.Is(err, service.ErrVersionConflict) && ifMatch != 0:
+			writeProblem(w, http.StatusPreconditionFailed, "Order was modified, If-Match does not match")
+		case errors.Is(err, service.ErrVersionConflict):
+			writeProblem(w, http.StatusConflict, "Order was modified concurrently")
+		case errors.Is(err, service.ErrNotFound):
+			writeProblem(w, http.StatusNotFound, "Order not found")
+		default:
+			writeProblem(w, http.StatusInternalServerError, "Failed to update order")
+		}
 		return
 	}
 
+	w.Header().Set("ETag", formatETag(order.Version))
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(order); err != nil {
 		log.Printf("Error encoding updated order: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// PatchOrder accepts an RFC 7396 merge patch (application/merge-patch+json or
+// application/json) or an RFC 6902 JSON Patch (application/json-patch+json).
+func (h *Handler) PatchOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderUID := vars["order_uid"]
+
+	if orderUID == "" {
+		writeProblem(w, http.StatusBadRequest, "order_uid is required")
+		return
+	}
+
+	var format service.PatchFormat
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/merge-patch+json", "application/json", "":
+		format = service.MergePatch
+	case "application/json-patch+json":
+		format = service.JSONPatch
+	default:
+		writeProblem(w, http.StatusUnsupportedMediaType, "Unsupported patch media type")
+		return
+	}
+
+	patch, err := h.decoder.ReadRequest(w, r)
+	if err != nil {
+		writeDecodeProblem(w, err)
+		return
+	}
+
+	expectedVersion, ok := ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	if expectedVersion == 0 {
+		writeProblem(w, http.StatusPreconditionRequired, "Order patches require If-Match with the order ETag")
+		return
+	}
+
+	order, err := h.service.PatchOrder(r.Context(), orderUID, format, patch, expectedVersion)
+	if err != nil {
+		log.Printf("Error patching order %s: %v", orderUID, err)
+		switch {
+		case decode.IsDecodeError(err):
+			writeDecodeProblem(w, err)
+		case errors.Is(err, service.ErrInvalidPatch):
+			writeProblem(w, http.StatusBadRequest, err.Error())
+		case validation.IsValidationError(err):
+			writeValidationProblem(w, err)
+		case errors.Is(err, service.ErrNotFound):
+			writeProblem(w, http.StatusNotFound, "Order not found")
+		case errors.Is(err, service.ErrVersionConflict):
+			writeProblem(w, http.StatusPreconditionFailed, "Order was modified, If-Match does not match")
+		default:
+			writeProblem(w, http.StatusInternalServerError, "Failed to patch order")
+		}
+		return
+	}
+
+	w.Header().Set("ETag", formatETag(order.Version))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(order); err != nil {
+		log.Printf("Error encoding patched order: %v", err)
+	}
+}
+
+func (h *Handler) ChangeOrderStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderUID := vars["order_uid"]
+
+	if orderUID == "" {
+		writeProblem(w, http.StatusBadRequest, "order_uid is required")
+		return
+	}
+
+	var change model.StatusChange
+	if err := h.decoder.DecodeRequest(w, r, &change); err != nil {
+		writeDecodeProblem(w, err)
+		return
+	}
+
+	change.OrderUID = orderUID
+
+	order, err := h.service.ChangeOrderStatus(r.Context(), &change)
+	if err != nil {
+		log.Printf("Error changing status of order %s: %v", orderUID, err)
+		switch {
+		case errors.Is(err, service.ErrInvalidStatus):
+			sendProblem(w, Problem{
+				Type:   problemTypeValidation,
+				Title:  "Order validation failed",
+				Status: http.StatusUnprocessableEntity,
+				Detail: "Unknown order status.",
+				Errors: []validation.Violation{{Rule: "oneof", Field: "status", Message: "must be a known order status"}},
+			})
+		case errors.Is(err, service.ErrNotFound):
+			writeProblem(w, http.StatusNotFound, "Order not found")
+		case errors.Is(err, service.ErrInvalidStatusTransition), errors.Is(err, service.ErrStatusConflict):
+			writeProblem(w, http.StatusConflict, err.Error())
+		default:
+			writeProblem(w, http.StatusInternalServerError, "Failed to change order status")
+		}
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(order); err != nil {
+		log.Printf("Error encoding order: %v", err)
+	}
+}
+
+func (h *Handler) GetOrderHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderUID := vars["order_uid"]
+
+	if orderUID == "" {
+		writeProblem(w, http.StatusBadRequest, "order_uid is required")
+		return
+	}
+
+	events, err := h.service.GetOrderHistory(r.Context(), orderUID)
+	if err != nil {
+		if errors.Is(err, service.ErrNotFound) {
+			writeProblem(w, http.StatusNotFound, "Order not found")
+			return
+		}
+		log.Printf("Error getting history of order %s: %v", orderUID, err)
+		writeProblem(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	response := map[string]interface{}{
+		"order_uid": orderUID,
+		"events":    events,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding order history: %v", err)
+	}
 }
 
 func (h *Handler) DeleteOrder(w http.ResponseWriter, r *http.Request) {
@@ -176,34 +435,70 @@ func (h *Handler) DeleteOrder(w http.ResponseWriter, r *http.Request) {
 	orderUID := vars["order_uid"]
 
 	if orderUID == "" {
-		http.Error(w, "order_uid is required", http.StatusBadRequest)
+		writeProblem(w, http.StatusBadRequest, "order_uid is required")
 		return
 	}
 
-	if err := h.service.DeleteOrder(orderUID); err != nil {
+	if err := h.service.DeleteOrder(r.Context(), orderUID); err != nil {
 		log.Printf("Error deleting order %s: %v", orderUID, err)
-		http.Error(w, "Failed to delete order", http.StatusInternalServerError)
+		if errors.Is(err, service.ErrNotFound) {
+			writeProblem(w, http.StatusNotFound, "Order not found")
+			return
+		}
+		writeProblem(w, http.StatusInternalServerError, "Failed to delete order")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (h *Handler) RestoreOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderUID := vars["order_uid"]
+
+	if orderUID == "" {
+		writeProblem(w, http.StatusBadRequest, "order_uid is required")
+		return
+	}
+
+	order, err := h.service.RestoreOrder(r.Context(), orderUID)
+	if err != nil {
+		log.Printf("Error restoring order %s: %v", orderUID, err)
+		switch {
+		case errors.Is(err, service.ErrNotFound):
+			writeProblem(w, http.StatusNotFound, "Order not found")
+		case errors.Is(err, service.ErrNotDeleted):
+			writeProblem(w, http.StatusConflict, "Order is not deleted")
+		default:
+			writeProblem(w, http.StatusInternalServerError, "Failed to restore order")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(order); err != nil {
+		log.Printf("Error encoding restored order: %v", err)
+	}
+}
+
 func (h *Handler) GetCacheStats(w http.ResponseWriter, r *http.Request) {
 	stats := h.service.GetCacheStats()
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(stats); err != nil {
 		log.Printf("Error encoding cache stats: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
 	}
 }
 
+func (h *Handler) ResetCacheStats(w http.ResponseWriter, r *http.Request) {
+	h.service.ResetCacheStats()
+	h.GetCacheStats(w, r)
+}
+
 func (h *Handler) WarmupCache(w http.ResponseWriter, r *http.Request) {
-	if err := h.service.WarmupCache(); err != nil {
+	if err := h.service.WarmupCache(r.Context()); err != nil {
 		log.Printf("Error warming up cache: %v", err)
-		http.Error(w, "Failed to warm up cache", http.StatusInternalServerError)
+		writeProblem(w, http.StatusInternalServerError, "Failed to warm up cache")
 		return
 	}
 
@@ -215,9 +510,25 @@ func (h *Handler) WarmupCache(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.Printf("Error encoding warmup response: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// GetOrderSchema serves the JSON Schema of the order payload. The ETag is the
+// schema version, which changes only when the model does.
+func (h *Handler) GetOrderSchema(w http.ResponseWriter, r *http.Request) {
+	data, version := schema.Order()
+	etag := `"` + version + `"`
+
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	if _, err := w.Write(data); err != nil {
+		log.Printf("Error writing order schema: %v", err)
+	}
 }
 
 func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
@@ -231,7 +542,59 @@ func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.Printf("Error encoding health check response: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
 	}
 }
+
+// formatETag and parseETag map an order version to a strong ETag such as "3".
+func formatETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+func parseETag(etag string) (int64, bool) {
+	unquoted, err := strconv.Unquote(strings.TrimSpace(etag))
+	if err != nil {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// ifMatchVersion returns the order version in If-Match, or 0 if there is
+// none. "*" does not name a version and counts as none, so it cannot stand in
+// for a precondition. It writes a problem and returns false if the header is
+// not a version ETag.
+func ifMatchVersion(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" || ifMatch == "*" {
+		return 0, true
+	}
+	version, ok := parseETag(ifMatch)
+	if !ok {
+		writeProblem(w, http.StatusBadRequest, "Invalid If-Match header, expected a quoted order version such as \"3\"")
+		return 0, false
+	}
+	return version, true
+}
+
+func includeDeleted(r *http.Request) bool {
+	include, _ := strconv.ParseBool(r.URL.Query().Get("include_deleted"))
+	return include
+}
+
+func actorMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := r.Header.Get("X-Client-ID")
+		if client == "" {
+			client = r.UserAgent()
+		}
+		actor := model.Actor{
+			Type:       model.ActorHTTP,
+			Client:     client,
+			RemoteAddr: r.RemoteAddr,
+		}
+		next.ServeHTTP(w, r.WithContext(model.WithActor(r.Context(), actor)))
+	})
+}
@@ -1,29 +1,161 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"myapp/internal/cache"
 	"myapp/internal/model"
+	"myapp/internal/service"
+	"myapp/internal/validation"
 
 	"github.com/gorilla/mux"
 )
 
 type fakeService struct {
-	order *model.Order
-	err   error
+	order  *model.Order
+	err    error
+	events []model.OrderEvent
+
+	// createErrs, when set, fails CreateOrder per order UID.
+	createErrs map[string]error
+	created    []string
+	exported   []*model.Order
 }
 
-func (f *fakeService) ProcessOrder(order *model.Order) error               { return nil }
-func (f *fakeService) GetOrderByUID(orderUID string) (*model.Order, error) { return f.order, f.err }
-func (f *fakeService) GetAllOrders() ([]*model.Order, error)               { return []*model.Order{f.order}, nil }
-func (f *fakeService) UpdateOrder(order *model.Order) error                { return nil }
-func (f *fakeService) DeleteOrder(orderUID string) error                   { return nil }
-func (f *fakeService) GetCacheStats() cache.CacheStats                     { return cache.CacheStats{Size: 1} }
-func (f *fakeService) WarmupCache() error                                  { return nil }
+func (f *fakeService) ProcessOrder(ctx context.Context, order *model.Order) error { return nil }
+func (f *fakeService) CreateOrder(ctx context.Context, order *model.Order) error {
+	if f.createErrs != nil {
+		if err := f.createErrs[order.OrderUID]; err != nil {
+			return err
+		}
+		f.created = append(f.created, order.OrderUID)
+	}
+	return f.err
+}
+func (f *fakeService) GetOrderByUID(ctx context.Context, orderUID string, includeDeleted bool) (*model.Order, error) {
+	return f.order, f.err
+}
+func (f *fakeService) GetOrderJSON(ctx context.Context, orderUID string) ([]byte, int64, error) {
+	if f.err != nil {
+		return nil, 0, f.err
+	}
+	data, err := json.Marshal(f.order)
+	return data, f.order.Version, err
+}
+func (f *fakeService) GetAllOrders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, error) {
+	return []*model.Order{f.order}, nil
+}
+func (f *fakeService) GetOrderHeaders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, error) {
+	return []*model.Order{f.order}, nil
+}
+func (f *fakeService) GetOrderParts(ctx context.Context, orderUIDs []string, parts model.OrderParts) (map[string]*model.Order, error) {
+	return map[string]*model.Order{f.order.OrderUID: f.order}, nil
+}
+func (f *fakeService) ExportOrders(ctx context.Context, filter model.OrderFilter, fn func(*model.Order) error) error {
+	for _, order := range f.exported {
+		if err := fn(order); err != nil {
+			return err
+		}
+	}
+	return f.err
+}
+func (f *fakeService) UpdateOrder(ctx context.Context, order *model.Order) error {
+	if f.err != nil {
+		return f.err
+	}
+	if order.Version != 0 && order.Version != f.order.Version {
+		return service.ErrVersionConflict
+	}
+	order.Version++
+	return nil
+}
+func (f *fakeService) PatchOrder(ctx context.Context, orderUID string, format service.PatchFormat, patch []byte, expectedVersion int64) (*model.Order, error) {
+	return f.order, f.err
+}
+func (f *fakeService) ChangeOrderStatus(ctx context.Context, change *model.StatusChange) (*model.Order, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	order := f.order.Clone()
+	order.Status = change.Status
+	return order, nil
+}
+func (f *fakeService) DeleteOrder(ctx context.Context, orderUID string) error { return f.err }
+func (f *fakeService) RestoreOrder(ctx context.Context, orderUID string) (*model.Order, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.order, nil
+}
+func (f *fakeService) PurgeDeletedOrders(ctx context.Context, retention time.Duration) (int64, error) {
+	return 0, nil
+}
+func (f *fakeService) PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration) (int64, error) {
+	return 0, nil
+}
+func (f *fakeService) GetOrderHistory(ctx context.Context, orderUID string) ([]model.OrderEvent, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []model.OrderEvent{{OrderUID: orderUID, Type: model.EventCreated, Actor: model.ActorFromContext(ctx)}}, nil
+}
+func (f *fakeService) GetEventsSince(ctx context.Context, after model.EventPosition, limit int) ([]model.OrderEvent, error) {
+	var events []model.OrderEvent
+	for _, event := range f.events {
+		if after.Before(event.Position()) && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+func (f *fakeService) GetEventHorizon(ctx context.Context) (model.EventPosition, error) {
+	if len(f.events) == 0 {
+		return model.EventPosition{}, nil
+	}
+	return f.events[len(f.events)-1].Position(), nil
+}
+func (f *fakeService) GetEventPosition(ctx context.Context, id int64) (model.EventPosition, error) {
+	for _, event := range f.events {
+		if event.ID == id {
+			return event.Position(), nil
+		}
+	}
+	return model.EventPosition{}, service.ErrEventNotFound
+}
+func (f *fakeService) GetOrderItems(ctx context.Context, orderUID string) ([]model.Item, error) {
+	return f.order.Items, f.err
+}
+func (f *fakeService) GetOrderItem(ctx context.Context, orderUID, rid string) (*model.Item, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	item, ok := f.order.Item(rid)
+	if !ok {
+		return nil, service.ErrItemNotFound
+	}
+	return item, nil
+}
+func (f *fakeService) AddOrderItem(ctx context.Context, orderUID string, item model.Item) (*model.Order, error) {
+	return f.order, f.err
+}
+func (f *fakeService) UpdateOrderItem(ctx context.Context, orderUID, rid string, item model.Item) (*model.Order, error) {
+	return f.order, f.err
+}
+func (f *fakeService) DeleteOrderItem(ctx context.Context, orderUID, rid string) (*model.Order, error) {
+	return f.order, f.err
+}
+func (f *fakeService) GetCacheStats() cache.CacheStats                                  { return cache.CacheStats{Size: 1} }
+func (f *fakeService) ResetCacheStats()                                                 {}
+func (f *fakeService) WarmupCache(ctx context.Context) error                            { return nil }
+func (f *fakeService) RestoreCache(ctx context.Context, snapshot *cache.Snapshot) error { return nil }
 
 func TestGetOrderByUID(t *testing.T) {
 	order := &model.Order{OrderUID: "uid1", TrackNumber: "trk", Entry: "en", Locale: "en", CustomerID: "c", DeliveryService: "d",
@@ -51,3 +183,272 @@ func TestGetOrderByUID(t *testing.T) {
 		t.Fatalf("unexpected OrderUID: %s", got.OrderUID)
 	}
 }
+
+func TestChangeOrderStatus_InvalidTransition(t *testing.T) {
+	fs := &fakeService{err: fmt.Errorf("%w: delivered -> paid", service.ErrInvalidStatusTransition)}
+	h := NewHandler(fs)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/orders/uid1/status", strings.NewReader(`{"status":"paid"}`))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rec.Code)
+	}
+}
+
+func TestGetOrderHistory_RecordsHTTPActor(t *testing.T) {
+	h := NewHandler(&fakeService{})
+	r := mux.NewRouter()
+	h.RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/orders/uid1/history", nil)
+	req.Header.Set("X-Client-ID", "support-agent")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var got struct {
+		Events []model.OrderEvent `json:"events"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(got.Events) != 1 || got.Events[0].Actor.Type != model.ActorHTTP || got.Events[0].Actor.Client != "support-agent" {
+		t.Fatalf("unexpected events: %+v", got.Events)
+	}
+}
+
+func TestGetOrderHistory_MissingOrder(t *testing.T) {
+	h := NewHandler(&fakeService{err: fmt.Errorf("failed to get order history: %w", service.ErrNotFound)})
+	r := mux.NewRouter()
+	h.RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/orders/uid1/history", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestRestoreOrder_NotDeleted(t *testing.T) {
+	h := NewHandler(&fakeService{err: fmt.Errorf("failed to restore order: %w", service.ErrNotDeleted)})
+	r := mux.NewRouter()
+	h.RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/orders/uid1/restore", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rec.Code)
+	}
+}
+
+func TestUpdateOrder_IfMatch(t *testing.T) {
+	order := &model.Order{OrderUID: "uid1", Version: 3}
+	h := NewHandler(&fakeService{order: order})
+	r := mux.NewRouter()
+	h.RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/orders/uid1", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if etag := rec.Header().Get("ETag"); etag != `"3"` {
+		t.Fatalf("expected ETag \"3\", got %q", etag)
+	}
+
+	for _, tc := range []struct {
+		ifMatch string
+		body    string
+		want    int
+	}{
+		{ifMatch: `"2"`, body: `{}`, want: http.StatusPreconditionFailed},
+		{ifMatch: `3`, body: `{}`, want: http.StatusBadRequest},
+		{ifMatch: `W/"3"`, body: `{}`, want: http.StatusBadRequest},
+		{body: `{"version":2}`, want: http.StatusConflict},
+		{body: `{}`, want: http.StatusPreconditionRequired},
+		{ifMatch: `*`, body: `{}`, want: http.StatusPreconditionRequired},
+		{ifMatch: `*`, body: `{"version":3}`, want: http.StatusOK},
+		{ifMatch: `"3"`, body: `{}`, want: http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/orders/uid1", strings.NewReader(tc.body))
+		if tc.ifMatch != "" {
+			req.Header.Set("If-Match", tc.ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Fatalf("If-Match %q, body %s: expected %d, got %d", tc.ifMatch, tc.body, tc.want, rec.Code)
+		}
+	}
+}
+
+func TestPatchOrder_RequiresIfMatch(t *testing.T) {
+	h := NewHandler(&fakeService{order: &model.Order{OrderUID: "uid1", Version: 3}})
+	r := mux.NewRouter()
+	h.RegisterRoutes(r)
+
+	for ifMatch, want := range map[string]int{
+		"":    http.StatusPreconditionRequired,
+		"*":   http.StatusPreconditionRequired,
+		`"3"`: http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/orders/uid1", strings.NewReader(`{"shardkey":"2"}`))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("If-Match %q: expected %d, got %d", ifMatch, want, rec.Code)
+		}
+	}
+}
+
+func TestCreateOrder_Duplicate(t *testing.T) {
+	h := NewHandler(&fakeService{err: fmt.Errorf("failed to save order to database: %w", service.ErrAlreadyExists)})
+	r := mux.NewRouter()
+	h.RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/orders", strings.NewReader(`{"order_uid":"uid1"}`))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rec.Code)
+	}
+}
+
+func TestGetOrderItem_NotFound(t *testing.T) {
+	h := NewHandler(&fakeService{order: &model.Order{OrderUID: "uid1", Items: []model.Item{{RID: "r1"}}}})
+	r := mux.NewRouter()
+	h.RegisterRoutes(r)
+
+	for path, want := range map[string]int{
+		"/api/v1/orders/uid1/items/r1": http.StatusOK,
+		"/api/v1/orders/uid1/items/r2": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Fatalf("GET %s: expected %d, got %d", path, want, rec.Code)
+		}
+	}
+}
+
+func TestCreateOrder_ProblemDetails(t *testing.T) {
+	invalid := &model.Order{Items: []model.Item{{Price: -1}}}
+	validationErr := fmt.Errorf("invalid order: %w", validation.New().Validate(invalid))
+
+	for _, tc := range []struct {
+		name      string
+		err       error
+		body      string
+		wantCode  int
+		wantField string
+	}{
+		{name: "validation", err: validationErr, body: `{}`, wantCode: http.StatusUnprocessableEntity, wantField: "items[0].price"},
+		{name: "wrong type", body: `{"payment":{"amount":"ten"}}`, wantCode: http.StatusBadRequest, wantField: "payment.amount"},
+		{name: "malformed", body: `{"order_uid":`, wantCode: http.StatusBadRequest},
+		{name: "unknown field", body: `{"trak_number":"t"}`, wantCode: http.StatusBadRequest, wantField: "trak_number"},
+		{name: "reused key", err: fmt.Errorf("failed to save order to database: %w", service.ErrIdempotencyMismatch), body: `{}`, wantCode: http.StatusUnprocessableEntity},
+		{name: "internal", err: errors.New("connection refused"), body: `{}`, wantCode: http.StatusInternalServerError},
+	} {
+		h := NewHandler(&fakeService{err: tc.err})
+		r := mux.NewRouter()
+		h.RegisterRoutes(r)
+
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/orders", strings.NewReader(tc.body)))
+
+		if rec.Code != tc.wantCode {
+			t.Fatalf("%s: expected %d, got %d", tc.name, tc.wantCode, rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Fatalf("%s: unexpected content type %q", tc.name, ct)
+		}
+		var problem Problem
+		if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("%s: invalid problem json: %v", tc.name, err)
+		}
+		if problem.Status != tc.wantCode || problem.Type == "" || problem.Title == "" {
+			t.Fatalf("%s: incomplete problem: %+v", tc.name, problem)
+		}
+		if tc.wantField == "" {
+			continue
+		}
+		found := false
+		for _, v := range problem.Errors {
+			found = found || v.Field == tc.wantField
+		}
+		if !found {
+			t.Fatalf("%s: expected error on %s, got %+v", tc.name, tc.wantField, problem.Errors)
+		}
+	}
+}
+
+func TestUnknownAPIRoutesBehindCatchAll(t *testing.T) {
+	h := NewHandler(&fakeService{})
+	r := mux.NewRouter()
+	h.RegisterRoutes(r)
+	r.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	for _, tc := range []struct {
+		method, path string
+		wantCode     int
+	}{
+		{method: http.MethodGet, path: "/api/v1/nope", wantCode: http.StatusNotFound},
+		{method: http.MethodGet, path: "/api/v2/orders", wantCode: http.StatusNotFound},
+		{method: http.MethodDelete, path: "/api/v1/orders", wantCode: http.StatusMethodNotAllowed},
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+
+		if rec.Code != tc.wantCode {
+			t.Fatalf("%s %s: expected %d, got %d", tc.method, tc.path, tc.wantCode, rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Fatalf("%s %s: unexpected content type %q", tc.method, tc.path, ct)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/index.html", nil))
+	if rec.Code != http.StatusTeapot {
+		t.Fatalf("expected catch-all to serve non-API paths, got %d", rec.Code)
+	}
+}
+
+func TestGetOrderSchema(t *testing.T) {
+	h := NewHandler(&fakeService{})
+	r := mux.NewRouter()
+	h.RegisterRoutes(r)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/schema/order", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/schema+json" {
+		t.Fatalf("unexpected response: %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil || doc["title"] != "Order" {
+		t.Fatalf("unexpected schema: %v %v", err, doc["title"])
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/schema/order", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", rec.Code)
+	}
+}
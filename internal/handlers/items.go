@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"myapp/internal/decode"
+	"myapp/internal/model"
+	"myapp/internal/service"
+	"myapp/internal/validation"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) GetOrderItems(w http.ResponseWriter, r *http.Request) {
+	orderUID := mux.Vars(r)["order_uid"]
+
+	items, err := h.service.GetOrderItems(r.Context(), orderUID)
+	if err != nil {
+		writeItemError(w, err, "Error getting items of order "+orderUID)
+		return
+	}
+
+	response := map[string]interface{}{
+		"order_uid": orderUID,
+		"items":     items,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding order items: %v", err)
+	}
+}
+
+func (h *Handler) GetOrderItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderUID, rid := vars["order_uid"], vars["rid"]
+
+	item, err := h.service.GetOrderItem(r.Context(), orderUID, rid)
+	if err != nil {
+		writeItemError(w, err, "Error getting item "+rid+" of order "+orderUID)
+		return
+	}
+
+	writeItem(w, item, http.StatusOK)
+}
+
+func (h *Handler) AddOrderItem(w http.ResponseWriter, r *http.Request) {
+	orderUID := mux.Vars(r)["order_uid"]
+
+	var item model.Item
+	if err := h.decoder.DecodeRequest(w, r, &item); err != nil {
+		writeDecodeProblem(w, err)
+		return
+	}
+
+	order, err := h.service.AddOrderItem(r.Context(), orderUID, item)
+	if err != nil {
+		writeItemError(w, err, "Error adding item to order "+orderUID)
+		return
+	}
+
+	w.Header().Set("ETag", formatETag(order.Version))
+	w.Header().Set("Location", "/api/v1/orders/"+orderUID+"/items/"+item.RID)
+	writeItem(w, &item, http.StatusCreated)
+}
+
+func (h *Handler) UpdateOrderItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderUID, rid := vars["order_uid"], vars["rid"]
+
+	var item model.Item
+	if err := h.decoder.DecodeRequest(w, r, &item); err != nil {
+		writeDecodeProblem(w, err)
+		return
+	}
+
+	order, err := h.service.UpdateOrderItem(r.Context(), orderUID, rid, item)
+	if err != nil {
+		writeItemError(w, err, "Error updating item "+rid+" of order "+orderUID)
+		return
+	}
+
+	updated, _ := order.Item(rid)
+	w.Header().Set("ETag", formatETag(order.Version))
+	writeItem(w, updated, http.StatusOK)
+}
+
+func (h *Handler) DeleteOrderItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderUID, rid := vars["order_uid"], vars["rid"]
+
+	order, err := h.service.DeleteOrderItem(r.Context(), orderUID, rid)
+	if err != nil {
+		writeItemError(w, err, "Error deleting item "+rid+" of order "+orderUID)
+		return
+	}
+
+	w.Header().Set("ETag", formatETag(order.Version))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeItem(w http.ResponseWriter, item *model.Item, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(item); err != nil {
+		log.Printf("Error encoding order item: %v", err)
+	}
+}
+
+func writeItemError(w http.ResponseWriter, err error, message string) {
+	log.Printf("%s: %v", message, err)
+	switch {
+	case errors.Is(err, service.ErrItemNotFound):
+		writeProblem(w, http.StatusNotFound, "Item not found")
+	case errors.Is(err, service.ErrNotFound):
+		writeProblem(w, http.StatusNotFound, "Order not found")
+	case errors.Is(err, service.ErrItemAlreadyExists):
+		writeProblem(w, http.StatusConflict, "Item already exists")
+	case errors.Is(err, service.ErrLastItem):
+		writeProblem(w, http.StatusConflict, "The last item of an order cannot be deleted")
+	case decode.IsDecodeError(err):
+		writeDecodeProblem(w, err)
+	case errors.Is(err, service.ErrInvalidItem):
+		writeProblem(w, http.StatusBadRequest, err.Error())
+	case validation.IsValidationError(err):
+		writeValidationProblem(w, err)
+	default:
+		writeProblem(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
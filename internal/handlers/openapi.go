@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"log"
+	"myapp/internal/cache"
+	"myapp/internal/model"
+	"myapp/internal/schema"
+	"myapp/internal/validation"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed swagger.html
+var swaggerHTML []byte
+
+// swaggerAssets holds the vendored swagger-ui-dist files, pinned by
+// swagger-ui/VERSION, so the docs page loads nothing from third-party hosts.
+//
+//go:generate sh ../../scripts/fetch-swagger-ui.sh swagger-ui
+//go:embed swagger-ui
+var swaggerAssets embed.FS
+
+// apiOperation describes one route for the OpenAPI document. Responses maps a
+// status code to a component schema name; an empty name means no body.
+// Statuses of 400 and above always carry a Problem.
+type apiOperation struct {
+	Method      string
+	Path        string
+	Summary     string
+	Parameters  []string
+	RequestBody map[string]string
+	Responses   map[int]string
+	ContentType string
+}
+
+func withErrors(responses map[int]string, statuses ...int) map[int]string {
+	for _, status := range statuses {
+		responses[status] = ""
+	}
+	return responses
+}
+
+var apiOperations = []apiOperation{
+	{Method: "POST", Path: "/api/v1/orders", Summary: "Create an order", Parameters: []string{"IdempotencyKey"},
+		RequestBody: map[string]string{"application/json": "Order"},
+		Responses:   withErrors(map[int]string{200: "Order", 201: "Order"}, 400, 409, 413, 422, 500)},
+	{Method: "GET", Path: "/api/v1/orders", Summary: "List orders", Parameters: []string{"Limit", "Offset", "IncludeDeleted"},
+		Responses: withErrors(map[int]string{200: "OrderList"}, 500)},
+	{Method: "POST", Path: "/api/v1/orders:import", Summary: "Import orders from NDJSON, one order per line",
+		RequestBody: map[string]string{"application/x-ndjson": "Order"},
+		Responses:   withErrors(map[int]string{200: "ImportResult"}, 415), ContentType: "application/x-ndjson"},
+	{Method: "GET", Path: "/api/v1/orders:export", Summary: "Export orders as NDJSON or CSV (one row per item)",
+		Parameters: []string{"ExportFormat", "Status", "CustomerID", "DeliveryService", "CreatedAfter", "CreatedBefore", "IncludeDeleted"},
+		Responses:  withErrors(map[int]string{200: "Order"}, 400, 500), ContentType: "application/x-ndjson"},
+	{Method: "GET", Path: "/api/v1/orders/stream", Summary: "Stream order events (Server-Sent Events, one OrderEvent per data line)",
+		Parameters: []string{"CustomerID", "DeliveryService", "EventType", "LastEventID", "LastEventIDQuery"},
+		Responses:  withErrors(map[int]string{200: "OrderEvent"}, 400, 500, 503), ContentType: "text/event-stream"},
+	{Method: "GET", Path: "/api/v1/orders/stream/ws", Summary: "Stream order events over WebSocket, one OrderEvent per message",
+		Parameters: []string{"CustomerID", "DeliveryService", "EventType", "LastEventIDQuery"},
+		Responses:  withErrors(map[int]string{101: ""}, 400, 500, 503)},
+	{Method: "GET", Path: "/api/v1/orders/{order_uid}", Summary: "Get an order", Parameters: []string{"OrderUID", "IncludeDeleted"},
+		Responses: withErrors(map[int]string{200: "Order"}, 400, 404, 500)},
+	{Method: "PUT", Path: "/api/v1/orders/{order_uid}", Summary: "Replace an order", Parameters: []string{"OrderUID", "IfMatch"},
+		RequestBody: map[string]string{"application/json": "Order"},
+		Responses:   withErrors(map[int]string{200: "Order"}, 400, 404, 409, 412, 413, 422, 428, 500)},
+	{Method: "PATCH", Path: "/api/v1/orders/{order_uid}", Summary: "Partially update an order", Parameters: []string{"OrderUID", "IfMatch"},
+		RequestBody: map[string]string{"application/merge-patch+json": "MergePatch", "application/json-patch+json": "JSONPatch"},
+		Responses:   withErrors(map[int]string{200: "Order"}, 400, 404, 412, 413, 415, 422, 428, 500)},
+	{Method: "DELETE", Path: "/api/v1/orders/{order_uid}", Summary: "Soft-delete an order", Parameters: []string{"OrderUID"},
+		Responses: withErrors(map[int]string{204: ""}, 400, 404, 500)},
+	{Method: "POST", Path: "/api/v1/orders/{order_uid}/status", Summary: "Change the order status", Parameters: []string{"OrderUID"},
+		RequestBody: map[string]string{"application/json": "StatusChange"},
+		Responses:   withErrors(map[int]string{200: "Order"}, 400, 404, 409, 413, 422, 500)},
+	{Method: "POST", Path: "/api/v1/orders/{order_uid}/restore", Summary: "Restore a deleted order", Parameters: []string{"OrderUID"},
+		Responses: withErrors(map[int]string{200: "Order"}, 400, 404, 409, 500)},
+	{Method: "GET", Path: "/api/v1/orders/{order_uid}/history", Summary: "Get the order audit history", Parameters: []string{"OrderUID"},
+		Responses: withErrors(map[int]string{200: "OrderHistory"}, 400, 404, 500)},
+	{Method: "GET", Path: "/api/v1/orders/{order_uid}/items", Summary: "List order items", Parameters: []string{"OrderUID"},
+		Responses: withErrors(map[int]string{200: "OrderItems"}, 404, 500)},
+	{Method: "POST", Path: "/api/v1/orders/{order_uid}/items", Summary: "Add an item", Parameters: []string{"OrderUID"},
+		RequestBody: map[string]string{"application/json": "Item"},
+		Responses:   withErrors(map[int]string{201: "Item"}, 400, 404, 409, 413, 422, 500)},
+	{Method: "GET", Path: "/api/v1/orders/{order_uid}/items/{rid}", Summary: "Get an item", Parameters: []string{"OrderUID", "RID"},
+		Responses: withErrors(map[int]string{200: "Item"}, 404, 500)},
+	{Method: "PUT", Path: "/api/v1/orders/{order_uid}/items/{rid}", Summary: "Replace an item", Parameters: []string{"OrderUID", "RID"},
+		RequestBody: map[string]string{"application/json": "Item"},
+		Responses:   withErrors(map[int]string{200: "Item"}, 400, 404, 413, 422, 500)},
+	{Method: "DELETE", Path: "/api/v1/orders/{order_uid}/items/{rid}", Summary: "Remove an item", Parameters: []string{"OrderUID", "RID"},
+		Responses: withErrors(map[int]string{204: ""}, 404, 409, 500)},
+	{Method: "GET", Path: "/api/v1/cache/stats", Summary: "Get cache statistics",
+		Responses: map[int]string{200: "CacheStats"}},
+	{Method: "POST", Path: "/api/v1/cache/stats/reset", Summary: "Reset cache statistics",
+		Responses: map[int]string{200: "CacheStats"}},
+	{Method: "POST", Path: "/api/v1/cache/warmup", Summary: "Warm up the cache",
+		Responses: withErrors(map[int]string{200: "WarmupResult"}, 500)},
+	{Method: "POST", Path: "/api/v1/webhooks", Summary: "Subscribe a webhook to order events",
+		RequestBody: map[string]string{"application/json": "WebhookRequest"},
+		Responses:   withErrors(map[int]string{201: "Webhook"}, 400, 413, 422, 500, 503)},
+	{Method: "GET", Path: "/api/v1/webhooks", Summary: "List webhooks",
+		Responses: withErrors(map[int]string{200: "WebhookList"}, 500, 503)},
+	{Method: "GET", Path: "/api/v1/webhooks/{id}", Summary: "Get a webhook", Parameters: []string{"WebhookID"},
+		Responses: withErrors(map[int]string{200: "Webhook"}, 400, 404, 500, 503)},
+	{Method: "PUT", Path: "/api/v1/webhooks/{id}", Summary: "Replace a webhook", Parameters: []string{"WebhookID"},
+		RequestBody: map[string]string{"application/json": "WebhookRequest"},
+		Responses:   withErrors(map[int]string{200: "Webhook"}, 400, 404, 413, 422, 500, 503)},
+	{Method: "DELETE", Path: "/api/v1/webhooks/{id}", Summary: "Delete a webhook", Parameters: []string{"WebhookID"},
+		Responses: withErrors(map[int]string{204: ""}, 400, 404, 500, 503)},
+	{Method: "GET", Path: "/api/v1/webhooks/{id}/deliveries", Summary: "Get the webhook delivery log", Parameters: []string{"WebhookID", "DeliveriesLimit"},
+		Responses: withErrors(map[int]string{200: "WebhookDeliveries"}, 400, 404, 500, 503)},
+	{Method: "GET", Path: "/api/v1/schema/order", Summary: "Get the order JSON Schema", Parameters: []string{"IfNoneMatch"},
+		Responses: map[int]string{200: "JSONSchema", 304: ""}, ContentType: "application/schema+json"},
+	{Method: "GET", Path: "/api/v1/openapi.json", Summary: "Get this OpenAPI document",
+		Responses: map[int]string{200: "OpenAPI"}},
+	{Method: "GET", Path: "/api/v1/docs", Summary: "Swagger UI",
+		Responses: map[int]string{200: "HTML"}, ContentType: "text/html"},
+	{Method: "GET", Path: "/api/v1/docs/swagger-ui.css", Summary: "Swagger UI stylesheet",
+		Responses: withErrors(map[int]string{200: "CSS"}, 404), ContentType: "text/css"},
+	{Method: "GET", Path: "/api/v1/docs/swagger-ui-bundle.js", Summary: "Swagger UI script",
+		Responses: withErrors(map[int]string{200: "JavaScript"}, 404), ContentType: "text/javascript"},
+	{Method: "GET", Path: "/order/{order_uid}", Summary: "Get an order (legacy path)", Parameters: []string{"OrderUID"},
+		Responses: withErrors(map[int]string{200: "Order"}, 400, 404, 500)},
+	{Method: "GET", Path: "/health", Summary: "Health check",
+		Responses: map[int]string{200: "Health"}},
+}
+
+var apiParameters = map[string]map[string]interface{}{
+	"OrderUID":         {"name": "order_uid", "in": "path", "required": true, "schema": &schema.Schema{Type: "string"}},
+	"RID":              {"name": "rid", "in": "path", "required": true, "schema": &schema.Schema{Type: "string"}},
+	"IncludeDeleted":   {"name": "include_deleted", "in": "query", "schema": &schema.Schema{Type: "boolean"}},
+	"Limit":            {"name": "limit", "in": "query", "schema": &schema.Schema{Type: "integer", Minimum: floatPtr(1)}},
+	"Offset":           {"name": "offset", "in": "query", "schema": &schema.Schema{Type: "integer", Minimum: floatPtr(0)}},
+	"IfMatch":          {"name": "If-Match", "in": "header", "description": "Order version from the ETag, such as \"3\". Required on PATCH, and on PUT unless the body carries a version", "schema": &schema.Schema{Type: "string"}},
+	"IfNoneMatch":      {"name": "If-None-Match", "in": "header", "schema": &schema.Schema{Type: "string"}},
+	"IdempotencyKey":   {"name": "Idempotency-Key", "in": "header", "schema": &schema.Schema{Type: "string"}},
+	"CustomerID":       {"name": "customer_id", "in": "query", "schema": &schema.Schema{Type: "string"}},
+	"DeliveryService":  {"name": "delivery_service", "in": "query", "schema": &schema.Schema{Type: "string"}},
+	"EventType":        {"name": "type", "in": "query", "description": "Comma-separated event types, such as created,status_changed", "schema": &schema.Schema{Type: "string"}},
+	"LastEventID":      {"name": "Last-Event-ID", "in": "header", "description": "ID of the last event received; later events are replayed first", "schema": &schema.Schema{Type: "string"}},
+	"LastEventIDQuery": {"name": "last_event_id", "in": "query", "description": "Same as the Last-Event-ID header", "schema": &schema.Schema{Type: "integer", Minimum: floatPtr(0)}},
+	"ExportFormat":     {"name": "format", "in": "query", "schema": &schema.Schema{Type: "string", Enum: []interface{}{"ndjson", "csv"}}},
+	"Status":           {"name": "status", "in": "query", "schema": &schema.Schema{Type: "string"}},
+	"CreatedAfter":     {"name": "created_after", "in": "query", "schema": &schema.Schema{Type: "string", Format: "date-time"}},
+	"CreatedBefore":    {"name": "created_before", "in": "query", "schema": &schema.Schema{Type: "string", Format: "date-time"}},
+	"WebhookID":        {"name": "id", "in": "path", "required": true, "schema": &schema.Schema{Type: "integer", Minimum: floatPtr(1)}},
+	"DeliveriesLimit":  {"name": "limit", "in": "query", "schema": &schema.Schema{Type: "integer", Minimum: floatPtr(1), Maximum: floatPtr(maxDeliveriesLimit)}},
+}
+
+func apiSchemas() map[string]*schema.Schema {
+	ref := func(name string) *schema.Schema { return &schema.Schema{Ref: "#/components/schemas/" + name} }
+	object := func(props map[string]*schema.Schema) *schema.Schema {
+		return &schema.Schema{Type: "object", Properties: props}
+	}
+	str := &schema.Schema{Type: "string"}
+	integer := &schema.Schema{Type: "integer"}
+
+	return map[string]*schema.Schema{
+		"Order":           schema.Generate(reflect.TypeOf(model.Order{})),
+		"Item":            schema.Generate(reflect.TypeOf(model.Item{})),
+		"StatusChange":    schema.Generate(reflect.TypeOf(model.StatusChange{})),
+		"OrderEvent":      schema.Generate(reflect.TypeOf(model.OrderEvent{})),
+		"CacheStats":      schema.Generate(reflect.TypeOf(cache.CacheStats{})),
+		"Problem":         schema.Generate(reflect.TypeOf(Problem{})),
+		"Violation":       schema.Generate(reflect.TypeOf(validation.Violation{})),
+		"Webhook":         schema.Generate(reflect.TypeOf(model.Webhook{})),
+		"WebhookDelivery": schema.Generate(reflect.TypeOf(model.WebhookDelivery{})),
+		"WebhookRequest": object(map[string]*schema.Schema{
+			"url":         {Type: "string", Format: "uri"},
+			"secret":      {Type: "string", Description: "Signing secret of at least 16 characters; generated when omitted on create"},
+			"event_types": {Type: "array", Items: str},
+			"active":      {Type: "boolean"},
+		}),
+		"ImportResult": {
+			Description: "One line per imported line, then a summary line",
+			AnyOf: []*schema.Schema{
+				object(map[string]*schema.Schema{
+					"line": integer, "order_uid": str, "error": str,
+					"status": {Type: "string", Enum: []interface{}{"created", "invalid", "conflict", "failed"}},
+					"errors": {Type: "array", Items: ref("Violation")},
+				}),
+				object(map[string]*schema.Schema{"summary": object(map[string]*schema.Schema{
+					"lines": integer, "created": integer, "invalid": integer, "conflict": integer, "failed": integer,
+				})}),
+			},
+		},
+		"WebhookList":       object(map[string]*schema.Schema{"webhooks": {Type: "array", Items: ref("Webhook")}}),
+		"WebhookDeliveries": object(map[string]*schema.Schema{"webhook_id": integer, "deliveries": {Type: "array", Items: ref("WebhookDelivery")}}),
+		"OrderList": object(map[string]*schema.Schema{
+			"orders": {Type: "array", Items: ref("Order")},
+			"pagination": object(map[string]*schema.Schema{
+				"total": integer, "limit": integer, "offset": integer, "count": integer,
+			}),
+		}),
+		"OrderHistory": object(map[string]*schema.Schema{"order_uid": str, "events": {Type: "array", Items: ref("OrderEvent")}}),
+		"OrderItems":   object(map[string]*schema.Schema{"order_uid": str, "items": {Type: "array", Items: ref("Item")}}),
+		"WarmupResult": object(map[string]*schema.Schema{"message": str, "time": {Type: "string", Format: "date-time"}}),
+		"Health": object(map[string]*schema.Schema{
+			"status": str, "timestamp": {Type: "string", Format: "date-time"}, "service": str, "version": str,
+		}),
+		"MergePatch": {Type: "object", Description: "RFC 7396 merge patch applied to the order"},
+		"JSONPatch": {Type: "array", Description: "RFC 6902 JSON Patch applied to the order", Items: &schema.Schema{
+			Type:     "object",
+			Required: []string{"op", "path"},
+			Properties: map[string]*schema.Schema{
+				"op":    {Type: "string", Enum: []interface{}{"add", "remove", "replace", "move", "copy", "test"}},
+				"path":  str,
+				"from":  str,
+				"value": {},
+			},
+		}},
+		"JSONSchema": {Type: "object", Description: "JSON Schema 2020-12 document"},
+		"OpenAPI":    {Type: "object", Description: "OpenAPI 3.1 document"},
+		"HTML":       str,
+		"CSS":        str,
+		"JavaScript": str,
+	}
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIJSON []byte
+)
+
+// openAPISpec builds the OpenAPI document once. Order and item schemas are
+// the ones published at /api/v1/schema/order, generated from the model.
+func openAPISpec() []byte {
+	openAPIOnce.Do(func() {
+		paths := map[string]map[string]interface{}{}
+		for _, op := range apiOperations {
+			if paths[op.Path] == nil {
+				paths[op.Path] = map[string]interface{}{}
+			}
+			paths[op.Path][strings.ToLower(op.Method)] = op.document()
+		}
+
+		parameters := map[string]interface{}{}
+		for name, param := range apiParameters {
+			parameters[name] = param
+		}
+
+		doc := map[string]interface{}{
+			"openapi": "3.1.0",
+			"info": map[string]interface{}{
+				"title":   "Order Service API",
+				"version": "1.0.0",
+			},
+			"paths": paths,
+			"components": map[string]interface{}{
+				"schemas":    apiSchemas(),
+				"parameters": parameters,
+			},
+		}
+
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			panic("handlers: failed to encode OpenAPI document: " + err.Error())
+		}
+		openAPIJSON = data
+	})
+	return openAPIJSON
+}
+
+func (op apiOperation) document() map[string]interface{} {
+	doc := map[string]interface{}{
+		"summary":     op.Summary,
+		"operationId": operationID(op),
+	}
+
+	if len(op.Parameters) > 0 {
+		params := make([]map[string]string, len(op.Parameters))
+		for i, name := range op.Parameters {
+			params[i] = map[string]string{"$ref": "#/components/parameters/" + name}
+		}
+		doc["parameters"] = params
+	}
+
+	if len(op.RequestBody) > 0 {
+		content := map[string]interface{}{}
+		for mediaType, name := range op.RequestBody {
+			content[mediaType] = map[string]interface{}{"schema": map[string]string{"$ref": "#/components/schemas/" + name}}
+		}
+		doc["requestBody"] = map[string]interface{}{"required": true, "content": content}
+	}
+
+	responses := map[string]interface{}{}
+	for status, name := range op.Responses {
+		response := map[string]interface{}{"description": http.StatusText(status)}
+		mediaType := op.ContentType
+		if mediaType == "" {
+			mediaType = "application/json"
+		}
+		if status >= 400 {
+			name, mediaType = "Problem", "application/problem+json"
+		}
+		if name != "" {
+			response["content"] = map[string]interface{}{
+				mediaType: map[string]interface{}{"schema": map[string]string{"$ref": "#/components/schemas/" + name}},
+			}
+		}
+		responses[strconv.Itoa(status)] = response
+	}
+	doc["responses"] = responses
+	return doc
+}
+
+// operationID derives a stable identifier such as getApiV1OrdersOrderUidItems.
+func operationID(op apiOperation) string {
+	id := strings.ToLower(op.Method)
+	for _, part := range strings.FieldsFunc(op.Path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '_' || r == '.'
+	}) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+func floatPtr(f float64) *float64 { return &f }
+
+func (h *Handler) GetOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(openAPISpec()); err != nil {
+		log.Printf("Error writing OpenAPI document: %v", err)
+	}
+}
+
+func (h *Handler) SwaggerUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write(swaggerHTML); err != nil {
+		log.Printf("Error writing Swagger UI: %v", err)
+	}
+}
+
+// SwaggerAsset serves a vendored Swagger UI file named by the last path
+// segment.
+func (h *Handler) SwaggerAsset(w http.ResponseWriter, r *http.Request) {
+	name := "swagger-ui/" + path.Base(r.URL.Path)
+	if _, err := fs.Stat(swaggerAssets, name); err != nil {
+		writeProblem(w, http.StatusNotFound, "Swagger UI assets are not vendored, run go generate ./internal/handlers")
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeFileFS(w, r, swaggerAssets, name)
+}
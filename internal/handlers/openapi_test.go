@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"myapp/internal/model/modeltest"
+
+	"github.com/gorilla/mux"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+type specDocument struct {
+	Paths map[string]map[string]struct {
+		Responses map[string]struct {
+			Content map[string]struct {
+				Schema struct {
+					Ref string `json:"$ref"`
+				} `json:"schema"`
+			} `json:"content"`
+		} `json:"responses"`
+	} `json:"paths"`
+}
+
+func loadSpec(t *testing.T, r *mux.Router) ([]byte, specDocument) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for the OpenAPI document, got %d", rec.Code)
+	}
+	var spec specDocument
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("invalid OpenAPI json: %v", err)
+	}
+	return rec.Body.Bytes(), spec
+}
+
+func TestOpenAPI_CoversEveryRoute(t *testing.T) {
+	r := mux.NewRouter()
+	NewHandler(&fakeService{}).RegisterRoutes(r)
+	_, spec := loadSpec(t, r)
+
+	registered := map[string]bool{}
+	err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			key := strings.ToLower(method) + " " + path
+			registered[key] = true
+			if _, ok := spec.Paths[path][strings.ToLower(method)]; !ok {
+				t.Errorf("route %s %s is missing from the OpenAPI document", method, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to walk routes: %v", err)
+	}
+
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			if !registered[method+" "+path] {
+				t.Errorf("OpenAPI document describes %s %s, which is not registered", method, path)
+			}
+		}
+	}
+}
+
+func TestOpenAPI_ResponsesConform(t *testing.T) {
+	r := mux.NewRouter()
+	NewHandler(&fakeService{order: modeltest.Order()}).RegisterRoutes(r)
+	raw, spec := loadSpec(t, r)
+
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	if err := compiler.AddResource("openapi.json", bytes.NewReader(raw)); err != nil {
+		t.Fatalf("failed to load OpenAPI document: %v", err)
+	}
+
+	item, _ := json.Marshal(modeltest.Order().Items[0])
+	for _, tc := range []struct {
+		method, url, specPath, body string
+	}{
+		{"GET", "/api/v1/orders", "/api/v1/orders", ""},
+		{"GET", "/api/v1/orders/b563feb7b2b84b6test", "/api/v1/orders/{order_uid}", ""},
+		{"GET", "/order/b563feb7b2b84b6test", "/order/{order_uid}", ""},
+		{"POST", "/api/v1/orders", "/api/v1/orders", "{"},
+		{"POST", "/api/v1/orders/b563feb7b2b84b6test/status", "/api/v1/orders/{order_uid}/status", `{"status":"paid"}`},
+		{"POST", "/api/v1/orders/b563feb7b2b84b6test/restore", "/api/v1/orders/{order_uid}/restore", ""},
+		{"GET", "/api/v1/orders/b563feb7b2b84b6test/history", "/api/v1/orders/{order_uid}/history", ""},
+		{"GET", "/api/v1/orders/b563feb7b2b84b6test/items", "/api/v1/orders/{order_uid}/items", ""},
+		{"POST", "/api/v1/orders/b563feb7b2b84b6test/items", "/api/v1/orders/{order_uid}/items", string(item)},
+		{"GET", "/api/v1/orders/b563feb7b2b84b6test/items/ab4219087a764ae0btest", "/api/v1/orders/{order_uid}/items/{rid}", ""},
+		{"GET", "/api/v1/orders/b563feb7b2b84b6test/items/missing", "/api/v1/orders/{order_uid}/items/{rid}", ""},
+		{"GET", "/api/v1/cache/stats", "/api/v1/cache/stats", ""},
+		{"POST", "/api/v1/cache/warmup", "/api/v1/cache/warmup", ""},
+		{"GET", "/health", "/health", ""},
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body)))
+
+		response, ok := spec.Paths[tc.specPath][strings.ToLower(tc.method)].Responses[strconv.Itoa(rec.Code)]
+		if !ok {
+			t.Errorf("%s %s: status %d is not documented", tc.method, tc.url, rec.Code)
+			continue
+		}
+		mediaType := strings.TrimSpace(strings.SplitN(rec.Header().Get("Content-Type"), ";", 2)[0])
+		content, ok := response.Content[mediaType]
+		if !ok {
+			t.Errorf("%s %s: content type %q is not documented for %d", tc.method, tc.url, mediaType, rec.Code)
+			continue
+		}
+
+		compiled, err := compiler.Compile("openapi.json" + content.Schema.Ref)
+		if err != nil {
+			t.Fatalf("failed to compile %s: %v", content.Schema.Ref, err)
+		}
+		var body interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s %s: invalid json: %v", tc.method, tc.url, err)
+		}
+		if err := compiled.Validate(body); err != nil {
+			t.Errorf("%s %s: response does not match %s: %v", tc.method, tc.url, content.Schema.Ref, err)
+		}
+	}
+}
+
+func TestSwaggerUI_ServesLocalAssets(t *testing.T) {
+	r := mux.NewRouter()
+	NewHandler(&fakeService{}).RegisterRoutes(r)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/docs", nil))
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "://") {
+		t.Fatalf("expected a page without third-party assets, got %d:\n%s", rec.Code, rec.Body.String())
+	}
+
+	for file, contentType := range map[string]string{
+		"swagger-ui.css":       "text/css",
+		"swagger-ui-bundle.js": "text/javascript",
+	} {
+		if !strings.Contains(rec.Body.String(), `"/api/v1/docs/`+file+`"`) {
+			t.Errorf("page does not load %s", file)
+		}
+
+		asset := httptest.NewRecorder()
+		r.ServeHTTP(asset, httptest.NewRequest(http.MethodGet, "/api/v1/docs/"+file, nil))
+		want, wantType := http.StatusOK, contentType
+		if _, err := fs.Stat(swaggerAssets, "swagger-ui/"+file); err != nil {
+			want, wantType = http.StatusNotFound, "application/problem+json"
+		}
+		if asset.Code != want || !strings.HasPrefix(asset.Header().Get("Content-Type"), wantType) {
+			t.Errorf("%s: expected %d %s, got %d %s", file, want, wantType, asset.Code, asset.Header().Get("Content-Type"))
+		}
+	}
+}
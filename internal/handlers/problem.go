@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"myapp/internal/decode"
+	"myapp/internal/validation"
+	"net/http"
+)
+
+// Problem types beyond the status code, as absolute URIs that do not depend
+// on the host serving the API. Other problems use about:blank, where the
+// title is the HTTP status text.
+const (
+	problemTypeValidation  = "urn:problem-type:validation-error"
+	problemTypeInvalidBody = "urn:problem-type:invalid-body"
+)
+
+// Problem is an RFC 7807 problem details object. Errors lists the offending
+// fields when the request body was rejected.
+type Problem struct {
+	Type   string                 `json:"type"`
+	Title  string                 `json:"title"`
+	Status int                    `json:"status"`
+	Detail string                 `json:"detail,omitempty"`
+	Errors []validation.Violation `json:"errors,omitempty"`
+}
+
+func writeProblem(w http.ResponseWriter, status int, detail string) {
+	sendProblem(w, Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	})
+}
+
+// writeValidationProblem reports a struct tag or business rule failure with
+// one entry per offending field.
+func writeValidationProblem(w http.ResponseWriter, err error) {
+	sendProblem(w, Problem{
+		Type:   problemTypeValidation,
+		Title:  "Order validation failed",
+		Status: http.StatusUnprocessableEntity,
+		Detail: "The request body is well-formed but breaks validation rules.",
+		Errors: validation.Violations(err),
+	})
+}
+
+// writeDecodeProblem reports a request body that is not valid JSON, does not
+// fit the expected types or exceeds the decoding limits.
+func writeDecodeProblem(w http.ResponseWriter, err error) {
+	problem := Problem{
+		Type:   problemTypeInvalidBody,
+		Title:  "Invalid request body",
+		Status: http.StatusBadRequest,
+		Detail: err.Error(),
+	}
+
+	var decodeErr *decode.Error
+	if errors.As(err, &decodeErr) {
+		problem.Detail = "Request body " + decodeErr.Message + "."
+		if decodeErr.Field != "" {
+			problem.Detail = "A field in the request body is invalid."
+			problem.Errors = []validation.Violation{{Rule: decodeErr.Rule, Field: decodeErr.Field, Message: decodeErr.Message}}
+		}
+		if decodeErr.Rule == decode.RuleBodySize {
+			problem.Status = http.StatusRequestEntityTooLarge
+		}
+	}
+	sendProblem(w, problem)
+}
+
+func sendProblem(w http.ResponseWriter, problem Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		log.Printf("Error encoding problem: %v", err)
+	}
+}
+
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, http.StatusNotFound, "No route matches "+r.URL.Path)
+}
+
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, http.StatusMethodNotAllowed, r.Method+" is not supported for "+r.URL.Path)
+}
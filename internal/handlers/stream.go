@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"myapp/internal/model"
+	"myapp/internal/service"
+	"myapp/internal/stream"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// streamHeartbeat keeps idle stream connections open through proxies.
+	streamHeartbeat = 15 * time.Second
+	// streamRetry is the reconnection delay suggested to EventSource clients.
+	streamRetry = 3 * time.Second
+	// wsWriteTimeout bounds a single WebSocket write to a stalled client.
+	wsWriteTimeout = 10 * time.Second
+)
+
+var streamEventTypes = map[model.OrderEventType]bool{
+	model.EventCreated:       true,
+	model.EventUpdated:       true,
+	model.EventDeleted:       true,
+	model.EventRestored:      true,
+	model.EventPurged:        true,
+	model.EventStatusChanged: true,
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// WithBroker enables the order change streams.
+func WithBroker(b *stream.Broker) Option {
+	return func(h *Handler) {
+		h.broker = b
+	}
+}
+
+// StreamOrders pushes order events as Server-Sent Events. Each event carries
+// its audit log ID, so an EventSource reconnecting with Last-Event-ID
+// receives what it missed before live events resume.
+func (h *Handler) StreamOrders(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeProblem(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+	sub, ok := h.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+	flusher.Flush()
+
+	err := followStream(r.Context(), sub, func(event *model.OrderEvent) error {
+		if event == nil {
+			_, err := fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+			return err
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, stream.ErrClosed) {
+		log.Printf("Order stream closed: %v", err)
+	}
+}
+
+// StreamOrdersWS pushes the same events as StreamOrders as WebSocket text
+// messages, one OrderEvent per message. Browsers cannot set Last-Event-ID
+// on a WebSocket, so resumption uses the last_event_id query parameter.
+func (h *Handler) StreamOrdersWS(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// The request context outlives a hijacked connection, so a read loop
+	// detects the client going away. Incoming messages are ignored.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	err = followStream(ctx, sub, func(event *model.OrderEvent) error {
+		deadline := time.Now().Add(wsWriteTimeout)
+		if event == nil {
+			return conn.WriteControl(websocket.PingMessage, nil, deadline)
+		}
+		if err := conn.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+		return conn.WriteJSON(event)
+	})
+	var closeCode int
+	switch {
+	case errors.Is(err, stream.ErrSlowConsumer):
+		closeCode = websocket.CloseTryAgainLater
+	case errors.Is(err, stream.ErrClosed):
+		closeCode = websocket.CloseGoingAway
+	}
+	if closeCode != 0 {
+		message := websocket.FormatCloseMessage(closeCode, err.Error())
+		if err := conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(wsWriteTimeout)); err != nil {
+			log.Printf("Error closing WebSocket: %v", err)
+		}
+	}
+	if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, stream.ErrClosed) {
+		log.Printf("Order WebSocket closed: %v", err)
+	}
+}
+
+// subscribe parses the stream filter and resume point and registers a
+// subscription, writing a problem if either fails.
+func (h *Handler) subscribe(w http.ResponseWriter, r *http.Request) (*stream.Subscription, bool) {
+	if h.broker == nil {
+		writeProblem(w, http.StatusServiceUnavailable, "Order stream is disabled")
+		return nil, false
+	}
+
+	query := r.URL.Query()
+	filter := stream.Filter{
+		CustomerID:      query.Get("customer_id"),
+		DeliveryService: query.Get("delivery_service"),
+	}
+	if types := query.Get("type"); types != "" {
+		for _, name := range strings.Split(types, ",") {
+			eventType := model.OrderEventType(strings.TrimSpace(name))
+			if !streamEventTypes[eventType] {
+				writeProblem(w, http.StatusBadRequest, fmt.Sprintf("Unknown event type %q", name))
+				return nil, false
+			}
+			filter.Types = append(filter.Types, eventType)
+		}
+	}
+
+	var lastEventID int64
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = query.Get("last_event_id")
+	}
+	if raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id < 0 {
+			writeProblem(w, http.StatusBadRequest, "Last-Event-ID must be a non-negative integer")
+			return nil, false
+		}
+		lastEventID = id
+	}
+
+	sub, err := h.broker.Subscribe(r.Context(), filter, lastEventID)
+	if errors.Is(err, service.ErrEventNotFound) {
+		writeProblem(w, http.StatusBadRequest, "Last-Event-ID does not match any order event")
+		return nil, false
+	}
+	if err != nil && !errors.Is(err, stream.ErrUnavailable) && !errors.Is(err, stream.ErrClosed) {
+		log.Printf("Failed to subscribe to order stream: %v", err)
+		writeProblem(w, http.StatusInternalServerError, "Failed to open order stream")
+		return nil, false
+	}
+	if err != nil {
+		detail := "Order stream is starting up"
+		if errors.Is(err, stream.ErrClosed) {
+			detail = "Order stream is shutting down"
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(streamRetry.Seconds())))
+		writeProblem(w, http.StatusServiceUnavailable, detail)
+		return nil, false
+	}
+	return sub, true
+}
+
+// followStream hands each event of sub to send, and nil every
+// streamHeartbeat while there are none, until ctx is done or send fails.
+func followStream(ctx context.Context, sub *stream.Subscription, send func(*model.OrderEvent) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events := make(chan model.OrderEvent)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			event, err := sub.Next(ctx)
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			if err := send(&event); err != nil {
+				return err
+			}
+		case <-heartbeat.C:
+			if err := send(nil); err != nil {
+				return err
+			}
+		case err := <-errs:
+			return err
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"myapp/internal/model"
+	"myapp/internal/stream"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+func TestStreamOrders_ResumesFromLastEventID(t *testing.T) {
+	fs := &fakeService{events: []model.OrderEvent{
+		{ID: 1, OrderUID: "uid1", Type: model.EventCreated, After: []byte(`{"customer_id":"c1"}`)},
+		{ID: 2, OrderUID: "uid2", Type: model.EventCreated, After: []byte(`{"customer_id":"c2"}`)},
+		{ID: 3, OrderUID: "uid1", Type: model.EventDeleted, Before: []byte(`{"customer_id":"c1"}`)},
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := stream.NewBroker(fs, 10*time.Millisecond)
+	go broker.Run(ctx)
+
+	r := mux.NewRouter()
+	NewHandler(fs, WithBroker(broker)).RegisterRoutes(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	var resp *http.Response
+	for deadline := time.Now().Add(time.Second); ; {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/orders/stream?customer_id=c1", nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req.Header.Set("Last-Event-ID", "1")
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("stream request: %v", err)
+		}
+		if resp.StatusCode != http.StatusServiceUnavailable || time.Now().After(deadline) {
+			break
+		}
+		resp.Body.Close()
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() && !strings.HasPrefix(scanner.Text(), "data: ") {
+		lines = append(lines, scanner.Text())
+	}
+	got := strings.Join(lines, "\n")
+	if !strings.Contains(got, "id: 3\nevent: deleted") {
+		t.Fatalf("expected replayed event 3 for customer c1, got:\n%s", got)
+	}
+}
+
+func TestStreamOrdersWS_ReplaysEvents(t *testing.T) {
+	fs := &fakeService{events: []model.OrderEvent{
+		{ID: 1, OrderUID: "uid1", Type: model.EventCreated},
+		{ID: 2, OrderUID: "uid1", Type: model.EventStatusChanged},
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := stream.NewBroker(fs, 10*time.Millisecond)
+	go broker.Run(ctx)
+
+	r := mux.NewRouter()
+	NewHandler(fs, WithBroker(broker)).RegisterRoutes(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/orders/stream/ws?last_event_id=1"
+	var conn *websocket.Conn
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		var (
+			resp *http.Response
+			err  error
+		)
+		conn, resp, err = websocket.DefaultDialer.Dial(url, nil)
+		if err == nil {
+			break
+		}
+		if resp == nil || resp.StatusCode != http.StatusServiceUnavailable || time.Now().After(deadline) {
+			t.Fatalf("dial: %v", err)
+		}
+	}
+	defer conn.Close()
+
+	var event model.OrderEvent
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("read event: %v", err)
+	}
+	if event.ID != 2 || event.Type != model.EventStatusChanged {
+		t.Fatalf("expected replayed event 2, got %+v", event)
+	}
+}
+
+func TestStreamOrders_RejectsUnknownType(t *testing.T) {
+	r := mux.NewRouter()
+	NewHandler(&fakeService{}, WithBroker(stream.NewBroker(&fakeService{}, time.Hour))).RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/orders/stream?type=created,shipped", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestStreamOrders_RejectsUnknownLastEventID(t *testing.T) {
+	fs := &fakeService{events: []model.OrderEvent{{ID: 1, OrderUID: "uid1", Type: model.EventCreated}}}
+	r := mux.NewRouter()
+	NewHandler(fs, WithBroker(stream.NewBroker(fs, time.Hour))).RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/orders/stream", nil)
+	req.Header.Set("Last-Event-ID", "9")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"myapp/internal/model"
+	"myapp/internal/service"
+	"myapp/internal/validation"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+)
+
+// WithWebhooks enables the webhook subscription endpoints.
+func WithWebhooks(s service.WebhookService) Option {
+	return func(h *Handler) {
+		h.webhooks = s
+	}
+}
+
+// webhookRequest is the body of webhook create and replace requests. A
+// missing secret is generated on create and kept on replace; a missing
+// active flag keeps the current state.
+type webhookRequest struct {
+	URL        string                 `json:"url"`
+	Secret     string                 `json:"secret"`
+	EventTypes []model.OrderEventType `json:"event_types"`
+	Active     *bool                  `json:"active"`
+}
+
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	if !h.webhooksEnabled(w) {
+		return
+	}
+	var req webhookRequest
+	if err := h.decoder.DecodeRequest(w, r, &req); err != nil {
+		writeDecodeProblem(w, err)
+		return
+	}
+
+	webhook := &model.Webhook{URL: req.URL, Secret: req.Secret, EventTypes: req.EventTypes}
+	if err := h.webhooks.CreateWebhook(r.Context(), webhook); err != nil {
+		writeWebhookError(w, err, "Error creating webhook")
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/webhooks/"+strconv.FormatInt(webhook.ID, 10))
+	writeWebhookJSON(w, http.StatusCreated, webhook)
+}
+
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	if !h.webhooksEnabled(w) {
+		return
+	}
+	webhooks, err := h.webhooks.ListWebhooks(r.Context())
+	if err != nil {
+		writeWebhookError(w, err, "Error listing webhooks")
+		return
+	}
+	writeWebhookJSON(w, http.StatusOK, map[string]interface{}{"webhooks": webhooks})
+}
+
+func (h *Handler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.webhookID(w, r)
+	if !ok {
+		return
+	}
+	webhook, err := h.webhooks.GetWebhook(r.Context(), id)
+	if err != nil {
+		writeWebhookError(w, err, "Error getting webhook")
+		return
+	}
+	writeWebhookJSON(w, http.StatusOK, webhook)
+}
+
+func (h *Handler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.webhookID(w, r)
+	if !ok {
+		return
+	}
+	var req webhookRequest
+	if err := h.decoder.DecodeRequest(w, r, &req); err != nil {
+		writeDecodeProblem(w, err)
+		return
+	}
+
+	var active bool
+	if req.Active != nil {
+		active = *req.Active
+	} else {
+		current, err := h.webhooks.GetWebhook(r.Context(), id)
+		if err != nil {
+			writeWebhookError(w, err, "Error getting webhook")
+			return
+		}
+		active = current.Active
+	}
+
+	webhook := &model.Webhook{ID: id, URL: req.URL, Secret: req.Secret, EventTypes: req.EventTypes, Active: active}
+	if err := h.webhooks.UpdateWebhook(r.Context(), webhook); err != nil {
+		writeWebhookError(w, err, "Error updating webhook")
+		return
+	}
+	writeWebhookJSON(w, http.StatusOK, webhook)
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.webhookID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.webhooks.DeleteWebhook(r.Context(), id); err != nil {
+		writeWebhookError(w, err, "Error deleting webhook")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries returns the delivery log of a webhook, newest first.
+func (h *Handler) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	limit := defaultDeliveriesLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		l, err := strconv.Atoi(raw)
+		if err != nil || l < 1 || l > maxDeliveriesLimit {
+			writeProblem(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxDeliveriesLimit))
+			return
+		}
+		limit = l
+	}
+
+	deliveries, err := h.webhooks.GetWebhookDeliveries(r.Context(), id, limit)
+	if err != nil {
+		writeWebhookError(w, err, "Error getting webhook deliveries")
+		return
+	}
+	writeWebhookJSON(w, http.StatusOK, map[string]interface{}{"webhook_id": id, "deliveries": deliveries})
+}
+
+func (h *Handler) webhooksEnabled(w http.ResponseWriter) bool {
+	if h.webhooks == nil {
+		writeProblem(w, http.StatusServiceUnavailable, "Webhooks are disabled")
+		return false
+	}
+	return true
+}
+
+func (h *Handler) webhookID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	if !h.webhooksEnabled(w) {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id < 1 {
+		writeProblem(w, http.StatusBadRequest, "Webhook id must be a positive integer")
+		return 0, false
+	}
+	return id, true
+}
+
+func writeWebhookJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding webhook response: %v", err)
+	}
+}
+
+func writeWebhookError(w http.ResponseWriter, err error, message string) {
+	log.Printf("%s: %v", message, err)
+	switch {
+	case errors.Is(err, service.ErrWebhookNotFound):
+		writeProblem(w, http.StatusNotFound, "Webhook not found")
+	case validation.IsValidationError(err):
+		sendProblem(w, Problem{
+			Type:   problemTypeValidation,
+			Title:  "Webhook validation failed",
+			Status: http.StatusUnprocessableEntity,
+			Detail: "The request body is well-formed but breaks validation rules.",
+			Errors: validation.Violations(err),
+		})
+	default:
+		writeProblem(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
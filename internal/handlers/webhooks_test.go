@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"myapp/internal/model"
+	"myapp/internal/service"
+	"myapp/internal/validation"
+
+	"github.com/gorilla/mux"
+)
+
+// fakeWebhooks keeps webhooks in memory; the embedded interface panics on
+// calls the handlers do not make.
+type fakeWebhooks struct {
+	service.WebhookService
+	webhooks map[int64]*model.Webhook
+	err      error
+}
+
+func (f *fakeWebhooks) CreateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	if f.err != nil {
+		return f.err
+	}
+	webhook.ID = int64(len(f.webhooks) + 1)
+	webhook.Active = true
+	if webhook.Secret == "" {
+		webhook.Secret = "generated-secret-value"
+	}
+	stored := *webhook
+	f.webhooks[webhook.ID] = &stored
+	return nil
+}
+
+func (f *fakeWebhooks) GetWebhook(ctx context.Context, id int64) (*model.Webhook, error) {
+	webhook, ok := f.webhooks[id]
+	if !ok {
+		return nil, fmt.Errorf("failed to get webhook: %w", service.ErrWebhookNotFound)
+	}
+	copied := *webhook
+	copied.Secret = ""
+	return &copied, nil
+}
+
+func (f *fakeWebhooks) UpdateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	stored, ok := f.webhooks[webhook.ID]
+	if !ok {
+		return service.ErrWebhookNotFound
+	}
+	if webhook.Secret == "" {
+		webhook.Secret = stored.Secret
+	}
+	updated := *webhook
+	f.webhooks[webhook.ID] = &updated
+	webhook.Secret = ""
+	return nil
+}
+
+func serveWebhooks(f *fakeWebhooks, method, target, body string) *httptest.ResponseRecorder {
+	r := mux.NewRouter()
+	NewHandler(&fakeService{}, WithWebhooks(f)).RegisterRoutes(r)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec
+}
+
+func TestWebhooks_CreateReturnsSecretOnce(t *testing.T) {
+	f := &fakeWebhooks{webhooks: map[int64]*model.Webhook{}}
+
+	rec := serveWebhooks(f, http.MethodPost, "/api/v1/webhooks",
+		`{"url":"https://example.com/hook","event_types":["created"]}`)
+	if rec.Code != http.StatusCreated || rec.Header().Get("Location") != "/api/v1/webhooks/1" {
+		t.Fatalf("expected 201 with Location, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	var created model.Webhook
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || created.Secret == "" {
+		t.Fatalf("expected the secret in the create response, got %s", rec.Body.String())
+	}
+
+	rec = serveWebhooks(f, http.MethodGet, "/api/v1/webhooks/1", "")
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), `"secret"`) {
+		t.Fatalf("expected webhook without secret, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestWebhooks_UpdateKeepsActiveWhenOmitted(t *testing.T) {
+	f := &fakeWebhooks{webhooks: map[int64]*model.Webhook{
+		1: {ID: 1, URL: "https://example.com/hook", Secret: "stored-secret-value", Active: false,
+			EventTypes: []model.OrderEventType{model.EventCreated}},
+	}}
+
+	rec := serveWebhooks(f, http.MethodPut, "/api/v1/webhooks/1",
+		`{"url":"https://example.com/other","event_types":["deleted"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	stored := f.webhooks[1]
+	if stored.Active || stored.URL != "https://example.com/other" || stored.Secret != "stored-secret-value" {
+		t.Fatalf("unexpected stored webhook: %+v", stored)
+	}
+}
+
+func TestWebhooks_Errors(t *testing.T) {
+	invalid := &fakeWebhooks{err: fmt.Errorf("webhook validation failed: %w", &validation.ViolationsError{
+		Violations: []validation.Violation{{Rule: "http_url", Field: "url", Message: "must be an absolute http or https URL"}},
+	})}
+
+	tests := []struct {
+		name   string
+		fake   *fakeWebhooks
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{"invalid webhook", invalid, http.MethodPost, "/api/v1/webhooks", `{"url":"ftp://x","event_types":["created"]}`, http.StatusUnprocessableEntity},
+		{"unknown webhook", &fakeWebhooks{}, http.MethodGet, "/api/v1/webhooks/7", "", http.StatusNotFound},
+		{"bad id", &fakeWebhooks{}, http.MethodGet, "/api/v1/webhooks/abc", "", http.StatusBadRequest},
+		{"bad limit", &fakeWebhooks{}, http.MethodGet, "/api/v1/webhooks/1/deliveries?limit=0", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveWebhooks(tt.fake, tt.method, tt.target, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.status == http.StatusUnprocessableEntity && !strings.Contains(rec.Body.String(), `"field":"url"`) {
+				t.Fatalf("expected a url violation, got %s", rec.Body.String())
+			}
+		})
+	}
+}
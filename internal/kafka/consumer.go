@@ -6,8 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"myapp/internal/decode"
 	"myapp/internal/model"
+	"myapp/internal/schema"
 	"myapp/internal/service"
+	"myapp/internal/validation"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
@@ -16,11 +19,14 @@ import (
 )
 
 type Consumer struct {
-	consumer   *kafka.Consumer
-	service    service.Service
-	topic      string
-	dlq        *Producer
-	maxRetries int
+	consumer    *kafka.Consumer
+	service     service.Service
+	topic       string
+	statusTopic string
+	dlq         *Producer
+	decoder     *decode.Decoder
+	schema      *schema.Validator
+	maxRetries  int
 }
 
 func NewConsumer(brokers, groupID, topic string, service service.Service) (*Consumer, error) {
@@ -40,14 +46,19 @@ func NewConsumer(brokers, groupID, topic string, service service.Service) (*Cons
 		consumer:   consumer,
 		service:    service,
 		topic:      topic,
+		decoder:    decode.New(),
 		maxRetries: 3,
 	}, nil
 }
 
 func (c *Consumer) Start(ctx context.Context) error {
-	log.Printf("Starting Kafka consumer for topic: %s", c.topic)
+	topics := []string{c.topic}
+	if c.statusTopic != "" {
+		topics = append(topics, c.statusTopic)
+	}
+	log.Printf("Starting Kafka consumer for topics: %v", topics)
 
-	if err := c.consumer.Subscribe(c.topic, nil); err != nil {
+	if err := c.consumer.SubscribeTopics(topics, nil); err != nil {
 		return fmt.Errorf("failed to subscribe to topic: %w", err)
 	}
 
@@ -88,6 +99,20 @@ func (c *Consumer) SetDLQProducer(p *Producer) {
 	c.dlq = p
 }
 
+func (c *Consumer) SetStatusTopic(topic string) {
+	c.statusTopic = topic
+}
+
+func (c *Consumer) SetDecoder(d *decode.Decoder) {
+	c.decoder = d
+}
+
+// SetSchemaValidator makes the consumer check orders against the published
+// JSON Schema before decoding them.
+func (c *Consumer) SetSchemaValidator(v *schema.Validator) {
+	c.schema = v
+}
+
 func (c *Consumer) processMessage(msg *kafka.Message) error {
 	tracer := otel.Tracer("kafka")
 	ctx, span := tracer.Start(context.TODO(), "processMessage")
@@ -99,10 +124,34 @@ func (c *Consumer) processMessage(msg *kafka.Message) error {
 		return nil
 	}
 
+	actor := model.Actor{
+		Type:      model.ActorKafka,
+		Partition: msg.TopicPartition.Partition,
+		Offset:    int64(msg.TopicPartition.Offset),
+	}
+	if msg.TopicPartition.Topic != nil {
+		actor.Topic = *msg.TopicPartition.Topic
+	}
+	ctx = model.WithActor(ctx, actor)
+
+	if c.statusTopic != "" && actor.Topic == c.statusTopic {
+		return c.processStatusChange(ctx, msg)
+	}
+
+	if c.schema != nil {
+		if err := c.schema.Validate(msg.Value); err != nil {
+			log.Printf("Message does not match order schema %s: %v", c.schema.Version(), err)
+			span.SetStatus(codes.Error, err.Error())
+			c.sendToDLQ(msg, err)
+			return nil
+		}
+	}
+
 	var order model.Order
-	if err := json.Unmarshal(msg.Value, &order); err != nil {
-		log.Printf("Failed to unmarshal message: %v", err)
+	if err := c.decoder.Decode(msg.Value, &order); err != nil {
+		log.Printf("Failed to decode message: %v", err)
 		span.SetStatus(codes.Error, err.Error())
+		c.sendToDLQ(msg, err)
 		return nil
 	}
 
@@ -113,17 +162,59 @@ func (c *Consumer) processMessage(msg *kafka.Message) error {
 		return nil
 	}
 
-	if err := c.service.ProcessOrder(&order); err != nil {
+	ctx = model.WithIdempotencyKey(ctx, model.KafkaMessageKey(actor.Topic, actor.Partition, actor.Offset))
+	if err := c.service.ProcessOrder(ctx, &order); err != nil {
 		log.Printf("Failed to process order %s: %v", order.OrderUID, err)
 		span.SetStatus(codes.Error, err.Error())
+		if !rejected(err) {
+			return err
+		}
+		c.sendToDLQ(msg, err)
 		return nil
 	}
 
 	log.Printf("Successfully processed order: %s", order.OrderUID)
-	_ = ctx
 	return nil
 }
 
+func (c *Consumer) processStatusChange(ctx context.Context, msg *kafka.Message) error {
+	var change model.StatusChange
+	if err := c.decoder.Decode(msg.Value, &change); err != nil {
+		log.Printf("Failed to decode status change: %v", err)
+		c.sendToDLQ(msg, err)
+		return nil
+	}
+
+	if change.OrderUID == "" {
+		log.Printf("Order UID is empty, skipping status change")
+		return nil
+	}
+
+	if _, err := c.service.ChangeOrderStatus(ctx, &change); err != nil {
+		log.Printf("Failed to change status of order %s to %s: %v", change.OrderUID, change.Status, err)
+		if !rejected(err) {
+			return err
+		}
+		c.sendToDLQ(msg, err)
+		return nil
+	}
+
+	log.Printf("Successfully changed status of order %s to %s", change.OrderUID, change.Status)
+	return nil
+}
+
+// rejected reports whether err means the message itself is unacceptable, so
+// that retrying it cannot help and it goes straight to the DLQ. Any other
+// error, such as a database outage, is returned to processWithRetry.
+func rejected(err error) bool {
+	return validation.IsValidationError(err) ||
+		errors.Is(err, service.ErrNotFound) ||
+		errors.Is(err, service.ErrInvalidStatus) ||
+		errors.Is(err, service.ErrInvalidStatusTransition) ||
+		errors.Is(err, service.ErrDuplicateTransaction) ||
+		errors.Is(err, service.ErrVersionConflict)
+}
+
 func (c *Consumer) processWithRetry(msg *kafka.Message) error {
 	var err error
 	for attempt := 0; attempt < c.maxRetries; attempt++ {
@@ -132,20 +223,48 @@ func (c *Consumer) processWithRetry(msg *kafka.Message) error {
 		}
 		time.Sleep(time.Duration(200*(attempt+1)) * time.Millisecond)
 	}
-	if c.dlq != nil {
-		// Send to DLQ
-		if dlqErr := c.dlq.producer.Produce(&kafka.Message{
-			TopicPartition: kafka.TopicPartition{Topic: &c.dlq.topic, Partition: kafka.PartitionAny},
-			Value:          msg.Value,
-			Headers:        msg.Headers,
-		}, nil); dlqErr != nil {
-			log.Printf("Failed to write message to DLQ: %v", dlqErr)
-		} else {
-			c.dlq.producer.Flush(5000)
-			log.Printf("Message sent to DLQ topic %s", c.dlq.topic)
+	c.sendToDLQ(msg, err)
+	return err
+}
+
+// DLQ headers added to a parked message next to its original headers.
+const (
+	dlqErrorHeader      = "dlq-error"
+	dlqViolationsHeader = "dlq-violations"
+)
+
+// sendToDLQ parks a message that cannot be processed, such as one that fails
+// to decode, so that it is not lost. The cause goes along as a header, and
+// validation failures also carry their violations as JSON.
+func (c *Consumer) sendToDLQ(msg *kafka.Message, cause error) {
+	if c.dlq == nil {
+		return
+	}
+	if err := c.dlq.producer.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &c.dlq.topic, Partition: kafka.PartitionAny},
+		Key:            msg.Key,
+		Value:          msg.Value,
+		Headers:        dlqHeaders(msg, cause),
+	}, nil); err != nil {
+		log.Printf("Failed to write message to DLQ: %v", err)
+		return
+	}
+	c.dlq.producer.Flush(5000)
+	log.Printf("Message sent to DLQ topic %s", c.dlq.topic)
+}
+
+func dlqHeaders(msg *kafka.Message, cause error) []kafka.Header {
+	headers := append([]kafka.Header(nil), msg.Headers...)
+	if cause == nil {
+		return headers
+	}
+	headers = append(headers, kafka.Header{Key: dlqErrorHeader, Value: []byte(cause.Error())})
+	if violations := validation.Violations(cause); len(violations) > 0 {
+		if data, err := json.Marshal(violations); err == nil {
+			headers = append(headers, kafka.Header{Key: dlqViolationsHeader, Value: data})
 		}
 	}
-	return err
+	return headers
 }
 
 type Producer struct {
@@ -154,8 +273,11 @@ type Producer struct {
 }
 
 func NewProducer(brokers, topic string) (*Producer, error) {
+	// Idempotence keeps retried sends from reordering or duplicating
+	// messages within a partition.
 	config := &kafka.ConfigMap{
-		"bootstrap.servers": brokers,
+		"bootstrap.servers":  brokers,
+		"enable.idempotence": true,
 	}
 
 	producer, err := kafka.NewProducer(config)
@@ -189,6 +311,67 @@ func (p *Producer) SendOrder(order *model.Order) error {
 	return nil
 }
 
+func (p *Producer) SendStatusChange(change *model.StatusChange) error {
+	changeBytes, err := json.Marshal(change)
+	if err != nil {
+		return fmt.Errorf("failed to marshal status change: %w", err)
+	}
+
+	msg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &p.topic, Partition: kafka.PartitionAny},
+		Key:            []byte(change.OrderUID),
+		Value:          changeBytes,
+	}
+
+	if err := p.producer.Produce(msg, nil); err != nil {
+		return fmt.Errorf("failed to produce message: %w", err)
+	}
+
+	p.producer.Flush(15 * 1000)
+	log.Printf("Status change sent to topic %s", p.topic)
+	return nil
+}
+
+// Record is a message for SendRecords. Headers are sent as Kafka record
+// headers.
+type Record struct {
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+}
+
+// SendRecords produces records in order and waits until the broker has
+// acknowledged each of them, returning the first delivery error. On error
+// some records may still have been written.
+func (p *Producer) SendRecords(ctx context.Context, records []Record) error {
+	deliveries := make(chan kafka.Event, len(records))
+	for _, record := range records {
+		msg := &kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &p.topic, Partition: kafka.PartitionAny},
+			Key:            record.Key,
+			Value:          record.Value,
+		}
+		for key, value := range record.Headers {
+			msg.Headers = append(msg.Headers, kafka.Header{Key: key, Value: []byte(value)})
+		}
+		if err := p.producer.Produce(msg, deliveries); err != nil {
+			return fmt.Errorf("failed to produce message: %w", err)
+		}
+	}
+
+	for range records {
+		select {
+		case event := <-deliveries:
+			if msg, ok := event.(*kafka.Message); ok && msg.TopicPartition.Error != nil {
+				return fmt.Errorf("failed to deliver message: %w", msg.TopicPartition.Error)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
 func (p *Producer) Close() error {
 	p.producer.Close()
 	return nil
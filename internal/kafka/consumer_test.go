@@ -0,0 +1,89 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"myapp/internal/decode"
+	"myapp/internal/model"
+	"myapp/internal/service"
+	"myapp/internal/validation"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// fakeService implements the calls the consumer makes; the embedded
+// interface panics on anything else.
+type fakeService struct {
+	service.Service
+	err error
+}
+
+func (f *fakeService) ProcessOrder(ctx context.Context, order *model.Order) error {
+	return f.err
+}
+
+func (f *fakeService) ChangeOrderStatus(ctx context.Context, change *model.StatusChange) (*model.Order, error) {
+	return nil, f.err
+}
+
+func message(topic, value string) *kafka.Message {
+	return &kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic}, Value: []byte(value)}
+}
+
+func TestProcessMessage_RetriesOnlyTransientErrors(t *testing.T) {
+	order := message("orders", `{"order_uid":"u1"}`)
+	change := message("statuses", `{"order_uid":"u1","status":"paid"}`)
+
+	for _, tc := range []struct {
+		name      string
+		msg       *kafka.Message
+		err       error
+		wantRetry bool
+	}{
+		{name: "order saved", msg: order},
+		{name: "order hits outage", msg: order, err: errors.New("connection refused"), wantRetry: true},
+		{name: "order breaks rules", msg: order, err: fmt.Errorf("order validation failed: %w", &validation.ViolationsError{
+			Violations: []validation.Violation{{Rule: "goods_total", Field: "payment.goods_total", Message: "does not match items"}}})},
+		{name: "order reuses transaction", msg: order, err: fmt.Errorf("failed to save order: %w", service.ErrDuplicateTransaction)},
+		{name: "order based on stale version", msg: order, err: fmt.Errorf("failed to save order: %w", service.ErrVersionConflict)},
+		{name: "status changed", msg: change},
+		{name: "status hits outage", msg: change, err: errors.New("connection refused"), wantRetry: true},
+		{name: "status raced", msg: change, err: fmt.Errorf("failed to update order status: %w", service.ErrStatusConflict), wantRetry: true},
+		{name: "status transition invalid", msg: change, err: fmt.Errorf("%w: shipped -> paid", service.ErrInvalidStatusTransition)},
+		{name: "status of unknown order", msg: change, err: fmt.Errorf("failed to get order: %w", service.ErrNotFound)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Consumer{service: &fakeService{err: tc.err}, topic: "orders", statusTopic: "statuses", decoder: decode.New()}
+			err := c.processMessage(tc.msg)
+			if (err != nil) != tc.wantRetry {
+				t.Fatalf("processMessage error = %v, want retry %v", err, tc.wantRetry)
+			}
+		})
+	}
+}
+
+func TestDLQHeaders_CarryCauseAndViolations(t *testing.T) {
+	msg := message("orders", "{}")
+	msg.Headers = []kafka.Header{{Key: "source", Value: []byte("load")}}
+	cause := fmt.Errorf("order validation failed: %w", &validation.ViolationsError{
+		Violations: []validation.Violation{{Rule: "goods_total", Field: "payment.goods_total", Message: "does not match items"}}})
+
+	headers := map[string]string{}
+	for _, h := range dlqHeaders(msg, cause) {
+		headers[h.Key] = string(h.Value)
+	}
+	if headers["source"] != "load" || headers[dlqErrorHeader] != cause.Error() {
+		t.Fatalf("unexpected headers: %v", headers)
+	}
+	want := `[{"rule":"goods_total","field":"payment.goods_total","message":"does not match items"}]`
+	if headers[dlqViolationsHeader] != want {
+		t.Fatalf("expected violations %s, got %s", want, headers[dlqViolationsHeader])
+	}
+
+	if got := dlqHeaders(msg, errors.New("invalid JSON")); len(got) != 2 {
+		t.Fatalf("expected the original header and the cause, got %v", got)
+	}
+}
@@ -0,0 +1,34 @@
+package model
+
+import "context"
+
+const (
+	ActorSystem  = "system"
+	ActorHTTP    = "http"
+	ActorKafka   = "kafka"
+	ActorGRPC    = "grpc"
+	ActorGraphQL = "graphql"
+	ActorCLI     = "cli"
+)
+
+type Actor struct {
+	Type       string `json:"type"`
+	Client     string `json:"client,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	Topic      string `json:"topic,omitempty"`
+	Partition  int32  `json:"partition,omitempty"`
+	Offset     int64  `json:"offset,omitempty"`
+}
+
+type actorKey struct{}
+
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func ActorFromContext(ctx context.Context) Actor {
+	if actor, ok := ctx.Value(actorKey{}).(Actor); ok {
+		return actor
+	}
+	return Actor{Type: ActorSystem}
+}
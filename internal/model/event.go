@@ -0,0 +1,56 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type OrderEventType string
+
+const (
+	EventCreated       OrderEventType = "created"
+	EventUpdated       OrderEventType = "updated"
+	EventDeleted       OrderEventType = "deleted"
+	EventRestored      OrderEventType = "restored"
+	EventPurged        OrderEventType = "purged"
+	EventStatusChanged OrderEventType = "status_changed"
+)
+
+type OrderEvent struct {
+	ID        int64           `json:"id"`
+	XID       uint64          `json:"-"`
+	OrderUID  string          `json:"order_uid"`
+	Type      OrderEventType  `json:"type"`
+	Actor     Actor           `json:"actor"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	Diff      []FieldChange   `json:"diff,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Position is where the event sits in the order change streams follow.
+func (e OrderEvent) Position() EventPosition {
+	return EventPosition{XID: e.XID, ID: e.ID}
+}
+
+// EventPosition orders the audit log by the transaction that wrote each
+// event, then by event ID. Unlike IDs alone, this order never places an
+// event before one that was already read once its transaction has finished.
+type EventPosition struct {
+	XID uint64
+	ID  int64
+}
+
+// Before reports whether p comes before q.
+func (p EventPosition) Before(q EventPosition) bool {
+	if p.XID != q.XID {
+		return p.XID < q.XID
+	}
+	return p.ID < q.ID
+}
+
+type FieldChange struct {
+	Path string      `json:"path"`
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"context"
+	"fmt"
+)
+
+type (
+	idempotencyKey struct{}
+	requestHashKey struct{}
+)
+
+// WithIdempotencyKey marks the request carried by ctx with a key that must be
+// processed at most once, such as a Kafka message position or an HTTP
+// Idempotency-Key header.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+func IdempotencyKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idempotencyKey{}).(string)
+	return key, ok && key != ""
+}
+
+// WithRequestHash records a digest of the request an idempotency key comes
+// with, so a key reused for a different request can be told apart from a
+// replay.
+func WithRequestHash(ctx context.Context, hash string) context.Context {
+	return context.WithValue(ctx, requestHashKey{}, hash)
+}
+
+func RequestHashFromContext(ctx context.Context) string {
+	hash, _ := ctx.Value(requestHashKey{}).(string)
+	return hash
+}
+
+func KafkaMessageKey(topic string, partition int32, offset int64) string {
+	return fmt.Sprintf("kafka:%s:%d:%d", topic, partition, offset)
+}
+
+func HTTPIdempotencyKey(key string) string {
+	return "http:" + key
+}
+
+func PaymentTransactionKey(transaction string) string {
+	return "transaction:" + transaction
+}
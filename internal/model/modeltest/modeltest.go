@@ -0,0 +1,27 @@
+// Package modeltest provides order fixtures shared by tests in other packages.
+package modeltest
+
+import (
+	"time"
+
+	"myapp/internal/model"
+)
+
+// Order returns a new copy of the sample order from the README, valid under
+// the default validation rules. Callers may modify it freely.
+func Order() *model.Order {
+	return &model.Order{
+		OrderUID:        "b563feb7b2b84b6test",
+		TrackNumber:     "WBILMTESTTRACK",
+		Entry:           "WBIL",
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		Status:          model.StatusCreated,
+		Version:         1,
+		Delivery:        model.Delivery{Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin", Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com"},
+		Payment:         model.Payment{Transaction: "b563feb7b2b84b6test", Currency: "USD", Provider: "wbpay", Amount: 1817, PaymentDT: 1637907727, Bank: "alpha", DeliveryCost: 1500, GoodsTotal: 317},
+		Items:           []model.Item{{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, RID: "ab4219087a764ae0btest", Name: "Mascaras", Sale: 30, Size: "0", TotalPrice: 317, NMID: 2389212, Brand: "Vivienne Sabo", Status: 202}},
+	}
+}
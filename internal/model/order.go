@@ -1,24 +1,28 @@
 package model
 
 import (
+	"reflect"
 	"time"
 )
 
 type Order struct {
-	OrderUID          string    `json:"order_uid" db:"order_uid" validate:"required,alphanumunicode,min=4,max=255"`
-	TrackNumber       string    `json:"track_number" db:"track_number" validate:"required,min=3,max=255"`
-	Entry             string    `json:"entry" db:"entry" validate:"required,min=2,max=255"`
-	Delivery          Delivery  `json:"delivery" db:"delivery" validate:"required"`
-	Payment           Payment   `json:"payment" db:"payment" validate:"required"`
-	Items             []Item    `json:"items" db:"items" validate:"required,min=1,dive"`
-	Locale            string    `json:"locale" db:"locale" validate:"required,len=2|len=5"`
-	InternalSignature string    `json:"internal_signature" db:"internal_signature"`
-	CustomerID        string    `json:"customer_id" db:"customer_id" validate:"required,min=1,max=255"`
-	DeliveryService   string    `json:"delivery_service" db:"delivery_service" validate:"required,min=2,max=255"`
-	ShardKey          string    `json:"shardkey" db:"shardkey" validate:"omitempty,max=10"`
-	SMID              int       `json:"sm_id" db:"sm_id" validate:"gte=0"`
-	DateCreated       time.Time `json:"date_created" db:"date_created"`
-	OOFShard          string    `json:"oof_shard" db:"oof_shard" validate:"omitempty,max=10"`
+	OrderUID          string      `json:"order_uid" db:"order_uid" validate:"required,alphanumunicode,min=4,max=255"`
+	TrackNumber       string      `json:"track_number" db:"track_number" validate:"required,min=3,max=255"`
+	Entry             string      `json:"entry" db:"entry" validate:"required,min=2,max=255"`
+	Delivery          Delivery    `json:"delivery" db:"delivery" validate:"required"`
+	Payment           Payment     `json:"payment" db:"payment" validate:"required"`
+	Items             []Item      `json:"items" db:"items" validate:"required,min=1,dive"`
+	Locale            string      `json:"locale" db:"locale" validate:"required,len=2|len=5"`
+	InternalSignature string      `json:"internal_signature" db:"internal_signature"`
+	CustomerID        string      `json:"customer_id" db:"customer_id" validate:"required,min=1,max=255"`
+	DeliveryService   string      `json:"delivery_service" db:"delivery_service" validate:"required,min=2,max=255"`
+	ShardKey          string      `json:"shardkey" db:"shardkey" validate:"omitempty,max=10"`
+	SMID              int         `json:"sm_id" db:"sm_id" validate:"gte=0"`
+	DateCreated       time.Time   `json:"date_created" db:"date_created"`
+	OOFShard          string      `json:"oof_shard" db:"oof_shard" validate:"omitempty,max=10"`
+	Status            OrderStatus `json:"status" db:"status" validate:"omitempty,oneof=created paid assembling shipped delivered cancelled returned"`
+	DeletedAt         *time.Time  `json:"deleted_at,omitempty" db:"deleted_at"`
+	Version           int64       `json:"version,omitempty" db:"version" validate:"gte=0"`
 }
 
 type Delivery struct {
@@ -57,3 +61,74 @@ type Item struct {
 	Brand       string `json:"brand" db:"brand" validate:"required,min=1"`
 	Status      int    `json:"status" db:"status" validate:"required"`
 }
+
+func (o *Order) Clone() *Order {
+	if o == nil {
+		return nil
+	}
+	clone := *o
+	if o.DeletedAt != nil {
+		deletedAt := *o.DeletedAt
+		clone.DeletedAt = &deletedAt
+	}
+	if o.Items != nil {
+		clone.Items = make([]Item, len(o.Items))
+		copy(clone.Items, o.Items)
+	}
+	return &clone
+}
+
+// Item returns the item with the given RID.
+func (o *Order) Item(rid string) (*Item, bool) {
+	for i := range o.Items {
+		if o.Items[i].RID == rid {
+			return &o.Items[i], true
+		}
+	}
+	return nil, false
+}
+
+// OrderFilter narrows order lists. Zero values leave a field unfiltered; a
+// zero Limit returns every match.
+type OrderFilter struct {
+	IncludeDeleted  bool
+	Status          OrderStatus
+	CustomerID      string
+	DeliveryService string
+	CreatedAfter    time.Time
+	CreatedBefore   time.Time
+	Limit           int
+	Offset          int
+}
+
+// OrderParts selects the sub-entities of an order that a save writes. The
+// orders row itself is always written.
+type OrderParts uint8
+
+const (
+	PartDelivery OrderParts = 1 << iota
+	PartPayment
+	PartItems
+
+	AllParts = PartDelivery | PartPayment | PartItems
+)
+
+func (p OrderParts) Has(part OrderParts) bool {
+	return p&part != 0
+}
+
+// ChangedParts reports which sub-entities differ between two versions of an
+// order.
+func ChangedParts(before, after *Order) OrderParts {
+	var parts OrderParts
+	if before.Delivery != after.Delivery {
+		parts |= PartDelivery
+	}
+	if before.Payment != after.Payment {
+		parts |= PartPayment
+	}
+	if !reflect.DeepEqual(before.Items, after.Items) {
+		parts |= PartItems
+	}
+	return parts
+}
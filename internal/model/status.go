@@ -0,0 +1,28 @@
+package model
+
+type OrderStatus string
+
+const (
+	StatusCreated    OrderStatus = "created"
+	StatusPaid       OrderStatus = "paid"
+	StatusAssembling OrderStatus = "assembling"
+	StatusShipped    OrderStatus = "shipped"
+	StatusDelivered  OrderStatus = "delivered"
+	StatusCancelled  OrderStatus = "cancelled"
+	StatusReturned   OrderStatus = "returned"
+)
+
+func (s OrderStatus) Valid() bool {
+	switch s {
+	case StatusCreated, StatusPaid, StatusAssembling, StatusShipped,
+		StatusDelivered, StatusCancelled, StatusReturned:
+		return true
+	}
+	return false
+}
+
+type StatusChange struct {
+	OrderUID string      `json:"order_uid" validate:"required"`
+	Status   OrderStatus `json:"status" validate:"required"`
+	Reason   string      `json:"reason,omitempty" validate:"omitempty,max=255"`
+}
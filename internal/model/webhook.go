@@ -0,0 +1,74 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook is a subscription to order events. Secret signs every payload and
+// is only returned when the webhook is created.
+type Webhook struct {
+	ID                  int64            `json:"id"`
+	URL                 string           `json:"url" validate:"required,http_url,max=2048"`
+	Secret              string           `json:"secret,omitempty" validate:"omitempty,min=16,max=255"`
+	EventTypes          []OrderEventType `json:"event_types" validate:"required,min=1,dive,oneof=created updated deleted restored purged status_changed"`
+	Active              bool             `json:"active"`
+	ConsecutiveFailures int              `json:"consecutive_failures"`
+	DisabledAt          *time.Time       `json:"disabled_at,omitempty"`
+	CreatedAt           time.Time        `json:"created_at"`
+	UpdatedAt           time.Time        `json:"updated_at"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "pending"
+	DeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	DeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one event queued for one webhook, together with the
+// outcome of its latest attempt.
+type WebhookDelivery struct {
+	ID             int64                 `json:"id"`
+	WebhookID      int64                 `json:"webhook_id"`
+	EventID        int64                 `json:"event_id"`
+	EventType      OrderEventType        `json:"event_type"`
+	OrderUID       string                `json:"order_uid"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	NextAttemptAt  *time.Time            `json:"next_attempt_at,omitempty"`
+	ResponseStatus int                   `json:"response_status,omitempty"`
+	LastError      string                `json:"last_error,omitempty"`
+	CreatedAt      time.Time             `json:"created_at"`
+	DeliveredAt    *time.Time            `json:"delivered_at,omitempty"`
+}
+
+// WebhookPayload is the signed body POSTed to a webhook. Order is the order
+// after the change, or before it for deletions and purges.
+type WebhookPayload struct {
+	ID         int64           `json:"id"`
+	Type       OrderEventType  `json:"type"`
+	OrderUID   string          `json:"order_uid"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Order      json.RawMessage `json:"order,omitempty"`
+}
+
+// WebhookJob is a claimed delivery with everything needed to send it.
+type WebhookJob struct {
+	DeliveryID int64
+	Attempt    int
+	Webhook    Webhook
+	Payload    WebhookPayload
+}
+
+// WebhookResult is the outcome of sending a WebhookJob. A failed job with
+// no RetryAt has run out of attempts.
+type WebhookResult struct {
+	DeliveryID     int64
+	WebhookID      int64
+	Succeeded      bool
+	ResponseStatus int
+	Error          string
+	RetryAt        *time.Time
+}
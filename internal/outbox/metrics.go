@@ -0,0 +1,18 @@
+package outbox
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	outboxEventsPublishedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "outbox_events_published_total",
+		Help: "Total number of order events published from the outbox to Kafka",
+	})
+
+	outboxPublishErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "outbox_publish_errors_total",
+		Help: "Total number of failed outbox relay batches",
+	})
+)
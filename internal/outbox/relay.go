@@ -0,0 +1,112 @@
+// Package outbox publishes order events from the transactional outbox to
+// Kafka.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"myapp/internal/kafka"
+	"myapp/internal/model"
+	"myapp/internal/repository"
+	"strconv"
+	"time"
+)
+
+const (
+	// batchSize bounds the events claimed and published at once.
+	batchSize = 100
+	// publishTimeout bounds waiting for the broker to acknowledge a batch.
+	publishTimeout = 30 * time.Second
+	// claimLease outlasts publishTimeout, so a batch is only offered to
+	// another relay once its publisher has given up or died.
+	claimLease = 2 * publishTimeout
+)
+
+// Headers set on every published event.
+const (
+	HeaderEventID   = "event-id"
+	HeaderEventType = "event-type"
+)
+
+// Publisher sends records to the order events topic; *kafka.Producer
+// implements it.
+type Publisher interface {
+	SendRecords(ctx context.Context, records []kafka.Record) error
+}
+
+// Relay moves committed order events from the outbox to Kafka. Events are
+// keyed by order UID, so each order's events stay in one partition in the
+// order they were committed. An event is removed from the outbox only after
+// the broker acknowledged it, so a crash or broker outage leads to
+// redelivery rather than loss; consumers should deduplicate by event-id.
+type Relay struct {
+	repo      repository.OutboxRepository
+	publisher Publisher
+	interval  time.Duration
+}
+
+func NewRelay(repo repository.OutboxRepository, publisher Publisher, interval time.Duration) *Relay {
+	return &Relay{repo: repo, publisher: publisher, interval: interval}
+}
+
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for ctx.Err() == nil {
+				n, err := r.relay(ctx)
+				if err != nil {
+					outboxPublishErrorsTotal.Inc()
+					log.Printf("Failed to relay order events: %v", err)
+				}
+				if n < batchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// relay publishes one batch and returns its size.
+func (r *Relay) relay(ctx context.Context) (int, error) {
+	n, err := r.repo.RelayOutbox(ctx, batchSize, claimLease, func(events []model.OrderEvent) error {
+		records := make([]kafka.Record, len(events))
+		for i, event := range events {
+			record, err := newRecord(event)
+			if err != nil {
+				return err
+			}
+			records[i] = record
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+		defer cancel()
+		return r.publisher.SendRecords(ctx, records)
+	})
+	if n > 0 {
+		outboxEventsPublishedTotal.Add(float64(n))
+	}
+	return n, err
+}
+
+func newRecord(event model.OrderEvent) (kafka.Record, error) {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return kafka.Record{}, fmt.Errorf("failed to encode event %d: %w", event.ID, err)
+	}
+	return kafka.Record{
+		Key:   []byte(event.OrderUID),
+		Value: value,
+		Headers: map[string]string{
+			HeaderEventID:   strconv.FormatInt(event.ID, 10),
+			HeaderEventType: string(event.Type),
+		},
+	}, nil
+}
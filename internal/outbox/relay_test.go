@@ -0,0 +1,80 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"myapp/internal/kafka"
+	"myapp/internal/model"
+)
+
+// fakeRepo behaves like RelayOutbox: events leave the queue only when
+// publish succeeds.
+type fakeRepo struct {
+	queue []model.OrderEvent
+}
+
+func (f *fakeRepo) RelayOutbox(ctx context.Context, limit int, lease time.Duration, publish func([]model.OrderEvent) error) (int, error) {
+	batch := f.queue
+	if len(batch) > limit {
+		batch = batch[:limit]
+	}
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	if err := publish(batch); err != nil {
+		return 0, err
+	}
+	f.queue = f.queue[len(batch):]
+	return len(batch), nil
+}
+
+type fakePublisher struct {
+	err     error
+	records []kafka.Record
+}
+
+func (f *fakePublisher) SendRecords(ctx context.Context, records []kafka.Record) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.records = append(f.records, records...)
+	return nil
+}
+
+func TestRelay_PublishesKeyedEvents(t *testing.T) {
+	repo := &fakeRepo{queue: []model.OrderEvent{
+		{ID: 1, OrderUID: "uid1", Type: model.EventCreated},
+		{ID: 2, OrderUID: "uid1", Type: model.EventDeleted},
+	}}
+	publisher := &fakePublisher{}
+
+	n, err := NewRelay(repo, publisher, 0).relay(context.Background())
+	if err != nil || n != 2 || len(repo.queue) != 0 {
+		t.Fatalf("expected 2 events relayed, got %d, %v, %d queued", n, err, len(repo.queue))
+	}
+
+	record := publisher.records[1]
+	if string(record.Key) != "uid1" || record.Headers[HeaderEventID] != "2" || record.Headers[HeaderEventType] != "deleted" {
+		t.Fatalf("unexpected record: %+v", record)
+	}
+	var event model.OrderEvent
+	if err := json.Unmarshal(record.Value, &event); err != nil || event.ID != 2 {
+		t.Fatalf("unexpected record value %s: %v", record.Value, err)
+	}
+}
+
+func TestRelay_KeepsEventsWhenPublishFails(t *testing.T) {
+	repo := &fakeRepo{queue: []model.OrderEvent{{ID: 1, OrderUID: "uid1", Type: model.EventCreated}}}
+	publisher := &fakePublisher{err: errors.New("broker unavailable")}
+
+	if _, err := NewRelay(repo, publisher, 0).relay(context.Background()); err == nil {
+		t.Fatal("expected publish error")
+	}
+	if len(repo.queue) != 1 {
+		t.Fatalf("expected the event to stay queued, got %d", len(repo.queue))
+	}
+}
@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"myapp/internal/model"
+	"reflect"
+	"sort"
+	"time"
+)
+
+var ErrEventNotFound = errors.New("order event not found")
+
+func (r *PostgresRepository) recordEvent(ctx context.Context, q querier, eventType model.OrderEventType, orderUID string, before, after *model.Order) error {
+	actor, err := json.Marshal(model.ActorFromContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to encode event actor: %w", err)
+	}
+
+	beforeJSON, err := auditJSON(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := auditJSON(after)
+	if err != nil {
+		return err
+	}
+
+	diff, err := diffJSON(beforeJSON, afterJSON)
+	if err != nil {
+		return fmt.Errorf("failed to diff order: %w", err)
+	}
+	diffData, err := json.Marshal(diff)
+	if err != nil {
+		return fmt.Errorf("failed to encode order diff: %w", err)
+	}
+
+	// Webhook deliveries and the Kafka outbox entry are queued in the same
+	// statement, so an event is published exactly when its change commits.
+	_, err = q.ExecContext(ctx, `
+		WITH event AS (
+			INSERT INTO order_events (order_uid, event_type, actor, before, after, diff)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id, event_type
+		), deliveries AS (
+			INSERT INTO webhook_deliveries (webhook_id, event_id)
+			SELECT w.id, event.id FROM event JOIN webhooks w ON w.active AND event.event_type = ANY(w.event_types)
+		)
+		INSERT INTO outbox (event_id) SELECT id FROM event`,
+		orderUID, eventType, string(actor), nullableJSON(beforeJSON), nullableJSON(afterJSON), string(diffData))
+	if err != nil {
+		return fmt.Errorf("failed to record order event: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresRepository) GetOrderHistory(ctx context.Context, orderUID string) ([]model.OrderEvent, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, xid, order_uid, event_type, actor, before, after, diff, created_at
+		FROM order_events WHERE order_uid = $1 ORDER BY id`, orderUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order history: %w", err)
+	}
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read order history: %w", err)
+	}
+	return events, nil
+}
+
+// eventHorizon is the oldest transaction still running. Every event written
+// below it has either committed or rolled back, so nothing new can appear
+// there; events at or above it are left for a later read.
+const eventHorizon = `pg_snapshot_xmin(pg_current_snapshot())`
+
+// GetEventsSince returns up to limit events after the given position, in
+// position order, across all orders. Events of transactions that may still
+// be running are held back until they finish.
+func (r *PostgresRepository) GetEventsSince(ctx context.Context, after model.EventPosition, limit int) ([]model.OrderEvent, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, xid, order_uid, event_type, actor, before, after, diff, created_at
+		FROM order_events WHERE (xid, id) > ($1::xid8, $2) AND xid < `+eventHorizon+`
+		ORDER BY xid, id LIMIT $3`, after.XID, after.ID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order events: %w", err)
+	}
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read order events: %w", err)
+	}
+	return events, nil
+}
+
+// GetEventHorizon returns the position up to which the audit log is
+// complete: every event after it is still to be read by GetEventsSince.
+func (r *PostgresRepository) GetEventHorizon(ctx context.Context) (model.EventPosition, error) {
+	var horizon model.EventPosition
+	if err := r.db.QueryRowContext(ctx, `SELECT `+eventHorizon).Scan(&horizon.XID); err != nil {
+		return model.EventPosition{}, fmt.Errorf("failed to get order event horizon: %w", err)
+	}
+	return horizon, nil
+}
+
+// GetEventPosition returns the position of the event with the given ID.
+func (r *PostgresRepository) GetEventPosition(ctx context.Context, id int64) (model.EventPosition, error) {
+	position := model.EventPosition{ID: id}
+	err := r.db.QueryRowContext(ctx, `SELECT xid FROM order_events WHERE id = $1`, id).Scan(&position.XID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.EventPosition{}, ErrEventNotFound
+	}
+	if err != nil {
+		return model.EventPosition{}, fmt.Errorf("failed to get order event: %w", err)
+	}
+	return position, nil
+}
+
+func scanEvents(rows *sql.Rows) ([]model.OrderEvent, error) {
+	defer rows.Close()
+
+	events := []model.OrderEvent{}
+	for rows.Next() {
+		var (
+			event                      model.OrderEvent
+			actor, before, after, diff []byte
+		)
+		if err := rows.Scan(&event.ID, &event.XID, &event.OrderUID, &event.Type, &actor, &before, &after, &diff, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan order event: %w", err)
+		}
+		if err := json.Unmarshal(actor, &event.Actor); err != nil {
+			return nil, fmt.Errorf("failed to decode event actor: %w", err)
+		}
+		if len(diff) > 0 {
+			if err := json.Unmarshal(diff, &event.Diff); err != nil {
+				return nil, fmt.Errorf("failed to decode event diff: %w", err)
+			}
+		}
+		event.Before = before
+		event.After = after
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// auditJSON normalizes timestamps to the precision Postgres stores, so that
+// an order read back from the database does not differ from the one written.
+func auditJSON(order *model.Order) ([]byte, error) {
+	if order == nil {
+		return nil, nil
+	}
+	normalized := order.Clone()
+	normalized.DateCreated = normalized.DateCreated.UTC().Truncate(time.Microsecond)
+	if normalized.DeletedAt != nil {
+		deletedAt := normalized.DeletedAt.UTC().Truncate(time.Microsecond)
+		normalized.DeletedAt = &deletedAt
+	}
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode order for audit: %w", err)
+	}
+	return data, nil
+}
+
+// nullableJSON passes JSON as text: lib/pq would send []byte as bytea.
+func nullableJSON(data []byte) interface{} {
+	if data == nil {
+		return nil
+	}
+	return string(data)
+}
+
+func diffJSON(before, after []byte) ([]model.FieldChange, error) {
+	beforeFields := map[string]interface{}{}
+	afterFields := map[string]interface{}{}
+
+	for _, side := range []struct {
+		data   []byte
+		fields map[string]interface{}
+	}{{before, beforeFields}, {after, afterFields}} {
+		if side.data == nil {
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(side.data, &value); err != nil {
+			return nil, err
+		}
+		flatten("", value, side.fields)
+	}
+
+	paths := make(map[string]struct{}, len(beforeFields)+len(afterFields))
+	for path := range beforeFields {
+		paths[path] = struct{}{}
+	}
+	for path := range afterFields {
+		paths[path] = struct{}{}
+	}
+
+	var changes []model.FieldChange
+	for path := range paths {
+		from, to := beforeFields[path], afterFields[path]
+		if !reflect.DeepEqual(from, to) {
+			changes = append(changes, model.FieldChange{Path: path, From: from, To: to})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+func flatten(prefix string, value interface{}, out map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			flatten(path, child, out)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flatten(fmt.Sprintf("%s[%d]", prefix, i), child, out)
+		}
+	default:
+		out[prefix] = v
+	}
+}
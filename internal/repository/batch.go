@@ -0,0 +1,294 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"myapp/internal/model"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+)
+
+// orderFilterClause builds the WHERE, ORDER BY and paging clauses for a
+// filter, newest orders first.
+func orderFilterClause(filter model.OrderFilter) (string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.Replace(condition, "?", "$"+strconv.Itoa(len(args)), 1))
+	}
+
+	if !filter.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	if filter.Status != "" {
+		add("status = ?", filter.Status)
+	}
+	if filter.CustomerID != "" {
+		add("customer_id = ?", filter.CustomerID)
+	}
+	if filter.DeliveryService != "" {
+		add("delivery_service = ?", filter.DeliveryService)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		add("date_created >= ?", filter.CreatedAfter)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		add("date_created < ?", filter.CreatedBefore)
+	}
+
+	var clause strings.Builder
+	if len(conditions) > 0 {
+		clause.WriteString(" WHERE " + strings.Join(conditions, " AND "))
+	}
+	clause.WriteString(" ORDER BY date_created DESC")
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		clause.WriteString(" LIMIT $" + strconv.Itoa(len(args)))
+	}
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		clause.WriteString(" OFFSET $" + strconv.Itoa(len(args)))
+	}
+	return clause.String(), args
+}
+
+// GetOrderHeaders returns matching orders with only the orders row filled in,
+// in a single query. GetOrderParts loads the rest for many orders at once.
+func (r *PostgresRepository) GetOrderHeaders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, error) {
+	tracer := otel.Tracer("repo")
+	ctx, span := tracer.Start(ctx, "GetOrderHeaders")
+	defer span.End()
+
+	where, args := orderFilterClause(filter)
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT order_uid, track_number, entry, locale, internal_signature,
+		       customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, status, deleted_at, version
+		FROM orders`+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders: %w", err)
+	}
+	defer rows.Close()
+
+	orders := []*model.Order{}
+	for rows.Next() {
+		order := &model.Order{}
+		if err := rows.Scan(
+			&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale,
+			&order.InternalSignature, &order.CustomerID, &order.DeliveryService,
+			&order.ShardKey, &order.SMID, &order.DateCreated, &order.OOFShard, &order.Status, &order.DeletedAt, &order.Version); err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate orders: %w", err)
+	}
+	return orders, nil
+}
+
+// GetOrderParts loads the selected parts of many orders with one query per
+// part. The returned orders are keyed by UID and have only those parts set;
+// UIDs of orders that do not exist, such as ones purged since they were
+// listed, are left out.
+func (r *PostgresRepository) GetOrderParts(ctx context.Context, orderUIDs []string, parts model.OrderParts) (map[string]*model.Order, error) {
+	tracer := otel.Tracer("repo")
+	ctx, span := tracer.Start(ctx, "GetOrderParts")
+	defer span.End()
+
+	return r.getOrderParts(ctx, r.db, orderUIDs, parts)
+}
+
+func (r *PostgresRepository) getOrderParts(ctx context.Context, q querier, orderUIDs []string, parts model.OrderParts) (map[string]*model.Order, error) {
+	orders := make(map[string]*model.Order, len(orderUIDs))
+	if len(orderUIDs) == 0 {
+		return orders, nil
+	}
+	uids := pq.Array(orderUIDs)
+
+	if err := scanParts(ctx, q, `SELECT order_uid FROM orders WHERE order_uid = ANY($1)`, uids, func(scan func(...interface{}) error) error {
+		var orderUID string
+		if err := scan(&orderUID); err != nil {
+			return err
+		}
+		orders[orderUID] = &model.Order{OrderUID: orderUID, Items: []model.Item{}}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to get orders: %w", err)
+	}
+
+	if parts.Has(model.PartDelivery) {
+		if err := scanParts(ctx, q, `
+			SELECT order_uid, name, phone, zip, city, address, region, email
+			FROM delivery WHERE order_uid = ANY($1)`, uids, func(scan func(...interface{}) error) error {
+			var (
+				orderUID string
+				d        model.Delivery
+			)
+			if err := scan(&orderUID, &d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email); err != nil {
+				return err
+			}
+			if order := orders[orderUID]; order != nil {
+				order.Delivery = d
+			}
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("failed to get deliveries: %w", err)
+		}
+	}
+
+	if parts.Has(model.PartPayment) {
+		if err := scanParts(ctx, q, `
+			SELECT order_uid, transaction, request_id, currency, provider, amount, payment_dt,
+			       bank, delivery_cost, goods_total, custom_fee
+			FROM payment WHERE order_uid = ANY($1)`, uids, func(scan func(...interface{}) error) error {
+			var (
+				orderUID string
+				p        model.Payment
+			)
+			if err := scan(&orderUID, &p.Transaction, &p.RequestID, &p.Currency, &p.Provider, &p.Amount,
+				&p.PaymentDT, &p.Bank, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee); err != nil {
+				return err
+			}
+			if order := orders[orderUID]; order != nil {
+				order.Payment = p
+			}
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("failed to get payments: %w", err)
+		}
+	}
+
+	if parts.Has(model.PartItems) {
+		if err := scanParts(ctx, q, `
+			SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size,
+			       total_price, nm_id, brand, status
+			FROM items WHERE order_uid = ANY($1) ORDER BY id`, uids, func(scan func(...interface{}) error) error {
+			var (
+				orderUID string
+				item     model.Item
+			)
+			if err := scan(&orderUID, &item.ChrtID, &item.TrackNumber, &item.Price, &item.RID,
+				&item.Name, &item.Sale, &item.Size, &item.TotalPrice, &item.NMID, &item.Brand, &item.Status); err != nil {
+				return err
+			}
+			if order := orders[orderUID]; order != nil {
+				order.Items = append(order.Items, item)
+			}
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("failed to get items: %w", err)
+		}
+	}
+
+	return orders, nil
+}
+
+func scanParts(ctx context.Context, q querier, query string, uids interface{}, row func(scan func(...interface{}) error) error) error {
+	rows, err := q.QueryContext(ctx, query, uids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := row(rows.Scan); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// exportPageSize is how many orders ExportOrders completes with one batch
+// of part queries.
+const exportPageSize = 500
+
+// ExportOrders calls fn for every matching order, complete with its parts,
+// in the order of GetOrderHeaders. It runs in one read-only repeatable-read
+// transaction, so headers and parts come from the same snapshot, and pages
+// through the headers with a server-side cursor, so memory use does not grow
+// with the number of orders and an export holds a single connection. An
+// error from fn stops the export.
+func (r *PostgresRepository) ExportOrders(ctx context.Context, filter model.OrderFilter, fn func(*model.Order) error) error {
+	tracer := otel.Tracer("repo")
+	ctx, span := tracer.Start(ctx, "ExportOrders")
+	defer span.End()
+
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	where, args := orderFilterClause(filter)
+	if _, err := tx.ExecContext(ctx, `
+		DECLARE export_orders NO SCROLL CURSOR FOR
+		SELECT order_uid, track_number, entry, locale, internal_signature,
+		       customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, status, deleted_at, version
+		FROM orders`+where, args...); err != nil {
+		return fmt.Errorf("failed to export orders: %w", err)
+	}
+
+	for {
+		page, err := fetchExportPage(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			break
+		}
+
+		uids := make([]string, len(page))
+		for i, order := range page {
+			uids[i] = order.OrderUID
+		}
+		parts, err := r.getOrderParts(ctx, tx, uids, model.AllParts)
+		if err != nil {
+			return err
+		}
+		for _, order := range page {
+			part, ok := parts[order.OrderUID]
+			if !ok {
+				continue
+			}
+			order.Delivery, order.Payment, order.Items = part.Delivery, part.Payment, part.Items
+			if err := fn(order); err != nil {
+				return err
+			}
+		}
+		if len(page) < exportPageSize {
+			break
+		}
+	}
+	return tx.Commit()
+}
+
+func fetchExportPage(ctx context.Context, tx *sql.Tx) ([]*model.Order, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`FETCH %d FROM export_orders`, exportPageSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to export orders: %w", err)
+	}
+	defer rows.Close()
+
+	page := make([]*model.Order, 0, exportPageSize)
+	for rows.Next() {
+		order := &model.Order{}
+		if err := rows.Scan(
+			&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale,
+			&order.InternalSignature, &order.CustomerID, &order.DeliveryService,
+			&order.ShardKey, &order.SMID, &order.DateCreated, &order.OOFShard, &order.Status, &order.DeletedAt, &order.Version); err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		page = append(page, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate orders: %w", err)
+	}
+	return page, nil
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"myapp/internal/model"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	idempotencyKindMessage     = "message"
+	idempotencyKindTransaction = "transaction"
+)
+
+// claimIdempotencyKeys records the request's idempotency key and the order's
+// payment transaction in the same transaction that saves the order, so a
+// duplicate either waits for the original to commit and is rejected, or
+// succeeds after the original rolled back.
+//
+// A repeated request key fails with ErrDuplicateMessage and loads the order
+// it produced into order, or with ErrIdempotencyMismatch if the request hash
+// differs from the one recorded with the key. A payment transaction already
+// recorded for another order fails with ErrDuplicateTransaction.
+func (r *PostgresRepository) claimIdempotencyKeys(ctx context.Context, q querier, order *model.Order) error {
+	if key, ok := model.IdempotencyKeyFromContext(ctx); ok {
+		hash := model.RequestHashFromContext(ctx)
+		owner, storedHash, claimed, err := claimIdempotencyKey(ctx, q, key, idempotencyKindMessage, order.OrderUID, hash)
+		if err != nil {
+			return err
+		}
+		if !claimed && hash != "" && storedHash != "" && hash != storedHash {
+			return fmt.Errorf("%w: %s (order %s)", ErrIdempotencyMismatch, key, owner)
+		}
+		if !claimed {
+			if stored, err := r.getOrder(ctx, q, owner, false); err == nil {
+				*order = *stored
+			}
+			return fmt.Errorf("%w: %s (order %s)", ErrDuplicateMessage, key, owner)
+		}
+	}
+
+	if order.Payment.Transaction != "" {
+		key := model.PaymentTransactionKey(order.Payment.Transaction)
+		owner, _, claimed, err := claimIdempotencyKey(ctx, q, key, idempotencyKindTransaction, order.OrderUID, "")
+		if err != nil {
+			return err
+		}
+		if !claimed && owner != order.OrderUID {
+			return fmt.Errorf("%w: %s is recorded for order %s", ErrDuplicateTransaction, order.Payment.Transaction, owner)
+		}
+	}
+	return nil
+}
+
+// claimIdempotencyKey inserts key with the request hash unless it exists,
+// and returns the order the key belongs to, the hash recorded with it and
+// whether this call inserted it.
+func claimIdempotencyKey(ctx context.Context, q querier, key, kind, orderUID, hash string) (string, string, bool, error) {
+	var owner string
+	err := q.QueryRowContext(ctx, `
+		INSERT INTO idempotency_keys (key, kind, order_uid, request_hash) VALUES ($1, $2, $3, NULLIF($4, ''))
+		ON CONFLICT (key) DO NOTHING
+		RETURNING order_uid`, key, kind, orderUID, hash).Scan(&owner)
+	if err == nil {
+		return owner, hash, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", "", false, fmt.Errorf("failed to record idempotency key: %w", err)
+	}
+
+	var storedHash string
+	err = q.QueryRowContext(ctx,
+		`SELECT order_uid, COALESCE(request_hash, '') FROM idempotency_keys WHERE key = $1`, key).Scan(&owner, &storedHash)
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	return owner, storedHash, false, nil
+}
+
+// releaseTransactionKeys frees the payment transactions recorded for the
+// given orders, except the key in keep, so that another order may use them.
+// It is called when an order's payment transaction changes and when the
+// order is purged.
+func releaseTransactionKeys(ctx context.Context, q querier, orderUIDs []string, keep string) error {
+	_, err := q.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE kind = $1 AND order_uid = ANY($2) AND key <> $3`,
+		idempotencyKindTransaction, pq.Array(orderUIDs), keep)
+	if err != nil {
+		return fmt.Errorf("failed to release payment transactions: %w", err)
+	}
+	return nil
+}
+
+// PurgeIdempotencyKeys forgets request keys older than before. Payment
+// transaction keys live as long as the order that recorded them.
+func (r *PostgresRepository) PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE kind = $1 AND created_at < $2`, idempotencyKindMessage, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// sameContent reports whether saving order over stored would only touch
+// bookkeeping fields, which makes the save a no-op.
+func sameContent(stored, order *model.Order) (bool, error) {
+	candidate := order.Clone()
+	candidate.Status = stored.Status
+	candidate.Version = stored.Version
+	candidate.DeletedAt = stored.DeletedAt
+
+	storedJSON, err := auditJSON(stored)
+	if err != nil {
+		return false, err
+	}
+	candidateJSON, err := auditJSON(candidate)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(storedJSON, candidateJSON), nil
+}
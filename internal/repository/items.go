@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myapp/internal/model"
+)
+
+var (
+	ErrItemNotFound      = errors.New("order item not found")
+	ErrItemAlreadyExists = errors.New("order item already exists")
+	ErrLastItem          = errors.New("order must keep at least one item")
+)
+
+// AddItem, UpdateItem and DeleteItem change one item of an order. check is
+// called with the resulting order, totals included, before the transaction
+// commits; an error from it rolls the change back.
+func (r *PostgresRepository) AddItem(ctx context.Context, orderUID string, item model.Item, check func(*model.Order) error) (*model.Order, error) {
+	return r.changeItems(ctx, orderUID, check, func(q querier, order *model.Order) error {
+		if _, exists := order.Item(item.RID); exists {
+			return ErrItemAlreadyExists
+		}
+		if err := insertItem(ctx, q, orderUID, item); err != nil {
+			return err
+		}
+		order.Items = append(order.Items, item)
+		return nil
+	})
+}
+
+func (r *PostgresRepository) UpdateItem(ctx context.Context, orderUID string, item model.Item, check func(*model.Order) error) (*model.Order, error) {
+	return r.changeItems(ctx, orderUID, check, func(q querier, order *model.Order) error {
+		stored, exists := order.Item(item.RID)
+		if !exists {
+			return ErrItemNotFound
+		}
+		_, err := q.ExecContext(ctx, `
+			UPDATE items SET chrt_id = $3, track_number = $4, price = $5, name = $6, sale = $7,
+			                 size = $8, total_price = $9, nm_id = $10, brand = $11, status = $12
+			WHERE order_uid = $1 AND rid = $2`,
+			orderUID, item.RID, item.ChrtID, item.TrackNumber, item.Price, item.Name, item.Sale,
+			item.Size, item.TotalPrice, item.NMID, item.Brand, item.Status)
+		if err != nil {
+			return fmt.Errorf("failed to update item: %w", err)
+		}
+		*stored = item
+		return nil
+	})
+}
+
+func (r *PostgresRepository) DeleteItem(ctx context.Context, orderUID, rid string, check func(*model.Order) error) (*model.Order, error) {
+	return r.changeItems(ctx, orderUID, check, func(q querier, order *model.Order) error {
+		if _, exists := order.Item(rid); !exists {
+			return ErrItemNotFound
+		}
+		if len(order.Items) == 1 {
+			return ErrLastItem
+		}
+		_, err := q.ExecContext(ctx, `DELETE FROM items WHERE order_uid = $1 AND rid = $2`, orderUID, rid)
+		if err != nil {
+			return fmt.Errorf("failed to delete item: %w", err)
+		}
+		items := order.Items[:0]
+		for _, item := range order.Items {
+			if item.RID != rid {
+				items = append(items, item)
+			}
+		}
+		order.Items = items
+		return nil
+	})
+}
+
+// changeItems applies change to the locked order, recalculates the payment's
+// goods total from the stored items, and the amount from it, checks the
+// result and bumps the order version.
+func (r *PostgresRepository) changeItems(ctx context.Context, orderUID string, check func(*model.Order) error, change func(q querier, order *model.Order) error) (*model.Order, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := r.getOrder(ctx, tx, orderUID, true)
+	if err != nil {
+		return nil, err
+	}
+	if before.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+
+	after := before.Clone()
+	if err := change(tx, after); err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE payment SET goods_total = totals.goods_total,
+		                   amount = totals.goods_total + payment.delivery_cost + payment.custom_fee
+		FROM (SELECT COALESCE(SUM(total_price), 0) AS goods_total FROM items WHERE order_uid = $1) AS totals
+		WHERE payment.order_uid = $1
+		RETURNING payment.goods_total, payment.amount`, orderUID).Scan(&after.Payment.GoodsTotal, &after.Payment.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recalculate goods total: %w", err)
+	}
+	if check != nil {
+		if err := check(after); err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.QueryRowContext(ctx,
+		`UPDATE orders SET version = version + 1, updated_at = NOW() WHERE order_uid = $1 RETURNING version`,
+		orderUID).Scan(&after.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update order: %w", err)
+	}
+
+	if err := r.recordEvent(ctx, tx, model.EventUpdated, orderUID, before, after); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return after, nil
+}
+
+func insertItem(ctx context.Context, q querier, orderUID string, item model.Item) error {
+	_, err := q.ExecContext(ctx, `
+		INSERT INTO items (order_uid, chrt_id, track_number, price, rid, name,
+		                  sale, size, total_price, nm_id, brand, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		orderUID, item.ChrtID, item.TrackNumber, item.Price, item.RID,
+		item.Name, item.Sale, item.Size, item.TotalPrice, item.NMID, item.Brand, item.Status)
+	if err != nil {
+		return fmt.Errorf("failed to insert item: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"myapp/internal/model"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// outboxLockID is the advisory lock taken while claiming a batch. Together
+// with the lease it lets a single batch be in flight at a time, which keeps
+// events in commit order per order.
+const outboxLockID = 0x6f7574626f78
+
+// OutboxRepository drains the outbox that recordEvent fills in the same
+// transaction as each order change.
+type OutboxRepository interface {
+	RelayOutbox(ctx context.Context, limit int, lease time.Duration, publish func([]model.OrderEvent) error) (int, error)
+}
+
+func NewOutboxRepository(db *sql.DB) OutboxRepository {
+	return &PostgresRepository{db: db}
+}
+
+// RelayOutbox claims up to limit pending events, oldest first, for lease,
+// hands them to publish outside of any transaction and removes them once it
+// succeeds. If publish fails the claim is released and the events are offered
+// again, as they are after a crash once the lease expires, so delivery is at
+// least once. It returns 0 without calling publish while another batch is
+// claimed.
+func (r *PostgresRepository) RelayOutbox(ctx context.Context, limit int, lease time.Duration, publish func([]model.OrderEvent) error) (int, error) {
+	events, err := r.claimOutbox(ctx, limit, lease)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	ids := make([]int64, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+
+	if err := publish(events); err != nil {
+		if _, releaseErr := r.db.ExecContext(ctx,
+			`UPDATE outbox SET claimed_until = NULL WHERE event_id = ANY($1)`, pq.Array(ids)); releaseErr != nil {
+			return 0, fmt.Errorf("%w (failed to release outbox claim: %v)", err, releaseErr)
+		}
+		return 0, err
+	}
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM outbox WHERE event_id = ANY($1)`, pq.Array(ids)); err != nil {
+		return 0, fmt.Errorf("failed to remove relayed events: %w", err)
+	}
+	return len(events), nil
+}
+
+// claimOutbox leases the next batch in a short transaction, unless a batch
+// claimed earlier is still leased.
+func (r *PostgresRepository) claimOutbox(ctx context.Context, limit int, lease time.Duration) ([]model.OrderEvent, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, outboxLockID).Scan(&locked); err != nil {
+		return nil, fmt.Errorf("failed to lock outbox: %w", err)
+	}
+	if !locked {
+		return nil, nil
+	}
+
+	var busy bool
+	if err := tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM outbox WHERE claimed_until > NOW())`).Scan(&busy); err != nil {
+		return nil, fmt.Errorf("failed to check outbox claims: %w", err)
+	}
+	if busy {
+		return nil, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		WITH claimed AS (
+			UPDATE outbox SET claimed_until = NOW() + make_interval(secs => $2)
+			WHERE id IN (SELECT id FROM outbox ORDER BY id LIMIT $1)
+			RETURNING id, event_id
+		)
+		SELECT e.id, e.xid, e.order_uid, e.event_type, e.actor, e.before, e.after, e.diff, e.created_at
+		FROM claimed c JOIN order_events e ON e.id = c.event_id
+		ORDER BY c.id`, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox: %w", err)
+	}
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit outbox claim: %w", err)
+	}
+	return events, nil
+}
@@ -3,22 +3,59 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"myapp/internal/model"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrNotFound        = errors.New("order not found")
+	ErrStatusConflict  = errors.New("order status was changed concurrently")
+	ErrNotDeleted      = errors.New("order is not deleted")
+	ErrVersionConflict = errors.New("order version mismatch")
+	ErrAlreadyExists   = errors.New("order already exists")
+
+	ErrDuplicateMessage     = errors.New("message already processed")
+	ErrDuplicateTransaction = errors.New("payment transaction already recorded for another order")
+	ErrIdempotencyMismatch  = errors.New("idempotency key already used for a different request")
 )
 
 type Repository interface {
-	CreateOrder(order *model.Order) error
-	GetOrderByUID(orderUID string) (*model.Order, error)
-	GetAllOrders() ([]*model.Order, error)
-	UpdateOrder(order *model.Order) error
-	DeleteOrder(orderUID string) error
+	CreateOrder(ctx context.Context, order *model.Order) error
+	GetOrderByUID(ctx context.Context, orderUID string, includeDeleted bool) (*model.Order, error)
+	GetAllOrders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, error)
+	GetOrdersByUIDs(ctx context.Context, orderUIDs []string) ([]*model.Order, error)
+	UpdateOrder(ctx context.Context, order *model.Order) error
+	UpsertOrder(ctx context.Context, order *model.Order) error
+	PatchOrder(ctx context.Context, order *model.Order, parts model.OrderParts) error
+	UpdateOrderStatus(ctx context.Context, orderUID string, from, to model.OrderStatus) (*model.Order, error)
+	DeleteOrder(ctx context.Context, orderUID string) error
+	RestoreOrder(ctx context.Context, orderUID string) (*model.Order, error)
+	PurgeDeletedOrders(ctx context.Context, deletedBefore time.Time) (int64, error)
+	PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int64, error)
+	GetOrderHistory(ctx context.Context, orderUID string) ([]model.OrderEvent, error)
+	GetEventsSince(ctx context.Context, after model.EventPosition, limit int) ([]model.OrderEvent, error)
+	GetEventHorizon(ctx context.Context) (model.EventPosition, error)
+	GetEventPosition(ctx context.Context, id int64) (model.EventPosition, error)
+	AddItem(ctx context.Context, orderUID string, item model.Item, check func(*model.Order) error) (*model.Order, error)
+	UpdateItem(ctx context.Context, orderUID string, item model.Item, check func(*model.Order) error) (*model.Order, error)
+	DeleteItem(ctx context.Context, orderUID, rid string, check func(*model.Order) error) (*model.Order, error)
+	GetOrderHeaders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, error)
+	GetOrderParts(ctx context.Context, orderUIDs []string, parts model.OrderParts) (map[string]*model.Order, error)
+	ExportOrders(ctx context.Context, filter model.OrderFilter, fn func(*model.Order) error) error
+}
+
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
 type PostgresRepository struct {
@@ -29,23 +66,152 @@ func NewPostgresRepository(db *sql.DB) Repository {
 	return &PostgresRepository{db: db}
 }
 
-func (r *PostgresRepository) CreateOrder(order *model.Order) error {
+// CreateOrder inserts a new order and fails with ErrAlreadyExists if the UID
+// is taken, including by a soft-deleted order.
+func (r *PostgresRepository) CreateOrder(ctx context.Context, order *model.Order) error {
+	tracer := otel.Tracer("repo")
+	ctx, span := tracer.Start(ctx, "CreateOrder")
+	defer span.End()
+
+	return r.saveOrder(ctx, order, saveInsert, 0, model.AllParts)
+}
+
+// UpdateOrder overwrites an existing order and fails with ErrNotFound if
+// there is none. The stored version must still equal order.Version; a zero
+// version skips the check.
+func (r *PostgresRepository) UpdateOrder(ctx context.Context, order *model.Order) error {
+	tracer := otel.Tracer("repo")
+	ctx, span := tracer.Start(ctx, "UpdateOrder")
+	defer span.End()
+
+	return r.saveOrder(ctx, order, saveUpdate, order.Version, model.AllParts)
+}
+
+// UpsertOrder inserts the order or overwrites it if it exists. It is meant for
+// idempotent ingestion, where redelivered messages must not fail. A non-zero
+// order.Version is the version the sender based the order on: an existing
+// order that has moved past it is not overwritten and ErrVersionConflict is
+// returned. Without a version the order overwrites whatever is stored.
+func (r *PostgresRepository) UpsertOrder(ctx context.Context, order *model.Order) error {
+	tracer := otel.Tracer("repo")
+	ctx, span := tracer.Start(ctx, "UpsertOrder")
+	defer span.End()
+
+	return r.saveOrder(ctx, order, saveUpsert, order.Version, model.AllParts)
+}
+
+// PatchOrder is UpdateOrder that rewrites only the given sub-entities, leaving
+// the rows of the others untouched.
+func (r *PostgresRepository) PatchOrder(ctx context.Context, order *model.Order, parts model.OrderParts) error {
 	tracer := otel.Tracer("repo")
-	_, span := tracer.Start(context.TODO(), "CreateOrder")
+	ctx, span := tracer.Start(ctx, "PatchOrder")
 	defer span.End()
+
+	return r.saveOrder(ctx, order, saveUpdate, order.Version, parts)
+}
+
+type saveMode int
+
+const (
+	saveInsert saveMode = iota
+	saveUpdate
+	saveUpsert
+)
+
+func (r *PostgresRepository) saveOrder(ctx context.Context, order *model.Order, mode saveMode, expectedVersion int64, parts model.OrderParts) error {
+	span := trace.SpanFromContext(ctx)
 	start := time.Now()
-	tx, err := r.db.Begin()
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	orderQuery := `
-		INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, 
-		                   customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		ON CONFLICT (order_uid) DO UPDATE SET
+	if err := r.claimIdempotencyKeys(ctx, tx, order); err != nil {
+		return err
+	}
+
+	var before *model.Order
+	if mode != saveInsert {
+		before, err = r.getOrder(ctx, tx, order.OrderUID, true)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+		if before != nil && before.DeletedAt != nil {
+			return fmt.Errorf("order %s is deleted: %w", order.OrderUID, ErrNotFound)
+		}
+		if mode == saveUpdate && before == nil {
+			return ErrNotFound
+		}
+	}
+
+	// A redelivered upsert matches the stored order but not the version it
+	// was based on, so it is recognised before the version is checked.
+	if mode == saveUpsert && before != nil {
+		same, err := sameContent(before, order)
+		if err != nil {
+			return err
+		}
+		if same {
+			order.Status, order.Version = before.Status, before.Version
+			return tx.Commit()
+		}
+	}
+
+	if before != nil && expectedVersion != 0 && before.Version != expectedVersion {
+		return fmt.Errorf("%w: expected %d, current %d", ErrVersionConflict, expectedVersion, before.Version)
+	}
+
+	if before == nil {
+		err = r.insertOrderRow(ctx, tx, order, mode == saveUpsert)
+	} else {
+		err = r.updateOrderRow(ctx, tx, order)
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	if before != nil && parts.Has(model.PartPayment) && before.Payment.Transaction != order.Payment.Transaction {
+		if err := releaseTransactionKeys(ctx, tx, []string{order.OrderUID}, model.PaymentTransactionKey(order.Payment.Transaction)); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+	}
+
+	if err := r.saveOrderParts(ctx, tx, order, parts); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	eventType := model.EventCreated
+	if before != nil {
+		eventType = model.EventUpdated
+	}
+	if err := r.recordEvent(ctx, tx, eventType, order.OrderUID, before, order); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	err = tx.Commit()
+	span.SetAttributes(attribute.Int64("duration_ms", time.Since(start).Milliseconds()))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// insertOrderRow inserts the orders row. A new order always starts as
+// created, whatever status the payload carries: later statuses are only
+// reached through UpdateOrderStatus. On a UID conflict it fails with
+// ErrAlreadyExists, or, when overwrite is set (an upsert racing another
+// insert), updates the row while keeping its status.
+func (r *PostgresRepository) insertOrderRow(ctx context.Context, q querier, order *model.Order, overwrite bool) error {
+	onConflict := `DO NOTHING`
+	if overwrite {
+		onConflict = `DO UPDATE SET
 			track_number = EXCLUDED.track_number,
 			entry = EXCLUDED.entry,
 			locale = EXCLUDED.locale,
@@ -56,17 +222,80 @@ func (r *PostgresRepository) CreateOrder(order *model.Order) error {
 			sm_id = EXCLUDED.sm_id,
 			date_created = EXCLUDED.date_created,
 			oof_shard = EXCLUDED.oof_shard,
+			version = orders.version + 1,
 			updated_at = NOW()`
+	}
+
+	orderQuery := `
+		INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature,
+		                   customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (order_uid) ` + onConflict + `
+		RETURNING status, version`
 
-	_, err = tx.Exec(orderQuery,
+	err := q.QueryRowContext(ctx, orderQuery,
 		order.OrderUID, order.TrackNumber, order.Entry, order.Locale,
 		order.InternalSignature, order.CustomerID, order.DeliveryService,
-		order.ShardKey, order.SMID, order.DateCreated, order.OOFShard)
+		order.ShardKey, order.SMID, order.DateCreated, order.OOFShard, model.StatusCreated).Scan(&order.Status, &order.Version)
+	if err == sql.ErrNoRows {
+		return ErrAlreadyExists
+	}
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
 		return fmt.Errorf("failed to insert order: %w", err)
 	}
+	return nil
+}
+
+// updateOrderRow overwrites the orders row. The status is left alone: it only
+// changes through UpdateOrderStatus.
+func (r *PostgresRepository) updateOrderRow(ctx context.Context, q querier, order *model.Order) error {
+	orderQuery := `
+		UPDATE orders SET
+			track_number = $2,
+			entry = $3,
+			locale = $4,
+			internal_signature = $5,
+			customer_id = $6,
+			delivery_service = $7,
+			shardkey = $8,
+			sm_id = $9,
+			date_created = $10,
+			oof_shard = $11,
+			version = version + 1,
+			updated_at = NOW()
+		WHERE order_uid = $1
+		RETURNING status, version`
+
+	err := q.QueryRowContext(ctx, orderQuery,
+		order.OrderUID, order.TrackNumber, order.Entry, order.Locale,
+		order.InternalSignature, order.CustomerID, order.DeliveryService,
+		order.ShardKey, order.SMID, order.DateCreated, order.OOFShard).Scan(&order.Status, &order.Version)
+	if err != nil {
+		return fmt.Errorf("failed to update order: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresRepository) saveOrderParts(ctx context.Context, q querier, order *model.Order, parts model.OrderParts) error {
+	if parts.Has(model.PartDelivery) {
+		if err := r.saveDelivery(ctx, q, order); err != nil {
+			return err
+		}
+	}
+	if parts.Has(model.PartPayment) {
+		if err := r.savePayment(ctx, q, order); err != nil {
+			return err
+		}
+	}
+	if parts.Has(model.PartItems) {
+		if err := r.saveItems(ctx, q, order); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+func (r *PostgresRepository) saveDelivery(ctx context.Context, q querier, order *model.Order) error {
 	deliveryQuery := `
         INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email)
         VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
@@ -79,16 +308,18 @@ func (r *PostgresRepository) CreateOrder(order *model.Order) error {
             region = EXCLUDED.region,
             email = EXCLUDED.email`
 
-	_, err = tx.Exec(deliveryQuery,
+	_, err := q.ExecContext(ctx, deliveryQuery,
 		order.OrderUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip,
 		order.Delivery.City, order.Delivery.Address, order.Delivery.Region, order.Delivery.Email)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
 		return fmt.Errorf("failed to insert delivery: %w", err)
 	}
+	return nil
+}
 
+func (r *PostgresRepository) savePayment(ctx context.Context, q querier, order *model.Order) error {
 	paymentQuery := `
-        INSERT INTO payment (order_uid, transaction, request_id, currency, provider, 
+        INSERT INTO payment (order_uid, transaction, request_id, currency, provider,
                             amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
         ON CONFLICT (order_uid) DO UPDATE SET
@@ -103,61 +334,63 @@ func (r *PostgresRepository) CreateOrder(order *model.Order) error {
             goods_total = EXCLUDED.goods_total,
             custom_fee = EXCLUDED.custom_fee`
 
-	_, err = tx.Exec(paymentQuery,
+	_, err := q.ExecContext(ctx, paymentQuery,
 		order.OrderUID, order.Payment.Transaction, order.Payment.RequestID, order.Payment.Currency,
 		order.Payment.Provider, order.Payment.Amount, order.Payment.PaymentDT, order.Payment.Bank,
 		order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
 		return fmt.Errorf("failed to insert payment: %w", err)
 	}
+	return nil
+}
 
-	_, err = tx.Exec("DELETE FROM items WHERE order_uid = $1", order.OrderUID)
+func (r *PostgresRepository) saveItems(ctx context.Context, q querier, order *model.Order) error {
+	_, err := q.ExecContext(ctx, "DELETE FROM items WHERE order_uid = $1", order.OrderUID)
 	if err != nil {
 		return fmt.Errorf("failed to delete existing items: %w", err)
 	}
 
 	for _, item := range order.Items {
-		itemQuery := `
-			INSERT INTO items (order_uid, chrt_id, track_number, price, rid, name, 
-			                  sale, size, total_price, nm_id, brand, status)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
-
-		_, err = tx.Exec(itemQuery,
-			order.OrderUID, item.ChrtID, item.TrackNumber, item.Price, item.RID,
-			item.Name, item.Sale, item.Size, item.TotalPrice, item.NMID, item.Brand, item.Status)
-		if err != nil {
-			span.SetStatus(codes.Error, err.Error())
-			return fmt.Errorf("failed to insert item: %w", err)
+		if err := insertItem(ctx, q, order.OrderUID, item); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	err = tx.Commit()
-	span.SetAttributes(attribute.Int64("duration_ms", time.Since(start).Milliseconds()))
+func (r *PostgresRepository) GetOrderByUID(ctx context.Context, orderUID string, includeDeleted bool) (*model.Order, error) {
+	tracer := otel.Tracer("repo")
+	ctx, span := tracer.Start(ctx, "GetOrderByUID")
+	defer span.End()
+
+	order, err := r.getOrder(ctx, r.db, orderUID, false)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
+		return nil, err
 	}
-	return err
+	if order.DeletedAt != nil && !includeDeleted {
+		return nil, ErrNotFound
+	}
+	return order, nil
 }
 
-func (r *PostgresRepository) GetOrderByUID(orderUID string) (*model.Order, error) {
-	tracer := otel.Tracer("repo")
-	_, span := tracer.Start(context.TODO(), "GetOrderByUID")
-	defer span.End()
+func (r *PostgresRepository) getOrder(ctx context.Context, q querier, orderUID string, forUpdate bool) (*model.Order, error) {
 	order := &model.Order{}
 
 	orderQuery := `
-		SELECT order_uid, track_number, entry, locale, internal_signature, 
-		       customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
+		SELECT order_uid, track_number, entry, locale, internal_signature,
+		       customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, status, deleted_at, version
 		FROM orders WHERE order_uid = $1`
+	if forUpdate {
+		orderQuery += " FOR UPDATE"
+	}
 
-	err := r.db.QueryRow(orderQuery, orderUID).Scan(
+	err := q.QueryRowContext(ctx, orderQuery, orderUID).Scan(
 		&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale,
 		&order.InternalSignature, &order.CustomerID, &order.DeliveryService,
-		&order.ShardKey, &order.SMID, &order.DateCreated, &order.OOFShard)
+		&order.ShardKey, &order.SMID, &order.DateCreated, &order.OOFShard, &order.Status, &order.DeletedAt, &order.Version)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("order not found")
+			return nil, ErrNotFound
 		}
 		return nil, fmt.Errorf("failed to get order: %w", err)
 	}
@@ -166,7 +399,7 @@ func (r *PostgresRepository) GetOrderByUID(orderUID string) (*model.Order, error
 		SELECT name, phone, zip, city, address, region, email
 		FROM delivery WHERE order_uid = $1`
 
-	err = r.db.QueryRow(deliveryQuery, orderUID).Scan(
+	err = q.QueryRowContext(ctx, deliveryQuery, orderUID).Scan(
 		&order.Delivery.Name, &order.Delivery.Phone, &order.Delivery.Zip,
 		&order.Delivery.City, &order.Delivery.Address, &order.Delivery.Region, &order.Delivery.Email)
 	if err != nil {
@@ -174,11 +407,11 @@ func (r *PostgresRepository) GetOrderByUID(orderUID string) (*model.Order, error
 	}
 
 	paymentQuery := `
-		SELECT transaction, request_id, currency, provider, amount, payment_dt, 
+		SELECT transaction, request_id, currency, provider, amount, payment_dt,
 		       bank, delivery_cost, goods_total, custom_fee
 		FROM payment WHERE order_uid = $1`
 
-	err = r.db.QueryRow(paymentQuery, orderUID).Scan(
+	err = q.QueryRowContext(ctx, paymentQuery, orderUID).Scan(
 		&order.Payment.Transaction, &order.Payment.RequestID, &order.Payment.Currency,
 		&order.Payment.Provider, &order.Payment.Amount, &order.Payment.PaymentDT,
 		&order.Payment.Bank, &order.Payment.DeliveryCost, &order.Payment.GoodsTotal, &order.Payment.CustomFee)
@@ -187,11 +420,11 @@ func (r *PostgresRepository) GetOrderByUID(orderUID string) (*model.Order, error
 	}
 
 	itemsQuery := `
-		SELECT chrt_id, track_number, price, rid, name, sale, size, 
+		SELECT chrt_id, track_number, price, rid, name, sale, size,
 		       total_price, nm_id, brand, status
-		FROM items WHERE order_uid = $1`
+		FROM items WHERE order_uid = $1 ORDER BY id`
 
-	rows, err := r.db.Query(itemsQuery, orderUID)
+	rows, err := q.QueryContext(ctx, itemsQuery, orderUID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get items: %w", err)
 	}
@@ -208,26 +441,50 @@ func (r *PostgresRepository) GetOrderByUID(orderUID string) (*model.Order, error
 		}
 		order.Items = append(order.Items, item)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate items: %w", err)
+	}
 
 	return order, nil
 }
 
-func (r *PostgresRepository) GetAllOrders() ([]*model.Order, error) {
-	query := `SELECT order_uid FROM orders ORDER BY date_created DESC`
-	rows, err := r.db.Query(query)
+func (r *PostgresRepository) GetAllOrders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, error) {
+	where, args := orderFilterClause(filter)
+	return r.getOrders(ctx, `SELECT order_uid FROM orders`+where, args...)
+}
+
+// GetOrdersByUIDs returns the orders among orderUIDs that exist and are not
+// deleted; the rest are left out.
+func (r *PostgresRepository) GetOrdersByUIDs(ctx context.Context, orderUIDs []string) ([]*model.Order, error) {
+	if len(orderUIDs) == 0 {
+		return nil, nil
+	}
+	return r.getOrders(ctx,
+		`SELECT order_uid FROM orders WHERE order_uid = ANY($1) AND deleted_at IS NULL`, pq.Array(orderUIDs))
+}
+
+func (r *PostgresRepository) getOrders(ctx context.Context, query string, args ...interface{}) ([]*model.Order, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get orders: %w", err)
 	}
 	defer rows.Close()
 
-	var orders []*model.Order
+	var orderUIDs []string
 	for rows.Next() {
 		var orderUID string
 		if err := rows.Scan(&orderUID); err != nil {
 			return nil, fmt.Errorf("failed to scan order UID: %w", err)
 		}
+		orderUIDs = append(orderUIDs, orderUID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate orders: %w", err)
+	}
 
-		order, err := r.GetOrderByUID(orderUID)
+	var orders []*model.Order
+	for _, orderUID := range orderUIDs {
+		order, err := r.getOrder(ctx, r.db, orderUID, false)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get order %s: %w", orderUID, err)
 		}
@@ -237,14 +494,167 @@ func (r *PostgresRepository) GetAllOrders() ([]*model.Order, error) {
 	return orders, nil
 }
 
-func (r *PostgresRepository) UpdateOrder(order *model.Order) error {
-	return r.CreateOrder(order)
+func (r *PostgresRepository) UpdateOrderStatus(ctx context.Context, orderUID string, from, to model.OrderStatus) (*model.Order, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := r.getOrder(ctx, tx, orderUID, true)
+	if err != nil {
+		return nil, err
+	}
+	if before.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	if before.Status != from {
+		return nil, ErrStatusConflict
+	}
+
+	after := before.Clone()
+	after.Status = to
+	err = tx.QueryRowContext(ctx,
+		`UPDATE orders SET status = $1, version = version + 1, updated_at = NOW() WHERE order_uid = $2 RETURNING version`,
+		to, orderUID).Scan(&after.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update order status: %w", err)
+	}
+
+	if err := r.recordEvent(ctx, tx, model.EventStatusChanged, orderUID, before, after); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return after, nil
 }
 
-func (r *PostgresRepository) DeleteOrder(orderUID string) error {
-	_, err := r.db.Exec("DELETE FROM orders WHERE order_uid = $1", orderUID)
+func (r *PostgresRepository) DeleteOrder(ctx context.Context, orderUID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := r.getOrder(ctx, tx, orderUID, true)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt != nil {
+		return ErrNotFound
+	}
+
+	after := before.Clone()
+	err = tx.QueryRowContext(ctx,
+		`UPDATE orders SET deleted_at = NOW(), version = version + 1, updated_at = NOW() WHERE order_uid = $1 RETURNING deleted_at, version`,
+		orderUID).Scan(&after.DeletedAt, &after.Version)
 	if err != nil {
 		return fmt.Errorf("failed to delete order: %w", err)
 	}
-	return nil
+
+	if err := r.recordEvent(ctx, tx, model.EventDeleted, orderUID, before, after); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresRepository) RestoreOrder(ctx context.Context, orderUID string) (*model.Order, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := r.getOrder(ctx, tx, orderUID, true)
+	if err != nil {
+		return nil, err
+	}
+	if before.DeletedAt == nil {
+		return nil, ErrNotDeleted
+	}
+
+	after := before.Clone()
+	after.DeletedAt = nil
+	err = tx.QueryRowContext(ctx,
+		`UPDATE orders SET deleted_at = NULL, version = version + 1, updated_at = NOW() WHERE order_uid = $1 RETURNING version`,
+		orderUID).Scan(&after.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore order: %w", err)
+	}
+	if err := r.recordEvent(ctx, tx, model.EventRestored, orderUID, before, after); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return after, nil
+}
+
+// purgeBatchSize bounds how many orders one purge transaction removes, so
+// that a large backlog does not hold row locks for long.
+const purgeBatchSize = 500
+
+// PurgeDeletedOrders removes orders soft-deleted before deletedBefore, one
+// batch per transaction.
+func (r *PostgresRepository) PurgeDeletedOrders(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var total int64
+	for {
+		purged, err := r.purgeDeletedBatch(ctx, deletedBefore)
+		total += int64(purged)
+		if err != nil || purged < purgeBatchSize {
+			return total, err
+		}
+	}
+}
+
+func (r *PostgresRepository) purgeDeletedBatch(ctx context.Context, deletedBefore time.Time) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		DELETE FROM orders WHERE order_uid IN (
+			SELECT order_uid FROM orders WHERE deleted_at IS NOT NULL AND deleted_at < $1
+			LIMIT $2 FOR UPDATE SKIP LOCKED
+		) RETURNING order_uid`, deletedBefore, purgeBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted orders: %w", err)
+	}
+
+	var purged []string
+	for rows.Next() {
+		var orderUID string
+		if err := rows.Scan(&orderUID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan purged order UID: %w", err)
+		}
+		purged = append(purged, orderUID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to iterate purged orders: %w", err)
+	}
+
+	if len(purged) > 0 {
+		if err := releaseTransactionKeys(ctx, tx, purged, ""); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, orderUID := range purged {
+		if err := r.recordEvent(ctx, tx, model.EventPurged, orderUID, nil, nil); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return len(purged), nil
 }
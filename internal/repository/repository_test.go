@@ -1,14 +1,35 @@
 package repository
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"regexp"
 	"testing"
+	"time"
 
 	"myapp/internal/model"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 )
 
+func orderRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"order_uid", "track_number", "entry", "locale", "internal_signature", "customer_id",
+		"delivery_service", "shardkey", "sm_id", "date_created", "oof_shard", "status", "deleted_at", "version"})
+}
+
+// expectOrderParts expects the delivery, payment and items reads that follow
+// the orders row in getOrder.
+func expectOrderParts(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM delivery")).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "phone", "zip", "city", "address", "region", "email"}).
+			AddRow("n", "1", "", "c", "a", "", ""))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM payment")).
+		WillReturnRows(sqlmock.NewRows([]string{"transaction", "request_id", "currency", "provider", "amount", "payment_dt",
+			"bank", "delivery_cost", "goods_total", "custom_fee"}).AddRow("txn", "", "USD", "p", 1, 1, "b", 0, 1, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM items")).WillReturnRows(sqlmock.NewRows([]string{"chrt_id"}))
+}
+
 func TestCreateOrder_InsertsAllParts(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -23,17 +44,689 @@ func TestCreateOrder_InsertsAllParts(t *testing.T) {
 	order.Items = []model.Item{{ChrtID: 1, TrackNumber: "t", Price: 1, RID: "r", Name: "n", TotalPrice: 1, NMID: 1, Brand: "b", Status: 1}}
 
 	mock.ExpectBegin()
-	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO orders")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO idempotency_keys")).
+		WithArgs("transaction:txn", idempotencyKindTransaction, "u", "").
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid"}).AddRow("u"))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO orders")).WillReturnRows(sqlmock.NewRows([]string{"status", "version"}).AddRow("created", 1))
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO delivery")).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO payment")).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM items WHERE order_uid = $1")).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO items")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO order_events")).
+		WithArgs("u", model.EventCreated, sqlmock.AnyArg(), nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := repo.CreateOrder(context.Background(), order); err != nil {
+		t.Fatalf("CreateOrder error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestCreateOrder_IgnoresPayloadStatus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := &PostgresRepository{db: db}
+	order := &model.Order{OrderUID: "u", Status: model.StatusDelivered}
+
+	arg := sqlmock.AnyArg()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO orders")).
+		WithArgs("u", arg, arg, arg, arg, arg, arg, arg, arg, arg, arg, model.StatusCreated).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "version"}).AddRow("created", 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO delivery")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO payment")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM items WHERE order_uid = $1")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO order_events")).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
-	if err := repo.CreateOrder(order); err != nil {
+	if err := repo.CreateOrder(context.Background(), order); err != nil {
 		t.Fatalf("CreateOrder error: %v", err)
 	}
+	if order.Status != model.StatusCreated {
+		t.Fatalf("expected status created, got %s", order.Status)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestCreateOrder_RejectsExistingUID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := &PostgresRepository{db: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("ON CONFLICT (order_uid) DO NOTHING")).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "version"}))
+	mock.ExpectRollback()
+
+	err = repo.CreateOrder(context.Background(), &model.Order{OrderUID: "u"})
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Fatalf("expected ErrAlreadyExists, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestUpsertOrder_SkipsProcessedMessage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := &PostgresRepository{db: db}
+	key := model.KafkaMessageKey("orders", 0, 42)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO idempotency_keys")).
+		WithArgs(key, idempotencyKindMessage, "u", "").
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid"}))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT order_uid, COALESCE(request_hash, '') FROM idempotency_keys")).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "request_hash"}).AddRow("u", ""))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM orders WHERE order_uid = $1")).
+		WillReturnRows(orderRows().AddRow("u", "stored", "e", "en", "", "c", "d", "9", 1, time.Now(), "1", "paid", nil, 3))
+	expectOrderParts(mock)
+	mock.ExpectRollback()
+
+	ctx := model.WithIdempotencyKey(context.Background(), key)
+	order := &model.Order{OrderUID: "u", TrackNumber: "incoming"}
+	err = repo.UpsertOrder(ctx, order)
+	if !errors.Is(err, ErrDuplicateMessage) {
+		t.Fatalf("expected ErrDuplicateMessage, got %v", err)
+	}
+	if order.TrackNumber != "stored" || order.Version != 3 {
+		t.Fatalf("expected the stored order, got %+v", order)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestCreateOrder_RejectsReusedKeyWithDifferentRequest(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := &PostgresRepository{db: db}
+	key := model.HTTPIdempotencyKey("k1")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO idempotency_keys")).
+		WithArgs(key, idempotencyKindMessage, "u", "new").
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid"}))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT order_uid, COALESCE(request_hash, '') FROM idempotency_keys")).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "request_hash"}).AddRow("u", "original"))
+	mock.ExpectRollback()
+
+	ctx := model.WithRequestHash(model.WithIdempotencyKey(context.Background(), key), "new")
+	if err := repo.CreateOrder(ctx, &model.Order{OrderUID: "u"}); !errors.Is(err, ErrIdempotencyMismatch) {
+		t.Fatalf("expected ErrIdempotencyMismatch, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestUpdateOrder_MissingOrder(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := &PostgresRepository{db: db}
 
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM orders WHERE order_uid = $1 FOR UPDATE")).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	err = repo.UpdateOrder(context.Background(), &model.Order{OrderUID: "u"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestPatchOrder_WritesOnlyChangedParts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := &PostgresRepository{db: db}
+	order := &model.Order{OrderUID: "u", TrackNumber: "t", Version: 1, Delivery: model.Delivery{Name: "n", Phone: "2"}}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM orders WHERE order_uid = $1 FOR UPDATE")).
+		WillReturnRows(orderRows().AddRow("u", "t", "e", "en", "", "c", "d", "9", 1, time.Now(), "1", "created", nil, 1))
+	expectOrderParts(mock)
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE orders SET")).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "version"}).AddRow("created", 2))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO delivery")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO order_events")).
+		WithArgs("u", model.EventUpdated, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := repo.PatchOrder(context.Background(), order, model.PartDelivery); err != nil {
+		t.Fatalf("PatchOrder error: %v", err)
+	}
+	if order.Version != 2 {
+		t.Fatalf("expected version 2, got %d", order.Version)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestDeleteItem_RecalculatesGoodsTotal(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := &PostgresRepository{db: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM orders WHERE order_uid = $1 FOR UPDATE")).
+		WillReturnRows(orderRows().AddRow("u", "t", "e", "en", "", "c", "d", "9", 1, time.Now(), "1", "created", nil, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM delivery")).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "phone", "zip", "city", "address", "region", "email"}).
+			AddRow("n", "1", "", "c", "a", "", ""))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM payment")).
+		WillReturnRows(sqlmock.NewRows([]string{"transaction", "request_id", "currency", "provider", "amount", "payment_dt",
+			"bank", "delivery_cost", "goods_total", "custom_fee"}).AddRow("txn", "", "USD", "p", 15, 1, "b", 0, 15, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM items")).
+		WillReturnRows(sqlmock.NewRows([]string{"chrt_id", "track_number", "price", "rid", "name", "sale", "size",
+			"total_price", "nm_id", "brand", "status"}).
+			AddRow(1, "t", 10, "r1", "n", 0, "0", 10, 1, "b", 202).
+			AddRow(2, "t", 5, "r2", "n", 0, "0", 5, 2, "b", 202))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM items WHERE order_uid = $1 AND rid = $2")).
+		WithArgs("u", "r2").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE payment SET goods_total")).
+		WillReturnRows(sqlmock.NewRows([]string{"goods_total", "amount"}).AddRow(10, 10))
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE orders SET version = version + 1")).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO order_events")).
+		WithArgs("u", model.EventUpdated, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	order, err := repo.DeleteItem(context.Background(), "u", "r2", nil)
+	if err != nil {
+		t.Fatalf("DeleteItem error: %v", err)
+	}
+	if len(order.Items) != 1 || order.Payment.GoodsTotal != 10 || order.Payment.Amount != 10 || order.Version != 2 {
+		t.Fatalf("unexpected order after delete: %+v", order)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestDeleteItem_KeepsLastItem(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := &PostgresRepository{db: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM orders WHERE order_uid = $1 FOR UPDATE")).
+		WillReturnRows(orderRows().AddRow("u", "t", "e", "en", "", "c", "d", "9", 1, time.Now(), "1", "created", nil, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM delivery")).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "phone", "zip", "city", "address", "region", "email"}).
+			AddRow("n", "1", "", "c", "a", "", ""))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM payment")).
+		WillReturnRows(sqlmock.NewRows([]string{"transaction", "request_id", "currency", "provider", "amount", "payment_dt",
+			"bank", "delivery_cost", "goods_total", "custom_fee"}).AddRow("txn", "", "USD", "p", 10, 1, "b", 0, 10, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM items")).
+		WillReturnRows(sqlmock.NewRows([]string{"chrt_id", "track_number", "price", "rid", "name", "sale", "size",
+			"total_price", "nm_id", "brand", "status"}).
+			AddRow(1, "t", 10, "r1", "n", 0, "0", 10, 1, "b", 202))
+	mock.ExpectRollback()
+
+	if _, err := repo.DeleteItem(context.Background(), "u", "r1", nil); !errors.Is(err, ErrLastItem) {
+		t.Fatalf("expected ErrLastItem, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestDeleteOrder_SoftDeletes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := &PostgresRepository{db: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM orders WHERE order_uid = $1 FOR UPDATE")).
+		WillReturnRows(orderRows().AddRow("u", "t", "e", "en", "", "c", "d", "9", 1, time.Now(), "1", "created", nil, 1))
+	expectOrderParts(mock)
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE orders SET deleted_at = NOW(), version = version + 1")).
+		WillReturnRows(sqlmock.NewRows([]string{"deleted_at", "version"}).AddRow(time.Now(), 2))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO order_events")).
+		WithArgs("u", model.EventDeleted, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := repo.DeleteOrder(context.Background(), "u"); err != nil {
+		t.Fatalf("DeleteOrder error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestUpdateOrder_RejectsStaleVersion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := &PostgresRepository{db: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM orders WHERE order_uid = $1 FOR UPDATE")).
+		WillReturnRows(orderRows().AddRow("u", "t", "e", "en", "", "c", "d", "9", 1, time.Now(), "1", "created", nil, 5))
+	expectOrderParts(mock)
+	mock.ExpectRollback()
+
+	err = repo.UpdateOrder(context.Background(), &model.Order{OrderUID: "u", Version: 4})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestUpdateOrder_ReleasesReplacedTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := &PostgresRepository{db: db}
+	order := &model.Order{OrderUID: "u", TrackNumber: "t", Version: 1, Payment: model.Payment{Transaction: "txn2"}}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO idempotency_keys")).
+		WithArgs("transaction:txn2", idempotencyKindTransaction, "u", "").
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid"}).AddRow("u"))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM orders WHERE order_uid = $1 FOR UPDATE")).
+		WillReturnRows(orderRows().AddRow("u", "t", "e", "en", "", "c", "d", "9", 1, time.Now(), "1", "created", nil, 1))
+	expectOrderParts(mock)
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE orders SET")).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "version"}).AddRow("created", 2))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM idempotency_keys WHERE kind = $1 AND order_uid = ANY($2) AND key <> $3")).
+		WithArgs(idempotencyKindTransaction, sqlmock.AnyArg(), "transaction:txn2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO payment")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO order_events")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := repo.PatchOrder(context.Background(), order, model.PartPayment); err != nil {
+		t.Fatalf("PatchOrder error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestUpsertOrder_RejectsStaleVersion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := &PostgresRepository{db: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM orders WHERE order_uid = $1 FOR UPDATE")).
+		WillReturnRows(orderRows().AddRow("u", "t", "e", "en", "", "c", "d", "9", 1, time.Now(), "1", "created", nil, 5))
+	expectOrderParts(mock)
+	mock.ExpectRollback()
+
+	// The sender saw version 4, but the order has been changed since.
+	err = repo.UpsertOrder(context.Background(), &model.Order{OrderUID: "u", TrackNumber: "changed", Version: 4})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestPurgeDeletedOrders_ReleasesTransactions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := &PostgresRepository{db: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("DELETE FROM orders WHERE order_uid IN")).
+		WithArgs(sqlmock.AnyArg(), purgeBatchSize).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid"}).AddRow("a").AddRow("b"))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM idempotency_keys WHERE kind = $1 AND order_uid = ANY($2)")).
+		WithArgs(idempotencyKindTransaction, sqlmock.AnyArg(), "").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	for _, uid := range []string{"a", "b"} {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO order_events")).
+			WithArgs(uid, model.EventPurged, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectCommit()
+
+	purged, err := repo.PurgeDeletedOrders(context.Background(), time.Now())
+	if err != nil {
+		t.Fatalf("PurgeDeletedOrders error: %v", err)
+	}
+	if purged != 2 {
+		t.Fatalf("expected 2 purged orders, got %d", purged)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestDiffJSON_ReportsChangedPaths(t *testing.T) {
+	before := []byte(`{"delivery":{"city":"Moscow","phone":"1"},"items":[{"price":10}]}`)
+	after := []byte(`{"delivery":{"city":"Kazan","phone":"1"},"items":[{"price":10},{"price":5}]}`)
+
+	changes, err := diffJSON(before, after)
+	if err != nil {
+		t.Fatalf("diffJSON error: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %+v", changes)
+	}
+	if changes[0].Path != "delivery.city" || changes[0].From != "Moscow" || changes[0].To != "Kazan" {
+		t.Fatalf("unexpected change: %+v", changes[0])
+	}
+	if changes[1].Path != "items[1].price" || changes[1].From != nil || changes[1].To != float64(5) {
+		t.Fatalf("unexpected change: %+v", changes[1])
+	}
+}
+
+func TestGetOrderParts_BatchesByPart(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := &PostgresRepository{db: db}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT order_uid FROM orders WHERE order_uid = ANY($1)")).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid"}).AddRow("uid1").AddRow("uid2"))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM delivery WHERE order_uid = ANY($1)")).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "name", "phone", "zip", "city", "address", "region", "email"}).
+			AddRow("uid1", "n", "1", "", "Moscow", "a", "", "").
+			AddRow("uid2", "n", "2", "", "Kazan", "a", "", ""))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM items WHERE order_uid = ANY($1)")).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "chrt_id", "track_number", "price", "rid", "name", "sale", "size",
+			"total_price", "nm_id", "brand", "status"}).
+			AddRow("uid2", 1, "trk", 10, "rid1", "nm", 0, "0", 10, 1, "br", 1).
+			AddRow("uid2", 2, "trk", 5, "rid2", "nm", 0, "0", 5, 2, "br", 1))
+
+	orders, err := repo.GetOrderParts(context.Background(), []string{"uid1", "uid2", "purged"}, model.PartDelivery|model.PartItems)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, ok := orders["purged"]; ok || len(orders) != 2 {
+		t.Fatalf("expected the missing order to be left out, got %v", orders)
+	}
+	if orders["uid1"].Delivery.City != "Moscow" || orders["uid2"].Delivery.City != "Kazan" {
+		t.Fatalf("unexpected deliveries: %+v %+v", orders["uid1"].Delivery, orders["uid2"].Delivery)
+	}
+	if len(orders["uid1"].Items) != 0 || len(orders["uid2"].Items) != 2 {
+		t.Fatalf("unexpected items: %+v %+v", orders["uid1"].Items, orders["uid2"].Items)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestExportOrders_ReadsOneSnapshot(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := &PostgresRepository{db: db}
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DECLARE export_orders NO SCROLL CURSOR FOR")).
+		WithArgs("meest").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("FETCH 500 FROM export_orders")).
+		WillReturnRows(orderRows().AddRow("uid1", "trk", "e", "en", "", "c", "meest", "1", 1, time.Now(), "1", "created", nil, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT order_uid FROM orders WHERE order_uid = ANY($1)")).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid"}).AddRow("uid1"))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM delivery WHERE order_uid = ANY($1)")).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "name", "phone", "zip", "city", "address", "region", "email"}).
+			AddRow("uid1", "n", "1", "", "Moscow", "a", "", ""))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM payment WHERE order_uid = ANY($1)")).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "transaction", "request_id", "currency", "provider", "amount",
+			"payment_dt", "bank", "delivery_cost", "goods_total", "custom_fee"}))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM items WHERE order_uid = ANY($1)")).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "chrt_id", "track_number", "price", "rid", "name", "sale", "size",
+			"total_price", "nm_id", "brand", "status"}))
+	mock.ExpectCommit()
+
+	var exported []*model.Order
+	err = repo.ExportOrders(context.Background(), model.OrderFilter{DeliveryService: "meest"}, func(order *model.Order) error {
+		exported = append(exported, order)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(exported) != 1 || exported[0].Delivery.City != "Moscow" {
+		t.Fatalf("unexpected export: %+v", exported)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestOrderFilterClause(t *testing.T) {
+	where, args := orderFilterClause(model.OrderFilter{
+		Status:       model.StatusPaid,
+		CustomerID:   "cust",
+		CreatedAfter: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Limit:        10,
+		Offset:       20,
+	})
+	want := " WHERE deleted_at IS NULL AND status = $1 AND customer_id = $2 AND date_created >= $3" +
+		" ORDER BY date_created DESC LIMIT $4 OFFSET $5"
+	if where != want {
+		t.Fatalf("unexpected clause:\n got %q\nwant %q", where, want)
+	}
+	if len(args) != 5 || args[3] != 10 || args[4] != 20 {
+		t.Fatalf("unexpected args: %v", args)
+	}
+}
+
+func TestRecordWebhookResults_CountsFailuresPerRound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := &PostgresRepository{db: db}
+	retryAt := time.Now().Add(time.Minute)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE webhook_deliveries SET")).
+		WithArgs(int64(5), model.DeliveryPending, &retryAt, 503, "unexpected status 503").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE webhook_deliveries SET")).
+		WithArgs(int64(6), model.DeliveryPending, &retryAt, 503, "unexpected status 503").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE webhook_deliveries SET")).
+		WithArgs(int64(7), model.DeliverySucceeded, nil, 200, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE webhooks SET consecutive_failures = 0")).
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Two failed deliveries of webhook 2 count once.
+	mock.ExpectExec(regexp.QuoteMeta("consecutive_failures = consecutive_failures + 1")).
+		WithArgs(int64(2), 20).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = repo.RecordWebhookResults(context.Background(), []model.WebhookResult{
+		{DeliveryID: 5, WebhookID: 2, ResponseStatus: 503, Error: "unexpected status 503", RetryAt: &retryAt},
+		{DeliveryID: 6, WebhookID: 2, ResponseStatus: 503, Error: "unexpected status 503", RetryAt: &retryAt},
+		{DeliveryID: 7, WebhookID: 1, ResponseStatus: 200, Succeeded: true},
+	}, 20)
+	if err != nil {
+		t.Fatalf("RecordWebhookResults error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestRelayOutbox_RemovesOnlyPublishedEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := &PostgresRepository{db: db}
+	eventRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "xid", "order_uid", "event_type", "actor", "before", "after", "diff", "created_at"}).
+			AddRow(7, "12", "u", "created", []byte(`{"type":"http"}`), nil, []byte(`{}`), nil, time.Now())
+	}
+	expectBatch := func() {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("pg_try_advisory_xact_lock")).
+			WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS (SELECT 1 FROM outbox WHERE claimed_until > NOW())")).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(regexp.QuoteMeta("UPDATE outbox SET claimed_until")).
+			WithArgs(100, float64(60)).WillReturnRows(eventRows())
+		mock.ExpectCommit()
+	}
+
+	// The claim is committed before publishing, and released when it fails.
+	expectBatch()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE outbox SET claimed_until = NULL WHERE event_id = ANY($1)")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = repo.RelayOutbox(context.Background(), 100, time.Minute, func([]model.OrderEvent) error { return errors.New("broker down") })
+	if err == nil {
+		t.Fatal("expected publish error")
+	}
+
+	expectBatch()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM outbox WHERE event_id = ANY($1)")).WillReturnResult(sqlmock.NewResult(0, 1))
+	n, err := repo.RelayOutbox(context.Background(), 100, time.Minute, func(events []model.OrderEvent) error {
+		if len(events) != 1 || events[0].ID != 7 {
+			t.Fatalf("unexpected events: %+v", events)
+		}
+		return nil
+	})
+	if err != nil || n != 1 {
+		t.Fatalf("expected one relayed event, got %d, %v", n, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestRelayOutbox_WaitsForLeasedBatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := &PostgresRepository{db: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("pg_try_advisory_xact_lock")).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS (SELECT 1 FROM outbox WHERE claimed_until > NOW())")).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	n, err := repo.RelayOutbox(context.Background(), 100, time.Minute, func([]model.OrderEvent) error {
+		t.Fatal("expected nothing to publish while another batch is leased")
+		return nil
+	})
+	if err != nil || n != 0 {
+		t.Fatalf("expected nothing relayed, got %d, %v", n, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestGetEventPosition_UnknownID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := &PostgresRepository{db: db}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT xid FROM order_events WHERE id = $1")).
+		WithArgs(int64(42)).
+		WillReturnRows(sqlmock.NewRows([]string{"xid"}))
+
+	if _, err := repo.GetEventPosition(context.Background(), 42); !errors.Is(err, ErrEventNotFound) {
+		t.Fatalf("expected ErrEventNotFound, got %v", err)
+	}
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Fatalf("unmet expectations: %v", err)
 	}
@@ -0,0 +1,290 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"myapp/internal/model"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// WebhookRepository stores webhook subscriptions and their delivery queue.
+// Deliveries are enqueued by recordEvent together with the audit event.
+type WebhookRepository interface {
+	CreateWebhook(ctx context.Context, webhook *model.Webhook) error
+	GetWebhook(ctx context.Context, id int64) (*model.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]*model.Webhook, error)
+	UpdateWebhook(ctx context.Context, webhook *model.Webhook) error
+	DeleteWebhook(ctx context.Context, id int64) error
+	GetWebhookDeliveries(ctx context.Context, webhookID int64, limit int) ([]model.WebhookDelivery, error)
+	ClaimWebhookJobs(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookJob, error)
+	RecordWebhookResults(ctx context.Context, results []model.WebhookResult, disableAfter int) error
+}
+
+func NewWebhookRepository(db *sql.DB) WebhookRepository {
+	return &PostgresRepository{db: db}
+}
+
+const webhookColumns = `id, url, secret, event_types, active, consecutive_failures, disabled_at, created_at, updated_at`
+
+func (r *PostgresRepository) CreateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO webhooks (url, secret, event_types, active)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, consecutive_failures, created_at, updated_at`,
+		webhook.URL, webhook.Secret, pq.Array(eventTypeStrings(webhook.EventTypes)), webhook.Active,
+	).Scan(&webhook.ID, &webhook.ConsecutiveFailures, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresRepository) GetWebhook(ctx context.Context, id int64) (*model.Webhook, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = $1`, id)
+	webhook, err := scanWebhook(row.Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+func (r *PostgresRepository) ListWebhooks(ctx context.Context) ([]*model.Webhook, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+webhookColumns+` FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []*model.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// UpdateWebhook replaces the subscription. Re-activating a disabled webhook
+// clears its failure count.
+func (r *PostgresRepository) UpdateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	row := r.db.QueryRowContext(ctx, `
+		UPDATE webhooks SET
+			url = $2, secret = $3, event_types = $4, active = $5,
+			consecutive_failures = CASE WHEN $5 AND NOT active THEN 0 ELSE consecutive_failures END,
+			disabled_at = CASE WHEN $5 THEN NULL ELSE disabled_at END,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+webhookColumns,
+		webhook.ID, webhook.URL, webhook.Secret, pq.Array(eventTypeStrings(webhook.EventTypes)), webhook.Active)
+	updated, err := scanWebhook(row.Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrWebhookNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update webhook: %w", err)
+	}
+	*webhook = *updated
+	return nil
+}
+
+func (r *PostgresRepository) DeleteWebhook(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// GetWebhookDeliveries returns the latest deliveries of a webhook, newest
+// first.
+func (r *PostgresRepository) GetWebhookDeliveries(ctx context.Context, webhookID int64, limit int) ([]model.WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT d.id, d.webhook_id, d.event_id, e.event_type, e.order_uid, d.status, d.attempts,
+		       d.next_attempt_at, d.response_status, d.last_error, d.created_at, d.delivered_at
+		FROM webhook_deliveries d JOIN order_events e ON e.id = d.event_id
+		WHERE d.webhook_id = $1
+		ORDER BY d.id DESC LIMIT $2`, webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []model.WebhookDelivery{}
+	for rows.Next() {
+		var (
+			d              model.WebhookDelivery
+			nextAttemptAt  time.Time
+			responseStatus sql.NullInt64
+			lastError      sql.NullString
+		)
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.OrderUID, &d.Status, &d.Attempts,
+			&nextAttemptAt, &responseStatus, &lastError, &d.CreatedAt, &d.DeliveredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		if d.Status == model.DeliveryPending {
+			d.NextAttemptAt = &nextAttemptAt
+		}
+		d.ResponseStatus = int(responseStatus.Int64)
+		d.LastError = lastError.String
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// ClaimWebhookJobs takes up to limit due deliveries of active webhooks and
+// pushes their next attempt lease into the future, so other instances skip
+// them. A worker that dies mid-send leaves the delivery to be retried once
+// the lease expires.
+func (r *PostgresRepository) ClaimWebhookJobs(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookJob, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		WITH claimed AS (
+			UPDATE webhook_deliveries SET
+				attempts = attempts + 1,
+				next_attempt_at = NOW() + make_interval(secs => $2)
+			WHERE id IN (
+				SELECT d.id FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+				WHERE d.status = 'pending' AND d.next_attempt_at <= NOW() AND w.active
+				ORDER BY d.next_attempt_at
+				LIMIT $1
+				FOR UPDATE OF d SKIP LOCKED
+			)
+			RETURNING id, webhook_id, event_id, attempts
+		)
+		SELECT c.id, c.attempts, w.id, w.url, w.secret,
+		       e.id, e.event_type, e.order_uid, e.created_at, COALESCE(e.after, e.before)
+		FROM claimed c
+		JOIN webhooks w ON w.id = c.webhook_id
+		JOIN order_events e ON e.id = c.event_id
+		ORDER BY c.id`, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []model.WebhookJob
+	for rows.Next() {
+		var (
+			job   model.WebhookJob
+			order []byte
+		)
+		if err := rows.Scan(&job.DeliveryID, &job.Attempt, &job.Webhook.ID, &job.Webhook.URL, &job.Webhook.Secret,
+			&job.Payload.ID, &job.Payload.Type, &job.Payload.OrderUID, &job.Payload.OccurredAt, &order); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		job.Payload.Order = order
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate webhook deliveries: %w", err)
+	}
+	return jobs, nil
+}
+
+// RecordWebhookResults stores the outcomes of one dispatch round. A webhook
+// with any success in the round has its failure count reset; otherwise the
+// round counts as a single failure, however many of its deliveries were sent
+// concurrently, and the webhook is disabled after disableAfter consecutive
+// failed rounds.
+func (r *PostgresRepository) RecordWebhookResults(ctx context.Context, results []model.WebhookResult, disableAfter int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	succeeded := make(map[int64]bool)
+	for _, result := range results {
+		status := model.DeliveryFailed
+		switch {
+		case result.Succeeded:
+			status = model.DeliverySucceeded
+		case result.RetryAt != nil:
+			status = model.DeliveryPending
+		}
+
+		var responseStatus interface{}
+		if result.ResponseStatus != 0 {
+			responseStatus = result.ResponseStatus
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE webhook_deliveries SET
+				status = $2,
+				next_attempt_at = COALESCE($3, next_attempt_at),
+				response_status = $4,
+				last_error = NULLIF($5, ''),
+				delivered_at = CASE WHEN $2 = 'succeeded' THEN NOW() ELSE NULL END
+			WHERE id = $1`,
+			result.DeliveryID, status, result.RetryAt, responseStatus, result.Error); err != nil {
+			return fmt.Errorf("failed to record webhook delivery %d: %w", result.DeliveryID, err)
+		}
+		succeeded[result.WebhookID] = succeeded[result.WebhookID] || result.Succeeded
+	}
+
+	// Webhooks are updated in ID order so concurrent rounds lock them in
+	// the same order.
+	webhookIDs := make([]int64, 0, len(succeeded))
+	for id := range succeeded {
+		webhookIDs = append(webhookIDs, id)
+	}
+	sort.Slice(webhookIDs, func(i, j int) bool { return webhookIDs[i] < webhookIDs[j] })
+	for _, id := range webhookIDs {
+		if succeeded[id] {
+			_, err = tx.ExecContext(ctx, `UPDATE webhooks SET consecutive_failures = 0 WHERE id = $1`, id)
+		} else {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE webhooks SET
+					consecutive_failures = consecutive_failures + 1,
+					active = active AND consecutive_failures + 1 < $2,
+					disabled_at = CASE WHEN active AND consecutive_failures + 1 >= $2 THEN NOW() ELSE disabled_at END
+				WHERE id = $1`, id, disableAfter)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update webhook failures: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func scanWebhook(scan func(...interface{}) error) (*model.Webhook, error) {
+	var (
+		webhook    model.Webhook
+		eventTypes []string
+	)
+	if err := scan(&webhook.ID, &webhook.URL, &webhook.Secret, pq.Array(&eventTypes), &webhook.Active,
+		&webhook.ConsecutiveFailures, &webhook.DisabledAt, &webhook.CreatedAt, &webhook.UpdatedAt); err != nil {
+		return nil, err
+	}
+	for _, eventType := range eventTypes {
+		webhook.EventTypes = append(webhook.EventTypes, model.OrderEventType(eventType))
+	}
+	return &webhook, nil
+}
+
+func eventTypeStrings(types []model.OrderEventType) []string {
+	strs := make([]string, len(types))
+	for i, t := range types {
+		strs[i] = string(t)
+	}
+	return strs
+}
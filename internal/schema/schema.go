@@ -0,0 +1,258 @@
+// Package schema derives a JSON Schema for the order payload from the model
+// structs and their validate tags, and checks raw payloads against it.
+package schema
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"myapp/internal/model"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is the subset of JSON Schema 2020-12 the generator emits.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	ID                   string             `json:"$id,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Const                interface{}        `json:"const,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Not                  *Schema            `json:"not,omitempty"`
+}
+
+var (
+	orderOnce    sync.Once
+	orderSchema  []byte
+	orderVersion string
+)
+
+// Order returns the published order schema and its version, a digest of the
+// schema that changes whenever the model does.
+func Order() ([]byte, string) {
+	orderOnce.Do(func() {
+		s := Generate(reflect.TypeOf(model.Order{}))
+		s.Schema = draft
+		s.ID = "/api/v1/schema/order"
+		s.Title = "Order"
+
+		data, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			panic("schema: failed to encode order schema: " + err.Error())
+		}
+		digest := sha256.Sum256(data)
+		orderSchema, orderVersion = data, hex.EncodeToString(digest[:6])
+	})
+	return orderSchema, orderVersion
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+// Generate builds the schema of t. Struct fields are named by their json tags
+// and constrained by their validate tags.
+func Generate(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawJSONType:
+		return &Schema{}
+	case t.Kind() == reflect.Ptr:
+		return &Schema{AnyOf: []*Schema{{Type: "null"}, Generate(t.Elem())}}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return generateStruct(t)
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: Generate(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: Generate(t.Elem())}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	default:
+		return &Schema{}
+	}
+}
+
+func generateStruct(t reflect.Type) *Schema {
+	s := &Schema{
+		Type:                 "object",
+		Properties:           make(map[string]*Schema),
+		AdditionalProperties: false,
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop, required := constrain(Generate(field.Type), field.Tag.Get("validate"))
+		s.Properties[name] = prop
+		if required {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
+
+// constrain applies a validate tag to the schema of a field and reports
+// whether the field is required.
+func constrain(s *Schema, tag string) (*Schema, bool) {
+	if tag == "" {
+		return s, false
+	}
+
+	required, omitempty := false, false
+	target := s
+	for _, rule := range strings.Split(tag, ",") {
+		switch rule {
+		case "required":
+			required = true
+			continue
+		case "omitempty":
+			omitempty = true
+			continue
+		case "dive":
+			if s.Items != nil {
+				target = s.Items
+			}
+			continue
+		}
+
+		alternatives := strings.Split(rule, "|")
+		if len(alternatives) == 1 {
+			applyRule(target, rule)
+			continue
+		}
+		for _, alt := range alternatives {
+			option := &Schema{Type: target.Type}
+			applyRule(option, alt)
+			target.AnyOf = append(target.AnyOf, option)
+		}
+	}
+
+	if required {
+		requireNonZero(s)
+	}
+	if omitempty && s.Type == "string" && restrictsEmpty(s) {
+		empty := 0
+		constrained := *s
+		return &Schema{AnyOf: []*Schema{{Type: "string", MaxLength: &empty}, &constrained}}, false
+	}
+	return s, required
+}
+
+// applyRule maps one go-playground validator rule onto JSON Schema keywords.
+// Length rules bound strings and arrays but the value of numbers.
+func applyRule(s *Schema, rule string) {
+	name, param, _ := strings.Cut(rule, "=")
+	n, _ := strconv.Atoi(param)
+	f, _ := strconv.ParseFloat(param, 64)
+
+	switch name {
+	case "min", "max", "len":
+		switch s.Type {
+		case "string":
+			if name != "max" {
+				s.MinLength = &n
+			}
+			if name != "min" {
+				s.MaxLength = &n
+			}
+		case "array":
+			if name != "max" {
+				s.MinItems = &n
+			}
+			if name != "min" {
+				s.MaxItems = &n
+			}
+		default:
+			if name != "max" {
+				s.Minimum = &f
+			}
+			if name != "min" {
+				s.Maximum = &f
+			}
+		}
+	case "gt":
+		s.ExclusiveMinimum = &f
+	case "gte":
+		s.Minimum = &f
+	case "lt":
+		s.ExclusiveMaximum = &f
+	case "lte":
+		s.Maximum = &f
+	case "oneof":
+		for _, value := range strings.Fields(param) {
+			s.Enum = append(s.Enum, value)
+		}
+	case "email":
+		s.Format = "email"
+	case "uppercase":
+		s.Pattern = "^[^a-z]*$"
+	case "alphanumunicode":
+		s.Pattern = `^[\p{L}\p{N}]*$`
+	}
+}
+
+// requireNonZero matches the validator's required rule, which also rejects
+// zero values.
+func requireNonZero(s *Schema) {
+	switch s.Type {
+	case "string":
+		if s.MinLength == nil {
+			one := 1
+			s.MinLength = &one
+		}
+	case "integer", "number":
+		if s.Minimum == nil && s.ExclusiveMinimum == nil {
+			s.Not = &Schema{Const: 0}
+		}
+	case "array":
+		if s.MinItems == nil {
+			one := 1
+			s.MinItems = &one
+		}
+	}
+}
+
+func restrictsEmpty(s *Schema) bool {
+	return (s.MinLength != nil && *s.MinLength > 0) || s.Format != "" || len(s.Enum) > 0
+}
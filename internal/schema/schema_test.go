@@ -0,0 +1,66 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"myapp/internal/model/modeltest"
+	"myapp/internal/validation"
+)
+
+func TestOrder_FollowsValidateTags(t *testing.T) {
+	data, version := Order()
+	if version == "" {
+		t.Fatal("expected a schema version")
+	}
+
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatalf("invalid schema json: %v", err)
+	}
+	price := s.Properties["items"].Items.Properties["price"]
+	if price.Type != "integer" || price.ExclusiveMinimum == nil || *price.ExclusiveMinimum != 0 {
+		t.Fatalf("unexpected items.price schema: %+v", price)
+	}
+	if len(s.Properties["locale"].AnyOf) != 2 {
+		t.Fatalf("expected len=2|len=5 to become anyOf, got %+v", s.Properties["locale"])
+	}
+	for _, name := range s.Required {
+		if name == "internal_signature" || name == "status" {
+			t.Fatalf("%s must not be required", name)
+		}
+	}
+}
+
+func TestValidator_ReportsViolations(t *testing.T) {
+	v, err := NewOrderValidator()
+	if err != nil {
+		t.Fatalf("failed to build validator: %v", err)
+	}
+
+	valid, _ := json.Marshal(modeltest.Order())
+	if err := v.Validate(valid); err != nil {
+		t.Fatalf("expected sample order to match the schema, got %v", err)
+	}
+
+	invalid := modeltest.Order()
+	invalid.Items[0].Price = -1
+	data, _ := json.Marshal(invalid)
+	var doc map[string]interface{}
+	_ = json.Unmarshal(data, &doc)
+	doc["trak_number"] = "typo"
+	data, _ = json.Marshal(doc)
+
+	var violations *validation.ViolationsError
+	if err := v.Validate(data); !errors.As(err, &violations) {
+		t.Fatalf("expected ViolationsError, got %v", err)
+	}
+	got := map[string]string{}
+	for _, violation := range violations.Violations {
+		got[violation.Field] = violation.Rule
+	}
+	if got["items[0].price"] != "exclusiveMinimum" || got[""] != "additionalProperties" {
+		t.Fatalf("unexpected violations: %+v", violations.Violations)
+	}
+}
@@ -0,0 +1,92 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"myapp/internal/validation"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Validator checks raw payloads against the published order schema.
+type Validator struct {
+	schema  *jsonschema.Schema
+	version string
+}
+
+func NewOrderValidator() (*Validator, error) {
+	data, version := Order()
+
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	compiler.AssertFormat = true
+	if err := compiler.AddResource("order.json", bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("failed to load order schema: %w", err)
+	}
+	compiled, err := compiler.Compile("order.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile order schema: %w", err)
+	}
+	return &Validator{schema: compiled, version: version}, nil
+}
+
+// Version is the schema version payloads are checked against.
+func (v *Validator) Version() string { return v.version }
+
+// Validate returns *validation.ViolationsError listing every schema keyword
+// the payload breaks, with the rule set to the keyword.
+func (v *Validator) Validate(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
+	}
+
+	err := v.schema.Validate(doc)
+	var schemaErr *jsonschema.ValidationError
+	if !errors.As(err, &schemaErr) {
+		return err
+	}
+
+	var violations []validation.Violation
+	for _, e := range schemaErr.BasicOutput().Errors {
+		// Only leaf errors say what is wrong; the rest just point at them.
+		if e.Error == "" || strings.HasPrefix(e.Error, "doesn't validate with") {
+			continue
+		}
+		violations = append(violations, validation.Violation{
+			Rule:    keyword(e.KeywordLocation),
+			Field:   fieldPath(e.InstanceLocation),
+			Message: e.Error,
+		})
+	}
+	return &validation.ViolationsError{Violations: violations}
+}
+
+func keyword(location string) string {
+	return location[strings.LastIndex(location, "/")+1:]
+}
+
+// fieldPath turns a JSON pointer such as /items/0/price into items[0].price.
+func fieldPath(pointer string) string {
+	var path strings.Builder
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if token == "" {
+			continue
+		}
+		if strings.Trim(token, "0123456789") == "" {
+			path.WriteString("[" + token + "]")
+			continue
+		}
+		if path.Len() > 0 {
+			path.WriteString(".")
+		}
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		path.WriteString(token)
+	}
+	return path.String()
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"myapp/internal/model"
+	"myapp/internal/repository"
+)
+
+var (
+	ErrItemNotFound      = repository.ErrItemNotFound
+	ErrItemAlreadyExists = repository.ErrItemAlreadyExists
+	ErrLastItem          = repository.ErrLastItem
+	ErrInvalidItem       = errors.New("invalid order item")
+)
+
+func (s *OrderService) GetOrderItems(ctx context.Context, orderUID string) ([]model.Item, error) {
+	order, err := s.GetOrderByUID(ctx, orderUID, false)
+	if err != nil {
+		return nil, err
+	}
+	return order.Items, nil
+}
+
+func (s *OrderService) GetOrderItem(ctx context.Context, orderUID, rid string) (*model.Item, error) {
+	order, err := s.GetOrderByUID(ctx, orderUID, false)
+	if err != nil {
+		return nil, err
+	}
+	item, exists := order.Item(rid)
+	if !exists {
+		return nil, ErrItemNotFound
+	}
+	return item, nil
+}
+
+// AddOrderItem, UpdateOrderItem and DeleteOrderItem change a single item and
+// return the whole order, whose totals and version change with it. The
+// resulting order must pass the same validation as a full update.
+func (s *OrderService) AddOrderItem(ctx context.Context, orderUID string, item model.Item) (*model.Order, error) {
+	if err := s.validateItem(item); err != nil {
+		return nil, fmt.Errorf("item validation failed: %w", err)
+	}
+
+	order, err := s.repo.AddItem(ctx, orderUID, item, func(order *model.Order) error {
+		if err := s.decoder.CheckItems(order); err != nil {
+			return err
+		}
+		return s.checkItemChange(order)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add item: %w", err)
+	}
+
+	s.cache.Delete(orderUID)
+	log.Printf("Item %s added to order %s", item.RID, orderUID)
+	return order, nil
+}
+
+func (s *OrderService) UpdateOrderItem(ctx context.Context, orderUID, rid string, item model.Item) (*model.Order, error) {
+	if item.RID == "" {
+		item.RID = rid
+	}
+	if item.RID != rid {
+		return nil, fmt.Errorf("%w: rid %q does not match %q", ErrInvalidItem, item.RID, rid)
+	}
+	if err := s.validateItem(item); err != nil {
+		return nil, fmt.Errorf("item validation failed: %w", err)
+	}
+
+	order, err := s.repo.UpdateItem(ctx, orderUID, item, s.checkItemChange)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update item: %w", err)
+	}
+
+	s.cache.Delete(orderUID)
+	log.Printf("Item %s of order %s updated", rid, orderUID)
+	return order, nil
+}
+
+func (s *OrderService) DeleteOrderItem(ctx context.Context, orderUID, rid string) (*model.Order, error) {
+	order, err := s.repo.DeleteItem(ctx, orderUID, rid, s.checkItemChange)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete item: %w", err)
+	}
+
+	s.cache.Delete(orderUID)
+	log.Printf("Item %s deleted from order %s", rid, orderUID)
+	return order, nil
+}
+
+func (s *OrderService) validateItem(item model.Item) error {
+	return s.validator.ValidateStruct(item)
+}
+
+func (s *OrderService) checkItemChange(order *model.Order) error {
+	if err := s.validateOrder(order); err != nil {
+		return fmt.Errorf("order validation failed: %w", err)
+	}
+	return nil
+}
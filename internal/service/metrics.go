@@ -21,4 +21,14 @@ var (
 		Help:    "Time spent processing orders",
 		Buckets: prometheus.DefBuckets,
 	})
+
+	ordersDuplicatesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "orders_duplicates_total",
+		Help: "Total number of duplicate orders skipped by idempotency key kind",
+	}, []string{"kind"})
+
+	orderStatusChangesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "order_status_changes_total",
+		Help: "Total number of order status changes by target status",
+	}, []string{"status"})
 )
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"myapp/internal/model"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+var ErrInvalidPatch = errors.New("invalid patch")
+
+type PatchFormat string
+
+const (
+	// MergePatch is an RFC 7396 JSON Merge Patch.
+	MergePatch PatchFormat = "merge"
+	// JSONPatch is an RFC 6902 JSON Patch.
+	JSONPatch PatchFormat = "json"
+)
+
+// PatchOrder applies patch to the stored order, validates the result and
+// saves only the sub-entities it changed. A non-zero expectedVersion must
+// match the stored version; the save itself is always conditional on the
+// version the patch was applied to.
+func (s *OrderService) PatchOrder(ctx context.Context, orderUID string, format PatchFormat, patch []byte, expectedVersion int64) (*model.Order, error) {
+	stored, err := s.repo.GetOrderByUID(ctx, orderUID, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	if expectedVersion != 0 && stored.Version != expectedVersion {
+		return nil, fmt.Errorf("%w: expected %d, current %d", ErrVersionConflict, expectedVersion, stored.Version)
+	}
+
+	patched, err := s.applyPatch(stored, format, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.validateOrder(patched); err != nil {
+		return nil, fmt.Errorf("order validation failed: %w", err)
+	}
+
+	patched.Version = stored.Version
+	if err := s.repo.PatchOrder(ctx, patched, model.ChangedParts(stored, patched)); err != nil {
+		return nil, fmt.Errorf("failed to patch order in database: %w", err)
+	}
+
+	s.cache.Set(patched.OrderUID, patched)
+
+	log.Printf("Order %s patched successfully", patched.OrderUID)
+	return patched, nil
+}
+
+// applyPatch decodes the patched document like a request body, so the
+// strict mode and item limit apply to it as well.
+func (s *OrderService) applyPatch(stored *model.Order, format PatchFormat, patch []byte) (*model.Order, error) {
+	doc, err := json.Marshal(stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode order: %w", err)
+	}
+
+	switch format {
+	case MergePatch:
+		doc, err = jsonpatch.MergePatch(doc, patch)
+	case JSONPatch:
+		var operations jsonpatch.Patch
+		if operations, err = jsonpatch.DecodePatch(patch); err == nil {
+			doc, err = operations.Apply(doc)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported format %q", ErrInvalidPatch, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	var patched model.Order
+	if err := s.decoder.Decode(doc, &patched); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPatch, err)
+	}
+
+	if err := checkReadOnlyFields(stored, &patched); err != nil {
+		return nil, err
+	}
+	return &patched, nil
+}
+
+// checkReadOnlyFields rejects patches to fields that have their own endpoints.
+func checkReadOnlyFields(stored, patched *model.Order) error {
+	switch {
+	case patched.OrderUID != stored.OrderUID:
+		return fmt.Errorf("%w: order_uid is read-only", ErrInvalidPatch)
+	case patched.Status != stored.Status:
+		return fmt.Errorf("%w: status is read-only, use the status endpoint", ErrInvalidPatch)
+	case (patched.DeletedAt == nil) != (stored.DeletedAt == nil):
+		return fmt.Errorf("%w: deleted_at is read-only", ErrInvalidPatch)
+	}
+	return nil
+}
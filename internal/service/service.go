@@ -1,42 +1,146 @@
 package service
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"myapp/internal/cache"
+	"myapp/internal/decode"
 	"myapp/internal/model"
 	"myapp/internal/repository"
+	"myapp/internal/validation"
 	"time"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+var (
+	ErrNotFound   = repository.ErrNotFound
+	ErrNotDeleted = repository.ErrNotDeleted
+
+	ErrVersionConflict = repository.ErrVersionConflict
+	ErrAlreadyExists   = repository.ErrAlreadyExists
+
+	ErrDuplicateMessage     = repository.ErrDuplicateMessage
+	ErrDuplicateTransaction = repository.ErrDuplicateTransaction
+	ErrIdempotencyMismatch  = repository.ErrIdempotencyMismatch
+
+	ErrEventNotFound = repository.ErrEventNotFound
+)
+
+// eventPageSize bounds a single read of the audit log.
+const eventPageSize = 500
+
 type Service interface {
-	ProcessOrder(order *model.Order) error
-	GetOrderByUID(orderUID string) (*model.Order, error)
-	GetAllOrders() ([]*model.Order, error)
-	UpdateOrder(order *model.Order) error
-	DeleteOrder(orderUID string) error
+	ProcessOrder(ctx context.Context, order *model.Order) error
+	CreateOrder(ctx context.Context, order *model.Order) error
+	GetOrderByUID(ctx context.Context, orderUID string, includeDeleted bool) (*model.Order, error)
+	GetOrderJSON(ctx context.Context, orderUID string) ([]byte, int64, error)
+	GetAllOrders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, error)
+	GetOrderHeaders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, error)
+	GetOrderParts(ctx context.Context, orderUIDs []string, parts model.OrderParts) (map[string]*model.Order, error)
+	ExportOrders(ctx context.Context, filter model.OrderFilter, fn func(*model.Order) error) error
+	UpdateOrder(ctx context.Context, order *model.Order) error
+	PatchOrder(ctx context.Context, orderUID string, format PatchFormat, patch []byte, expectedVersion int64) (*model.Order, error)
+	ChangeOrderStatus(ctx context.Context, change *model.StatusChange) (*model.Order, error)
+	DeleteOrder(ctx context.Context, orderUID string) error
+	RestoreOrder(ctx context.Context, orderUID string) (*model.Order, error)
+	PurgeDeletedOrders(ctx context.Context, retention time.Duration) (int64, error)
+	PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration) (int64, error)
+	GetOrderHistory(ctx context.Context, orderUID string) ([]model.OrderEvent, error)
+	GetEventsSince(ctx context.Context, after model.EventPosition, limit int) ([]model.OrderEvent, error)
+	GetEventHorizon(ctx context.Context) (model.EventPosition, error)
+	GetEventPosition(ctx context.Context, id int64) (model.EventPosition, error)
+	GetOrderItems(ctx context.Context, orderUID string) ([]model.Item, error)
+	GetOrderItem(ctx context.Context, orderUID, rid string) (*model.Item, error)
+	AddOrderItem(ctx context.Context, orderUID string, item model.Item) (*model.Order, error)
+	UpdateOrderItem(ctx context.Context, orderUID, rid string, item model.Item) (*model.Order, error)
+	DeleteOrderItem(ctx context.Context, orderUID, rid string) (*model.Order, error)
 	GetCacheStats() cache.CacheStats
-	WarmupCache() error
+	ResetCacheStats()
+	WarmupCache(ctx context.Context) error
+	RestoreCache(ctx context.Context, snapshot *cache.Snapshot) error
 }
 
 type OrderService struct {
-	repo  repository.Repository
-	cache cache.Cache
+	repo      repository.Repository
+	cache     cache.Cache
+	validator *validation.Validator
+	decoder   *decode.Decoder
+}
+
+type Option func(*OrderService)
+
+// WithValidator replaces the default validator, which enables all business
+// rules.
+func WithValidator(v *validation.Validator) Option {
+	return func(s *OrderService) {
+		s.validator = v
+	}
+}
+
+// WithDecoder sets the limits patched documents are decoded with and the
+// item limit for orders that grow item by item.
+func WithDecoder(d *decode.Decoder) Option {
+	return func(s *OrderService) {
+		s.decoder = d
+	}
+}
+
+func NewOrderService(repo repository.Repository, cache cache.Cache, opts ...Option) Service {
+	s := &OrderService{
+		repo:      repo,
+		cache:     cache,
+		validator: validation.New(),
+		decoder:   decode.New(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-func NewOrderService(repo repository.Repository, cache cache.Cache) Service {
-	return &OrderService{
-		repo:  repo,
-		cache: cache,
+// ProcessOrder saves an ingested order, creating it or overwriting an existing
+// one. Redelivered messages are skipped. A payment already recorded for
+// another order fails with ErrDuplicateTransaction, as the message conflicts
+// with stored data rather than repeating it. An order that carries the
+// version it was based on fails with ErrVersionConflict if the stored order
+// has moved on; one without a version overwrites it.
+func (s *OrderService) ProcessOrder(ctx context.Context, order *model.Order) error {
+	err := s.saveNewOrder(ctx, order, s.repo.UpsertOrder)
+	if errors.Is(err, ErrDuplicateMessage) {
+		log.Printf("Skipping duplicate order %s: %v", order.OrderUID, err)
+		return nil
 	}
+	return err
 }
 
-func (s *OrderService) ProcessOrder(order *model.Order) error {
+// CreateOrder saves a new order and fails with ErrAlreadyExists if the UID is
+// already taken. A request whose idempotency key was already used fails with
+// ErrDuplicateMessage and fills order with the order it created, or with
+// ErrIdempotencyMismatch if the order differs from that first request.
+func (s *OrderService) CreateOrder(ctx context.Context, order *model.Order) error {
+	return s.saveNewOrder(ctx, order, s.repo.CreateOrder)
+}
+
+func (s *OrderService) saveNewOrder(ctx context.Context, order *model.Order, save func(context.Context, *model.Order) error) error {
 	log.Printf("Creating order: %s", order.OrderUID)
 
+	// The request is hashed as received, before defaults such as the
+	// creation time are filled in, so that a replay hashes the same.
+	if _, ok := model.IdempotencyKeyFromContext(ctx); ok {
+		data, err := json.Marshal(order)
+		if err != nil {
+			return fmt.Errorf("failed to encode order: %w", err)
+		}
+		sum := sha256.Sum256(data)
+		ctx = model.WithRequestHash(ctx, hex.EncodeToString(sum[:]))
+	}
+
 	if err := s.validateOrder(order); err != nil {
 		ordersProcessErrorsTotal.Inc()
 		return fmt.Errorf("order validation failed: %w", err)
@@ -45,13 +149,23 @@ func (s *OrderService) ProcessOrder(order *model.Order) error {
 	if order.DateCreated.IsZero() {
 		order.DateCreated = time.Now()
 	}
+	// The status of a new order is not taken from the request; see
+	// ChangeOrderStatus for how it moves on.
+	order.Status = model.StatusCreated
 
 	timer := prometheus.NewTimer(orderProcessDurationSeconds)
 	defer timer.ObserveDuration()
 
 	log.Printf("Saving order %s to database", order.OrderUID)
-	if err := s.repo.CreateOrder(order); err != nil {
-		ordersProcessErrorsTotal.Inc()
+	if err := save(ctx, order); err != nil {
+		switch {
+		case errors.Is(err, ErrDuplicateMessage):
+			ordersDuplicatesTotal.WithLabelValues("message").Inc()
+		case errors.Is(err, ErrDuplicateTransaction):
+			ordersDuplicatesTotal.WithLabelValues("transaction").Inc()
+		default:
+			ordersProcessErrorsTotal.Inc()
+		}
 		return fmt.Errorf("failed to save order to database: %w", err)
 	}
 
@@ -63,16 +177,27 @@ func (s *OrderService) ProcessOrder(order *model.Order) error {
 	return nil
 }
 
-func (s *OrderService) GetOrderByUID(orderUID string) (*model.Order, error) {
-	if order, exists := s.cache.Get(orderUID); exists {
-		log.Printf("Order %s found in cache", orderUID)
-		return order, nil
+// GetOrderByUID serves live orders from the cache. Deleted orders are never
+// cached, so includeDeleted always goes to the database.
+func (s *OrderService) GetOrderByUID(ctx context.Context, orderUID string, includeDeleted bool) (*model.Order, error) {
+	if !includeDeleted {
+		if order, exists := s.cache.Get(orderUID); exists {
+			log.Printf("Order %s found in cache", orderUID)
+			return order, nil
+		}
 	}
+	return s.loadOrder(ctx, orderUID, includeDeleted)
+}
 
-	order, err := s.repo.GetOrderByUID(orderUID)
+// loadOrder reads an order from the database and caches it unless deleted.
+func (s *OrderService) loadOrder(ctx context.Context, orderUID string, includeDeleted bool) (*model.Order, error) {
+	order, err := s.repo.GetOrderByUID(ctx, orderUID, includeDeleted)
 	if err != nil {
 		return nil, fmt.Errorf("order not found: %w", err)
 	}
+	if order.DeletedAt != nil {
+		return order, nil
+	}
 
 	s.cache.Set(orderUID, order)
 	log.Printf("Order %s retrieved from database and cached", orderUID)
@@ -80,26 +205,84 @@ func (s *OrderService) GetOrderByUID(orderUID string) (*model.Order, error) {
 	return order, nil
 }
 
-func (s *OrderService) GetAllOrders() ([]*model.Order, error) {
-	orders, err := s.repo.GetAllOrders()
+// GetOrderJSON returns the encoded order together with its version, which
+// handlers expose as an ETag.
+func (s *OrderService) GetOrderJSON(ctx context.Context, orderUID string) ([]byte, int64, error) {
+	if data, version, exists := s.cache.GetJSON(orderUID); exists {
+		return data, version, nil
+	}
+
+	// The miss is already counted, so go to the database directly.
+	order, err := s.loadOrder(ctx, orderUID, false)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	data, err := json.Marshal(order)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to encode order: %w", err)
+	}
+	return data, order.Version, nil
+}
+
+func (s *OrderService) GetAllOrders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, error) {
+	orders, err := s.repo.GetAllOrders(ctx, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get orders: %w", err)
 	}
 
 	for _, order := range orders {
-		s.cache.Set(order.OrderUID, order)
+		if order.DeletedAt == nil {
+			s.cache.Set(order.OrderUID, order)
+		}
 	}
 
 	return orders, nil
 }
 
-func (s *OrderService) UpdateOrder(order *model.Order) error {
+// GetOrderHeaders lists matching orders without their delivery, payment or
+// items, so callers can fetch those for the whole page with GetOrderParts.
+func (s *OrderService) GetOrderHeaders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, error) {
+	orders, err := s.repo.GetOrderHeaders(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders: %w", err)
+	}
+	return orders, nil
+}
 
+// GetOrderParts returns the selected parts of many orders keyed by UID.
+// Cached orders answer directly, without counting as cache lookups; the rest
+// are loaded in one batch. Orders that no longer exist are left out.
+func (s *OrderService) GetOrderParts(ctx context.Context, orderUIDs []string, parts model.OrderParts) (map[string]*model.Order, error) {
+	result := make(map[string]*model.Order, len(orderUIDs))
+	var missing []string
+	for _, orderUID := range orderUIDs {
+		if order, exists := s.cache.Peek(orderUID); exists {
+			result[orderUID] = order
+			continue
+		}
+		missing = append(missing, orderUID)
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	loaded, err := s.repo.GetOrderParts(ctx, missing, parts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order parts: %w", err)
+	}
+	for orderUID, order := range loaded {
+		result[orderUID] = order
+	}
+	return result, nil
+}
+
+func (s *OrderService) UpdateOrder(ctx context.Context, order *model.Order) error {
 	if err := s.validateOrder(order); err != nil {
 		return fmt.Errorf("order validation failed: %w", err)
 	}
 
-	if err := s.repo.UpdateOrder(order); err != nil {
+	if err := s.repo.UpdateOrder(ctx, order); err != nil {
 		return fmt.Errorf("failed to update order in database: %w", err)
 	}
 
@@ -109,8 +292,8 @@ func (s *OrderService) UpdateOrder(order *model.Order) error {
 	return nil
 }
 
-func (s *OrderService) DeleteOrder(orderUID string) error {
-	if err := s.repo.DeleteOrder(orderUID); err != nil {
+func (s *OrderService) DeleteOrder(ctx context.Context, orderUID string) error {
+	if err := s.repo.DeleteOrder(ctx, orderUID); err != nil {
 		return fmt.Errorf("failed to delete order from database: %w", err)
 	}
 
@@ -120,17 +303,106 @@ func (s *OrderService) DeleteOrder(orderUID string) error {
 	return nil
 }
 
+func (s *OrderService) RestoreOrder(ctx context.Context, orderUID string) (*model.Order, error) {
+	order, err := s.repo.RestoreOrder(ctx, orderUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore order: %w", err)
+	}
+
+	s.cache.Set(orderUID, order)
+
+	log.Printf("Order %s restored successfully", orderUID)
+	return order, nil
+}
+
+// PurgeDeletedOrders permanently removes orders that were soft-deleted more
+// than retention ago. Their audit history is kept.
+func (s *OrderService) PurgeDeletedOrders(ctx context.Context, retention time.Duration) (int64, error) {
+	purged, err := s.repo.PurgeDeletedOrders(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted orders: %w", err)
+	}
+	if purged > 0 {
+		log.Printf("Purged %d orders deleted more than %s ago", purged, retention)
+	}
+	return purged, nil
+}
+
+// PurgeIdempotencyKeys forgets request idempotency keys older than ttl, after
+// which a redelivered message is processed again.
+func (s *OrderService) PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration) (int64, error) {
+	purged, err := s.repo.PurgeIdempotencyKeys(ctx, time.Now().Add(-ttl))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+	return purged, nil
+}
+
+// GetOrderHistory returns the audit log of an order, oldest first. An order
+// with no recorded events, such as one saved before auditing existed, has an
+// empty history; ErrNotFound means there is no such order either.
+func (s *OrderService) GetOrderHistory(ctx context.Context, orderUID string) ([]model.OrderEvent, error) {
+	events, err := s.repo.GetOrderHistory(ctx, orderUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order history: %w", err)
+	}
+	if len(events) > 0 {
+		return events, nil
+	}
+
+	if _, err := s.repo.GetOrderByUID(ctx, orderUID, true); err != nil {
+		return nil, fmt.Errorf("failed to get order history: %w", err)
+	}
+	return []model.OrderEvent{}, nil
+}
+
+// GetEventsSince pages through the audit log of all orders; change streams
+// follow it by event position.
+func (s *OrderService) GetEventsSince(ctx context.Context, after model.EventPosition, limit int) ([]model.OrderEvent, error) {
+	return s.repo.GetEventsSince(ctx, after, limit)
+}
+
+// ExportOrders streams every matching order to fn straight from the
+// database, bypassing the cache.
+func (s *OrderService) ExportOrders(ctx context.Context, filter model.OrderFilter, fn func(*model.Order) error) error {
+	if err := s.repo.ExportOrders(ctx, filter, fn); err != nil {
+		return fmt.Errorf("failed to export orders: %w", err)
+	}
+	return nil
+}
+
+func (s *OrderService) GetEventHorizon(ctx context.Context) (model.EventPosition, error) {
+	return s.repo.GetEventHorizon(ctx)
+}
+
+func (s *OrderService) GetEventPosition(ctx context.Context, id int64) (model.EventPosition, error) {
+	return s.repo.GetEventPosition(ctx, id)
+}
+
 func (s *OrderService) GetCacheStats() cache.CacheStats {
-	if statsCache, ok := s.cache.(*cache.StatsCache); ok {
-		return statsCache.GetStats()
+	if reporter, ok := s.cache.(cache.StatsReporter); ok {
+		return reporter.GetStats()
+	}
+	return cache.CacheStats{Size: s.cache.Size()}
+}
+
+func (s *OrderService) ResetCacheStats() {
+	if reporter, ok := s.cache.(cache.StatsReporter); ok {
+		reporter.ResetStats()
+	}
+}
+
+func (s *OrderService) recordWarmup(loaded int, start time.Time) {
+	if reporter, ok := s.cache.(cache.StatsReporter); ok {
+		reporter.RecordWarmup(loaded, time.Since(start))
 	}
-	return cache.CacheStats{}
 }
 
-func (s *OrderService) WarmupCache() error {
+func (s *OrderService) WarmupCache(ctx context.Context) error {
 	log.Println("Starting cache warmup...")
+	start := time.Now()
 
-	orders, err := s.repo.GetAllOrders()
+	orders, err := s.repo.GetAllOrders(ctx, model.OrderFilter{})
 	if err != nil {
 		return fmt.Errorf("failed to get orders for cache warmup: %w", err)
 	}
@@ -141,14 +413,67 @@ func (s *OrderService) WarmupCache() error {
 		s.cache.Set(order.OrderUID, order)
 	}
 
+	s.recordWarmup(len(orders), start)
 	log.Printf("Cache warmup completed. Loaded %d orders", len(orders))
 	return nil
 }
 
-func (s *OrderService) validateOrder(order *model.Order) error {
-	validatorInstance := validator.New(validator.WithRequiredStructEnabled())
-	if err := validatorInstance.Struct(order); err != nil {
-		return err
+// RestoreCache loads a snapshot and brings it up to date from the audit log:
+// every order with an event after the snapshot position is reloaded, or
+// dropped if it has since been deleted or purged.
+func (s *OrderService) RestoreCache(ctx context.Context, snapshot *cache.Snapshot) error {
+	log.Printf("Restoring cache from snapshot taken at %s...", snapshot.TakenAt.Format(time.RFC3339))
+	start := time.Now()
+
+	changed, err := s.ordersChangedSince(ctx, snapshot.Position)
+	if err != nil {
+		return fmt.Errorf("failed to get orders changed since snapshot: %w", err)
 	}
+	current, err := s.repo.GetOrdersByUIDs(ctx, changed)
+	if err != nil {
+		return fmt.Errorf("failed to get orders changed since snapshot: %w", err)
+	}
+
+	s.cache.Clear()
+
+	for _, order := range snapshot.Orders {
+		s.cache.Set(order.OrderUID, order)
+	}
+	for _, orderUID := range changed {
+		s.cache.Delete(orderUID)
+	}
+	for _, order := range current {
+		s.cache.Set(order.OrderUID, order)
+	}
+
+	s.recordWarmup(len(snapshot.Orders)+len(current), start)
+	log.Printf("Cache restored from snapshot. Loaded %d orders, reconciled %d changed orders",
+		len(snapshot.Orders), len(changed))
 	return nil
 }
+
+// ordersChangedSince returns the UIDs of orders with an event after position.
+func (s *OrderService) ordersChangedSince(ctx context.Context, position model.EventPosition) ([]string, error) {
+	seen := make(map[string]bool)
+	var orderUIDs []string
+	for {
+		events, err := s.repo.GetEventsSince(ctx, position, eventPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			if !seen[event.OrderUID] {
+				seen[event.OrderUID] = true
+				orderUIDs = append(orderUIDs, event.OrderUID)
+			}
+		}
+		if len(events) < eventPageSize {
+			return orderUIDs, nil
+		}
+		position = events[len(events)-1].Position()
+	}
+}
+
+func (s *OrderService) validateOrder(order *model.Order) error {
+	return s.validator.Validate(order)
+}
@@ -1,32 +1,137 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
 	"myapp/internal/cache"
+	"myapp/internal/decode"
 	"myapp/internal/model"
+	"myapp/internal/validation"
 )
 
 type fakeRepo struct {
-	createCalled bool
+	createCalled  bool
+	upsertCalled  bool
+	saveErr       error
+	patchedParts  model.OrderParts
+	events        []model.OrderEvent
+	current       []*model.Order
+	status        model.OrderStatus
+	statusUpdates []model.OrderStatus
+	partsLoaded   []string
+	missing       bool
 }
 
-func (f *fakeRepo) CreateOrder(order *model.Order) error { f.createCalled = true; return nil }
-func (f *fakeRepo) GetOrderByUID(orderUID string) (*model.Order, error) {
-	return &model.Order{OrderUID: orderUID, TrackNumber: "t", Entry: "e", Locale: "en", CustomerID: "c", DeliveryService: "d", DateCreated: time.Now(), Delivery: model.Delivery{Name: "n", Phone: "1", City: "c", Address: "a"}, Payment: model.Payment{Transaction: "t", Currency: "USD", Provider: "p", Amount: 1, PaymentDT: time.Now().Unix(), Bank: "b"}, Items: []model.Item{{ChrtID: 1, TrackNumber: "t", Price: 1, RID: "r", Name: "n", TotalPrice: 1, NMID: 1, Brand: "b", Status: 1}}}, nil
+func (f *fakeRepo) CreateOrder(ctx context.Context, order *model.Order) error {
+	f.createCalled = true
+	return f.saveErr
+}
+func (f *fakeRepo) GetOrderByUID(ctx context.Context, orderUID string, includeDeleted bool) (*model.Order, error) {
+	if f.missing {
+		return nil, ErrNotFound
+	}
+	order := validOrder(orderUID)
+	order.Status = f.status
+	order.Version = 1
+	return order, nil
+}
+func (f *fakeRepo) GetAllOrders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, error) {
+	return nil, nil
+}
+func (f *fakeRepo) GetOrderHeaders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, error) {
+	return nil, nil
+}
+func (f *fakeRepo) GetOrderParts(ctx context.Context, orderUIDs []string, parts model.OrderParts) (map[string]*model.Order, error) {
+	f.partsLoaded = append(f.partsLoaded, orderUIDs...)
+	orders := make(map[string]*model.Order, len(orderUIDs))
+	for _, orderUID := range orderUIDs {
+		orders[orderUID] = &model.Order{OrderUID: orderUID}
+	}
+	return orders, nil
+}
+func (f *fakeRepo) ExportOrders(ctx context.Context, filter model.OrderFilter, fn func(*model.Order) error) error {
+	return nil
+}
+func (f *fakeRepo) GetEventsSince(ctx context.Context, after model.EventPosition, limit int) ([]model.OrderEvent, error) {
+	var events []model.OrderEvent
+	for _, event := range f.events {
+		if after.Before(event.Position()) && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+func (f *fakeRepo) GetEventHorizon(ctx context.Context) (model.EventPosition, error) {
+	return model.EventPosition{}, nil
+}
+func (f *fakeRepo) GetEventPosition(ctx context.Context, id int64) (model.EventPosition, error) {
+	return model.EventPosition{ID: id}, nil
+}
+func (f *fakeRepo) GetOrdersByUIDs(ctx context.Context, orderUIDs []string) ([]*model.Order, error) {
+	var orders []*model.Order
+	for _, order := range f.current {
+		for _, orderUID := range orderUIDs {
+			if order.OrderUID == orderUID {
+				orders = append(orders, order)
+			}
+		}
+	}
+	return orders, nil
+}
+func (f *fakeRepo) UpdateOrder(ctx context.Context, order *model.Order) error { return nil }
+func (f *fakeRepo) PatchOrder(ctx context.Context, order *model.Order, parts model.OrderParts) error {
+	f.patchedParts = parts
+	order.Version++
+	return nil
+}
+func (f *fakeRepo) UpsertOrder(ctx context.Context, order *model.Order) error {
+	f.upsertCalled = true
+	return f.saveErr
+}
+func (f *fakeRepo) UpdateOrderStatus(ctx context.Context, orderUID string, from, to model.OrderStatus) (*model.Order, error) {
+	f.statusUpdates = append(f.statusUpdates, to)
+	order, _ := f.GetOrderByUID(ctx, orderUID, false)
+	order.Status = to
+	order.Version++
+	return order, nil
+}
+func (f *fakeRepo) DeleteOrder(ctx context.Context, orderUID string) error { return nil }
+func (f *fakeRepo) RestoreOrder(ctx context.Context, orderUID string) (*model.Order, error) {
+	return &model.Order{OrderUID: orderUID}, nil
+}
+func (f *fakeRepo) PurgeDeletedOrders(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	return 0, nil
+}
+func (f *fakeRepo) PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+func (f *fakeRepo) AddItem(ctx context.Context, orderUID string, item model.Item, check func(*model.Order) error) (*model.Order, error) {
+	order, _ := f.GetOrderByUID(ctx, orderUID, false)
+	order.Items = append(order.Items, item)
+	order.Payment.GoodsTotal += item.TotalPrice
+	order.Payment.Amount += item.TotalPrice
+	if err := check(order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+func (f *fakeRepo) UpdateItem(ctx context.Context, orderUID string, item model.Item, check func(*model.Order) error) (*model.Order, error) {
+	return f.GetOrderByUID(ctx, orderUID, false)
+}
+func (f *fakeRepo) DeleteItem(ctx context.Context, orderUID, rid string, check func(*model.Order) error) (*model.Order, error) {
+	return f.GetOrderByUID(ctx, orderUID, false)
+}
+func (f *fakeRepo) GetOrderHistory(ctx context.Context, orderUID string) ([]model.OrderEvent, error) {
+	return nil, nil
 }
-func (f *fakeRepo) GetAllOrders() ([]*model.Order, error) { return nil, nil }
-func (f *fakeRepo) UpdateOrder(order *model.Order) error  { return nil }
-func (f *fakeRepo) DeleteOrder(orderUID string) error     { return nil }
-
-func TestProcessOrder_Valid(t *testing.T) {
-	repo := &fakeRepo{}
-	c := cache.NewInMemoryCache()
-	s := NewOrderService(repo, c)
 
-	order := &model.Order{
-		OrderUID:        "uid1",
+func validOrder(orderUID string) *model.Order {
+	return &model.Order{
+		OrderUID:        orderUID,
 		TrackNumber:     "trk",
 		Entry:           "en",
 		Locale:          "en",
@@ -34,10 +139,284 @@ func TestProcessOrder_Valid(t *testing.T) {
 		DeliveryService: "svc",
 		DateCreated:     time.Now(),
 		Delivery:        model.Delivery{Name: "name", Phone: "12345", City: "city", Address: "addr"},
-		Payment:         model.Payment{Transaction: "txn", Currency: "USD", Provider: "prov", Amount: 10, PaymentDT: time.Now().Unix(), Bank: "bank"},
+		Payment:         model.Payment{Transaction: "txn", Currency: "USD", Provider: "prov", Amount: 10, PaymentDT: time.Now().Unix(), Bank: "bank", GoodsTotal: 10},
 		Items:           []model.Item{{ChrtID: 1, TrackNumber: "trk", Price: 10, RID: "rid", Name: "nm", TotalPrice: 10, NMID: 1, Brand: "br", Status: 1}},
 	}
-	if err := s.ProcessOrder(order); err != nil {
+}
+
+func TestProcessOrder_Valid(t *testing.T) {
+	repo := &fakeRepo{}
+	c := cache.NewInMemoryCache()
+	s := NewOrderService(repo, c)
+
+	order := validOrder("uid1")
+	if err := s.ProcessOrder(context.Background(), order); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !repo.upsertCalled || repo.createCalled {
+		t.Fatalf("expected ProcessOrder to upsert, got create=%v upsert=%v", repo.createCalled, repo.upsertCalled)
+	}
+}
+
+func TestProcessOrder_SkipsDuplicates(t *testing.T) {
+	repo := &fakeRepo{saveErr: fmt.Errorf("%w: kafka:orders:0:1", ErrDuplicateMessage)}
+	c := cache.NewInMemoryCache()
+	s := NewOrderService(repo, c)
+
+	order := validOrder("uid1")
+	if err := s.ProcessOrder(context.Background(), order); err != nil {
+		t.Fatalf("expected duplicate to be skipped, got %v", err)
+	}
+	if err := s.CreateOrder(context.Background(), order); !errors.Is(err, ErrDuplicateMessage) {
+		t.Fatalf("expected ErrDuplicateMessage from CreateOrder, got %v", err)
+	}
+}
+
+func TestProcessOrder_ReportsDuplicateTransaction(t *testing.T) {
+	repo := &fakeRepo{saveErr: fmt.Errorf("%w: txn is recorded for order uid0", ErrDuplicateTransaction)}
+	s := NewOrderService(repo, cache.NewInMemoryCache())
+
+	if err := s.ProcessOrder(context.Background(), validOrder("uid1")); !errors.Is(err, ErrDuplicateTransaction) {
+		t.Fatalf("expected ErrDuplicateTransaction, got %v", err)
+	}
+}
+
+func TestPatchOrder_WritesOnlyChangedParts(t *testing.T) {
+	repo := &fakeRepo{status: model.StatusCreated}
+	c := cache.NewInMemoryCache()
+	s := NewOrderService(repo, c)
+
+	order, err := s.PatchOrder(context.Background(), "uid1", MergePatch, []byte(`{"delivery":{"phone":"+79990000000"}}`), 1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if order.Delivery.Phone != "+79990000000" || order.Delivery.City != "city" || order.Version != 2 {
+		t.Fatalf("unexpected patched order: %+v", order)
+	}
+	if repo.patchedParts != model.PartDelivery {
+		t.Fatalf("expected only delivery to be written, got %b", repo.patchedParts)
+	}
+	if cached, _ := c.Get("uid1"); cached.Delivery.Phone != "+79990000000" {
+		t.Fatalf("expected patched order in cache, got %+v", cached)
+	}
+
+	if _, err := s.PatchOrder(context.Background(), "uid1", JSONPatch, []byte(`[{"op":"replace","path":"/items/0/name","value":"renamed"}]`), 0); err != nil {
+		t.Fatalf("expected JSON Patch to apply, got %v", err)
+	}
+	if repo.patchedParts != model.PartItems {
+		t.Fatalf("expected only items to be written, got %b", repo.patchedParts)
+	}
+
+	if _, err := s.PatchOrder(context.Background(), "uid1", JSONPatch, []byte(`[{"op":"replace","path":"/status","value":"paid"}]`), 0); !errors.Is(err, ErrInvalidPatch) {
+		t.Fatalf("expected ErrInvalidPatch for read-only field, got %v", err)
+	}
+	if _, err := s.PatchOrder(context.Background(), "uid1", MergePatch, []byte(`{"delivery":{"phone":null}}`), 0); err == nil {
+		t.Fatal("expected validation error after removing required phone")
+	}
+	if _, err := s.PatchOrder(context.Background(), "uid1", MergePatch, []byte(`{}`), 5); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict, got %v", err)
+	}
+}
+
+func TestAddOrderItem_InvalidatesCache(t *testing.T) {
+	repo := &fakeRepo{}
+	c := cache.NewInMemoryCache()
+	c.Set("uid1", validOrder("uid1"))
+	s := NewOrderService(repo, c)
+
+	item := model.Item{ChrtID: 2, TrackNumber: "trk", Price: 5, RID: "rid2", Name: "nm", TotalPrice: 5, NMID: 2, Brand: "br", Status: 1}
+	order, err := s.AddOrderItem(context.Background(), "uid1", item)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, ok := order.Item("rid2"); !ok {
+		t.Fatalf("expected added item in order, got %+v", order.Items)
+	}
+	if _, ok := c.Get("uid1"); ok {
+		t.Fatal("expected cached order to be invalidated")
+	}
+
+	if _, err := s.UpdateOrderItem(context.Background(), "uid1", "rid3", item); !errors.Is(err, ErrInvalidItem) {
+		t.Fatalf("expected ErrInvalidItem for mismatched rid, got %v", err)
+	}
+}
+
+func TestAddOrderItem_ValidatesResultingOrder(t *testing.T) {
+	s := NewOrderService(&fakeRepo{}, cache.NewInMemoryCache())
+
+	item := model.Item{ChrtID: 2, TrackNumber: "other", Price: 5, RID: "rid2", Name: "nm", TotalPrice: 5, NMID: 2, Brand: "br", Status: 1}
+	_, err := s.AddOrderItem(context.Background(), "uid1", item)
+	violations := validation.Violations(err)
+	if len(violations) != 1 || violations[0].Rule != validation.RuleItemTrackNumber {
+		t.Fatalf("expected an item_track_number violation, got %v", err)
+	}
+}
+
+func TestPatchOrder_DecodesLikeRequestBodies(t *testing.T) {
+	unknown := []byte(`{"gift_wrap":true}`)
+	if _, err := NewOrderService(&fakeRepo{}, cache.NewInMemoryCache()).PatchOrder(context.Background(), "uid1", MergePatch, unknown, 0); !errors.Is(err, ErrInvalidPatch) || !decode.IsDecodeError(err) {
+		t.Fatalf("expected an unknown field to be rejected in strict mode, got %v", err)
+	}
+
+	s := NewOrderService(&fakeRepo{}, cache.NewInMemoryCache(),
+		WithDecoder(decode.New(decode.WithStrict(false), decode.WithMaxItems(1))))
+	if _, err := s.PatchOrder(context.Background(), "uid1", MergePatch, unknown, 0); err != nil {
+		t.Fatalf("expected an unknown field to be ignored in lenient mode, got %v", err)
+	}
+
+	addItem := []byte(`[{"op":"copy","from":"/items/0","path":"/items/-"}]`)
+	var decodeErr *decode.Error
+	if _, err := s.PatchOrder(context.Background(), "uid1", JSONPatch, addItem, 0); !errors.As(err, &decodeErr) || decodeErr.Rule != decode.RuleMaxItems {
+		t.Fatalf("expected the item limit to apply to the patched order, got %v", err)
+	}
+}
+
+func TestAddOrderItem_EnforcesItemLimit(t *testing.T) {
+	s := NewOrderService(&fakeRepo{}, cache.NewInMemoryCache(), WithDecoder(decode.New(decode.WithMaxItems(1))))
+
+	item := model.Item{ChrtID: 2, TrackNumber: "trk", Price: 5, RID: "rid2", Name: "nm", TotalPrice: 5, NMID: 2, Brand: "br", Status: 1}
+	var decodeErr *decode.Error
+	if _, err := s.AddOrderItem(context.Background(), "uid1", item); !errors.As(err, &decodeErr) || decodeErr.Rule != decode.RuleMaxItems {
+		t.Fatalf("expected the item limit to be enforced, got %v", err)
+	}
+}
+
+func TestGetOrderJSON_CountsOneMiss(t *testing.T) {
+	c := cache.NewStatsCache(cache.NewInMemoryCache())
+	s := NewOrderService(&fakeRepo{}, c)
+
+	if _, _, err := s.GetOrderJSON(context.Background(), "uid1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, _, err := s.GetOrderJSON(context.Background(), "uid1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if stats := c.GetStats(); stats.TotalMiss != 1 || stats.TotalHits != 1 {
+		t.Fatalf("expected 1 miss and 1 hit, got %d and %d", stats.TotalMiss, stats.TotalHits)
+	}
+}
+
+func TestGetOrderParts_LoadsOnlyCacheMisses(t *testing.T) {
+	repo := &fakeRepo{}
+	c := cache.NewInMemoryCache()
+	c.Set("uid1", validOrder("uid1"))
+	s := NewOrderService(repo, c)
+
+	orders, err := s.GetOrderParts(context.Background(), []string{"uid1", "uid2", "uid3"}, model.PartDelivery)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(orders) != 3 || orders["uid1"].Delivery.City != "city" {
+		t.Fatalf("unexpected orders: %+v", orders)
+	}
+	if len(repo.partsLoaded) != 2 || repo.partsLoaded[0] != "uid2" || repo.partsLoaded[1] != "uid3" {
+		t.Fatalf("expected only cache misses to be loaded, got %v", repo.partsLoaded)
+	}
+}
+
+func TestGetOrderParts_DoesNotCountCacheLookups(t *testing.T) {
+	c := cache.NewStatsCache(cache.NewInMemoryCache())
+	c.Set("uid1", validOrder("uid1"))
+	s := NewOrderService(&fakeRepo{}, c)
+
+	if _, err := s.GetOrderParts(context.Background(), []string{"uid1", "uid2"}, model.PartDelivery); err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
+	if stats := c.GetStats(); stats.TotalHits != 0 || stats.TotalMiss != 0 {
+		t.Fatalf("expected batch reads not to be counted, got %d hits and %d misses", stats.TotalHits, stats.TotalMiss)
+	}
+}
+
+func TestRestoreCache_ReconcilesChangedOrders(t *testing.T) {
+	repo := &fakeRepo{
+		events: []model.OrderEvent{
+			{ID: 1, XID: 5, OrderUID: "uid2", Type: model.EventUpdated},
+			{ID: 3, XID: 10, OrderUID: "uid1", Type: model.EventUpdated},
+			{ID: 2, XID: 11, OrderUID: "uid3", Type: model.EventDeleted},
+			{ID: 4, XID: 12, OrderUID: "uid4", Type: model.EventPurged},
+			{ID: 5, XID: 12, OrderUID: "uid5", Type: model.EventCreated},
+		},
+		current: []*model.Order{
+			{OrderUID: "uid1", TrackNumber: "new"},
+			{OrderUID: "uid2", TrackNumber: "new"},
+			{OrderUID: "uid5", TrackNumber: "new"},
+		},
+	}
+	c := cache.NewInMemoryCache()
+	c.Set("stale", &model.Order{OrderUID: "stale"})
+	s := NewOrderService(repo, c)
+
+	// The snapshot already holds the change to uid2; the transaction that
+	// changed uid1 was still running when it was taken.
+	snapshot := &cache.Snapshot{
+		TakenAt:  time.Now().Add(-time.Minute),
+		Position: model.EventPosition{XID: 10},
+		Orders: []*model.Order{
+			{OrderUID: "uid1", TrackNumber: "old"},
+			{OrderUID: "uid2", TrackNumber: "old"},
+			{OrderUID: "uid3", TrackNumber: "old"},
+			{OrderUID: "uid4", TrackNumber: "old"},
+		},
+	}
+	if err := s.RestoreCache(context.Background(), snapshot); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if c.Size() != 3 {
+		t.Fatalf("expected 3 cached orders, got %d", c.Size())
+	}
+	if got, _ := c.Get("uid1"); got.TrackNumber != "new" {
+		t.Fatalf("expected uid1 to be reconciled, got track %q", got.TrackNumber)
+	}
+	if got, _ := c.Get("uid2"); got.TrackNumber != "old" {
+		t.Fatalf("expected uid2 from snapshot, got track %q", got.TrackNumber)
+	}
+	if _, ok := c.Get("uid5"); !ok {
+		t.Fatal("expected uid5 created after the snapshot to be loaded")
+	}
+	for _, orderUID := range []string{"uid3", "uid4"} {
+		if _, ok := c.Get(orderUID); ok {
+			t.Fatalf("expected %s to be dropped from cache", orderUID)
+		}
+	}
+}
+
+func TestChangeOrderStatus_StateMachine(t *testing.T) {
+	repo := &fakeRepo{status: model.StatusPaid}
+	s := NewOrderService(repo, cache.NewInMemoryCache())
+
+	order, err := s.ChangeOrderStatus(context.Background(), &model.StatusChange{OrderUID: "uid1", Status: model.StatusAssembling})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if order.Status != model.StatusAssembling || len(repo.statusUpdates) != 1 {
+		t.Fatalf("expected status to be updated, got %s (%v)", order.Status, repo.statusUpdates)
+	}
+
+	if _, err := s.ChangeOrderStatus(context.Background(), &model.StatusChange{OrderUID: "uid1", Status: model.StatusDelivered}); !errors.Is(err, ErrInvalidStatusTransition) {
+		t.Fatalf("expected ErrInvalidStatusTransition, got %v", err)
+	}
+	if _, err := s.ChangeOrderStatus(context.Background(), &model.StatusChange{OrderUID: "uid1", Status: "lost"}); !errors.Is(err, ErrInvalidStatus) {
+		t.Fatalf("expected ErrInvalidStatus, got %v", err)
+	}
+	if _, err := s.ChangeOrderStatus(context.Background(), &model.StatusChange{OrderUID: "uid1", Status: model.StatusPaid}); err != nil || len(repo.statusUpdates) != 1 {
+		t.Fatalf("expected same-status change to be a no-op, got %v (%v)", err, repo.statusUpdates)
+	}
+}
+
+func TestGetOrderHistory_EmptyForExistingOrder(t *testing.T) {
+	svc := NewOrderService(&fakeRepo{}, cache.NewInMemoryCache())
+
+	events, err := svc.GetOrderHistory(context.Background(), "u1")
+	if err != nil {
+		t.Fatalf("GetOrderHistory error: %v", err)
+	}
+	if events == nil || len(events) != 0 {
+		t.Fatalf("expected an empty history, got %#v", events)
+	}
+
+	svc = NewOrderService(&fakeRepo{missing: true}, cache.NewInMemoryCache())
+	if _, err := svc.GetOrderHistory(context.Background(), "u1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
 }
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"myapp/internal/model"
+	"myapp/internal/repository"
+)
+
+var (
+	ErrInvalidStatus           = errors.New("invalid order status")
+	ErrInvalidStatusTransition = errors.New("invalid order status transition")
+	ErrStatusConflict          = repository.ErrStatusConflict
+)
+
+var statusTransitions = map[model.OrderStatus][]model.OrderStatus{
+	model.StatusCreated:    {model.StatusPaid, model.StatusCancelled},
+	model.StatusPaid:       {model.StatusAssembling, model.StatusCancelled},
+	model.StatusAssembling: {model.StatusShipped, model.StatusCancelled},
+	model.StatusShipped:    {model.StatusDelivered, model.StatusReturned},
+	model.StatusDelivered:  {model.StatusReturned},
+	model.StatusCancelled:  {},
+	model.StatusReturned:   {},
+}
+
+func CanTransition(from, to model.OrderStatus) bool {
+	for _, allowed := range statusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *OrderService) ChangeOrderStatus(ctx context.Context, change *model.StatusChange) (*model.Order, error) {
+	if !change.Status.Valid() {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidStatus, change.Status)
+	}
+
+	order, err := s.repo.GetOrderByUID(ctx, change.OrderUID, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	if order.Status == change.Status {
+		return order, nil
+	}
+
+	if !CanTransition(order.Status, change.Status) {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrInvalidStatusTransition, order.Status, change.Status)
+	}
+
+	updated, err := s.repo.UpdateOrderStatus(ctx, order.OrderUID, order.Status, change.Status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update order status: %w", err)
+	}
+
+	log.Printf("Order %s status changed: %s -> %s", order.OrderUID, order.Status, change.Status)
+	orderStatusChangesTotal.WithLabelValues(string(change.Status)).Inc()
+
+	s.cache.Set(updated.OrderUID, updated)
+	return updated, nil
+}
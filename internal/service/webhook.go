@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"myapp/internal/model"
+	"myapp/internal/repository"
+	"myapp/internal/validation"
+	"time"
+)
+
+var ErrWebhookNotFound = repository.ErrWebhookNotFound
+
+// WebhookService manages webhook subscriptions and hands their queued
+// deliveries to the webhook dispatcher.
+type WebhookService interface {
+	CreateWebhook(ctx context.Context, webhook *model.Webhook) error
+	GetWebhook(ctx context.Context, id int64) (*model.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]*model.Webhook, error)
+	UpdateWebhook(ctx context.Context, webhook *model.Webhook) error
+	DeleteWebhook(ctx context.Context, id int64) error
+	GetWebhookDeliveries(ctx context.Context, webhookID int64, limit int) ([]model.WebhookDelivery, error)
+	ClaimWebhookJobs(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookJob, error)
+	RecordWebhookResults(ctx context.Context, results []model.WebhookResult, disableAfter int) error
+}
+
+type WebhookManager struct {
+	repo      repository.WebhookRepository
+	validator *validation.Validator
+}
+
+func NewWebhookService(repo repository.WebhookRepository) WebhookService {
+	return &WebhookManager{repo: repo, validator: validation.New()}
+}
+
+// CreateWebhook stores an active subscription. Without a secret one is
+// generated; the caller must pass it on, since reads never return it.
+func (m *WebhookManager) CreateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	if webhook.Secret == "" {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			return err
+		}
+		webhook.Secret = secret
+	}
+	webhook.Active = true
+
+	if err := m.validator.ValidateStruct(webhook); err != nil {
+		return fmt.Errorf("webhook validation failed: %w", err)
+	}
+	return m.repo.CreateWebhook(ctx, webhook)
+}
+
+func (m *WebhookManager) GetWebhook(ctx context.Context, id int64) (*model.Webhook, error) {
+	webhook, err := m.repo.GetWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+func (m *WebhookManager) ListWebhooks(ctx context.Context) ([]*model.Webhook, error) {
+	webhooks, err := m.repo.ListWebhooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+	}
+	return webhooks, nil
+}
+
+// UpdateWebhook replaces the subscription, keeping the stored secret when
+// none is given.
+func (m *WebhookManager) UpdateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	if webhook.Secret == "" {
+		current, err := m.repo.GetWebhook(ctx, webhook.ID)
+		if err != nil {
+			return err
+		}
+		webhook.Secret = current.Secret
+	}
+
+	if err := m.validator.ValidateStruct(webhook); err != nil {
+		return fmt.Errorf("webhook validation failed: %w", err)
+	}
+	if err := m.repo.UpdateWebhook(ctx, webhook); err != nil {
+		return err
+	}
+	webhook.Secret = ""
+	return nil
+}
+
+func (m *WebhookManager) DeleteWebhook(ctx context.Context, id int64) error {
+	return m.repo.DeleteWebhook(ctx, id)
+}
+
+func (m *WebhookManager) GetWebhookDeliveries(ctx context.Context, webhookID int64, limit int) ([]model.WebhookDelivery, error) {
+	if _, err := m.repo.GetWebhook(ctx, webhookID); err != nil {
+		return nil, err
+	}
+	return m.repo.GetWebhookDeliveries(ctx, webhookID, limit)
+}
+
+func (m *WebhookManager) ClaimWebhookJobs(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookJob, error) {
+	return m.repo.ClaimWebhookJobs(ctx, limit, lease)
+}
+
+func (m *WebhookManager) RecordWebhookResults(ctx context.Context, results []model.WebhookResult, disableAfter int) error {
+	return m.repo.RecordWebhookResults(ctx, results, disableAfter)
+}
+
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,290 @@
+// Package stream follows the order audit log and fans new events out to
+// live subscribers such as the SSE and WebSocket endpoints.
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"myapp/internal/model"
+	"myapp/internal/service"
+	"sync"
+	"time"
+)
+
+const (
+	// pageSize bounds a single read of the audit log.
+	pageSize = 500
+	// bufferSize is how many live events a subscriber may fall behind by
+	// before it is dropped.
+	bufferSize = 256
+)
+
+var (
+	ErrUnavailable  = errors.New("event stream is not ready")
+	ErrSlowConsumer = errors.New("subscriber fell behind the event stream")
+	ErrClosed       = errors.New("event stream is closed")
+)
+
+// Filter selects the events a subscriber receives. Empty fields match
+// everything.
+type Filter struct {
+	CustomerID      string
+	DeliveryService string
+	Types           []model.OrderEventType
+}
+
+// Match reports whether event passes the filter. Customer and delivery
+// service are read from the order after the change, or before it for
+// deletions.
+func (f Filter) Match(event model.OrderEvent) bool {
+	if len(f.Types) > 0 && !containsType(f.Types, event.Type) {
+		return false
+	}
+	if f.CustomerID == "" && f.DeliveryService == "" {
+		return true
+	}
+
+	var order struct {
+		CustomerID      string `json:"customer_id"`
+		DeliveryService string `json:"delivery_service"`
+	}
+	data := event.After
+	if len(data) == 0 {
+		data = event.Before
+	}
+	if err := json.Unmarshal(data, &order); err != nil {
+		return false
+	}
+	return (f.CustomerID == "" || f.CustomerID == order.CustomerID) &&
+		(f.DeliveryService == "" || f.DeliveryService == order.DeliveryService)
+}
+
+func containsType(types []model.OrderEventType, t model.OrderEventType) bool {
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Broker polls the audit log through the service, so it sees writes from
+// every instance and every source: HTTP, gRPC, GraphQL and Kafka.
+type Broker struct {
+	service  service.Service
+	interval time.Duration
+
+	mu    sync.Mutex
+	ready bool
+	last  model.EventPosition
+	subs  map[*Subscription]struct{}
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func NewBroker(service service.Service, interval time.Duration) *Broker {
+	return &Broker{
+		service:  service,
+		interval: interval,
+		subs:     make(map[*Subscription]struct{}),
+		closed:   make(chan struct{}),
+	}
+}
+
+// Close ends every subscription with ErrClosed and refuses new ones, so
+// open streams do not hold up a server shutdown.
+func (b *Broker) Close() {
+	b.closeOnce.Do(func() { close(b.closed) })
+}
+
+// Run polls until ctx is done. Events recorded before the first successful
+// poll are only reachable by replay.
+func (b *Broker) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := b.poll(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to poll order events: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *Broker) poll(ctx context.Context) error {
+	b.mu.Lock()
+	ready, last := b.ready, b.last
+	b.mu.Unlock()
+
+	if !ready {
+		horizon, err := b.service.GetEventHorizon(ctx)
+		if err != nil {
+			return err
+		}
+		b.mu.Lock()
+		b.ready, b.last = true, horizon
+		b.mu.Unlock()
+		return nil
+	}
+
+	for {
+		events, err := b.service.GetEventsSince(ctx, last, pageSize)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		b.publish(events)
+		last = events[len(events)-1].Position()
+		if len(events) < pageSize {
+			return nil
+		}
+	}
+}
+
+func (b *Broker) publish(events []model.OrderEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, event := range events {
+		b.last = event.Position()
+		for sub := range b.subs {
+			if !sub.filter.Match(event) {
+				continue
+			}
+			select {
+			case sub.live <- event:
+			default:
+				b.drop(sub)
+			}
+		}
+	}
+}
+
+// drop must be called with b.mu held.
+func (b *Broker) drop(sub *Subscription) {
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.dropped)
+	}
+}
+
+// Subscribe starts a subscription. With a positive lastEventID it first
+// replays the events after it, then continues live; otherwise it only
+// sees events from now on. A lastEventID ahead of this broker, as seen by
+// a client of another instance, skips live events up to it. An ID that is
+// not in the audit log fails with service.ErrEventNotFound.
+func (b *Broker) Subscribe(ctx context.Context, filter Filter, lastEventID int64) (*Subscription, error) {
+	var resume model.EventPosition
+	if lastEventID > 0 {
+		position, err := b.service.GetEventPosition(ctx, lastEventID)
+		if err != nil {
+			return nil, err
+		}
+		resume = position
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-b.closed:
+		return nil, ErrClosed
+	default:
+	}
+	if !b.ready {
+		return nil, ErrUnavailable
+	}
+
+	sub := &Subscription{
+		broker:  b,
+		filter:  filter,
+		after:   b.last,
+		until:   b.last,
+		live:    make(chan model.OrderEvent, bufferSize),
+		dropped: make(chan struct{}),
+	}
+	if lastEventID > 0 {
+		sub.after = resume
+	}
+	b.subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// Subscription yields events in position order: first the replay up to the
+// point it was created, read page by page from the audit log, then live ones.
+type Subscription struct {
+	broker  *Broker
+	filter  Filter
+	after   model.EventPosition
+	until   model.EventPosition
+	pending []model.OrderEvent
+	live    chan model.OrderEvent
+	dropped chan struct{}
+}
+
+// Next blocks until the next matching event. It fails with ErrSlowConsumer
+// once the subscriber has been dropped and with ErrClosed once the broker is
+// closed; reconnecting with the last ID it received resumes without loss.
+func (s *Subscription) Next(ctx context.Context) (model.OrderEvent, error) {
+	for len(s.pending) == 0 && s.after.Before(s.until) {
+		events, err := s.broker.service.GetEventsSince(ctx, s.after, pageSize)
+		if err != nil {
+			return model.OrderEvent{}, err
+		}
+		if len(events) == 0 {
+			s.after = s.until
+			break
+		}
+		for _, event := range events {
+			if s.until.Before(event.Position()) {
+				break
+			}
+			s.after = event.Position()
+			if s.filter.Match(event) {
+				s.pending = append(s.pending, event)
+			}
+		}
+		if !events[len(events)-1].Position().Before(s.until) {
+			s.after = s.until
+		}
+	}
+	if len(s.pending) > 0 {
+		event := s.pending[0]
+		s.pending = s.pending[1:]
+		return event, nil
+	}
+
+	for {
+		select {
+		case event := <-s.live:
+			if !s.after.Before(event.Position()) {
+				continue
+			}
+			s.after = event.Position()
+			return event, nil
+		case <-s.dropped:
+			return model.OrderEvent{}, ErrSlowConsumer
+		case <-s.broker.closed:
+			return model.OrderEvent{}, ErrClosed
+		case <-ctx.Done():
+			return model.OrderEvent{}, ctx.Err()
+		}
+	}
+}
+
+// Close unregisters the subscription.
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.drop(s)
+}
@@ -0,0 +1,265 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"myapp/internal/model"
+	"myapp/internal/service"
+)
+
+// fakeService serves an in-memory audit log; the embedded interface panics
+// on anything else. Every event gets its own transaction, which add commits
+// at once and begin leaves open until commit.
+type fakeService struct {
+	service.Service
+	mu     sync.Mutex
+	events []model.OrderEvent
+	open   map[uint64]bool
+}
+
+func (f *fakeService) add(eventType model.OrderEventType, customerID string) {
+	f.record(eventType, customerID)
+}
+
+func (f *fakeService) record(eventType model.OrderEventType, customerID string) uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	after, _ := json.Marshal(map[string]string{"customer_id": customerID, "delivery_service": "meest"})
+	id := int64(len(f.events) + 1)
+	f.events = append(f.events, model.OrderEvent{ID: id, XID: uint64(id), Type: eventType, After: after})
+	return uint64(id)
+}
+
+func (f *fakeService) begin(eventType model.OrderEventType, customerID string) uint64 {
+	xid := f.record(eventType, customerID)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.open == nil {
+		f.open = map[uint64]bool{}
+	}
+	f.open[xid] = true
+	return xid
+}
+
+func (f *fakeService) commit(xid uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.open, xid)
+}
+
+// horizon must be called with f.mu held.
+func (f *fakeService) horizon() uint64 {
+	xmin := uint64(len(f.events) + 1)
+	for xid := range f.open {
+		if xid < xmin {
+			xmin = xid
+		}
+	}
+	return xmin
+}
+
+func (f *fakeService) GetEventsSince(ctx context.Context, after model.EventPosition, limit int) ([]model.OrderEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	horizon := f.horizon()
+	var events []model.OrderEvent
+	for _, event := range f.events {
+		if after.Before(event.Position()) && event.XID < horizon && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (f *fakeService) GetEventHorizon(ctx context.Context) (model.EventPosition, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return model.EventPosition{XID: f.horizon()}, nil
+}
+
+func (f *fakeService) GetEventPosition(ctx context.Context, id int64) (model.EventPosition, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, event := range f.events {
+		if event.ID == id {
+			return event.Position(), nil
+		}
+	}
+	return model.EventPosition{}, service.ErrEventNotFound
+}
+
+func nextID(t *testing.T, sub *Subscription) int64 {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	event, err := sub.Next(ctx)
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	return event.ID
+}
+
+func TestSubscription_ReplaysThenFollowsLive(t *testing.T) {
+	svc := &fakeService{}
+	svc.add(model.EventCreated, "c1")
+	svc.add(model.EventCreated, "c2")
+	svc.add(model.EventUpdated, "c1")
+	broker := NewBroker(svc, time.Hour)
+
+	if _, err := broker.Subscribe(context.Background(), Filter{}, 0); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable before the first poll, got %v", err)
+	}
+	if err := broker.poll(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+
+	sub, err := broker.Subscribe(context.Background(), Filter{CustomerID: "c1"}, 1)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer sub.Close()
+	live, err := broker.Subscribe(context.Background(), Filter{}, 0)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer live.Close()
+
+	// sub resumes after event 1, so it replays 3 (2 is another customer).
+	if id := nextID(t, sub); id != 3 {
+		t.Fatalf("expected replayed event 3, got %d", id)
+	}
+
+	svc.add(model.EventDeleted, "c2")
+	svc.add(model.EventStatusChanged, "c1")
+	if err := broker.poll(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if id := nextID(t, sub); id != 5 {
+		t.Fatalf("expected live event 5, got %d", id)
+	}
+	if id := nextID(t, live); id != 4 {
+		t.Fatalf("expected live event 4 for the unfiltered subscriber, got %d", id)
+	}
+}
+
+func TestSubscription_ResumesAheadOfBroker(t *testing.T) {
+	svc := &fakeService{}
+	svc.add(model.EventCreated, "c1")
+	broker := NewBroker(svc, time.Hour)
+	if err := broker.poll(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+
+	// The client already received event 2 from another instance.
+	svc.add(model.EventCreated, "c1")
+	sub, err := broker.Subscribe(context.Background(), Filter{}, 2)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	svc.add(model.EventCreated, "c1")
+	if err := broker.poll(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if id := nextID(t, sub); id != 3 {
+		t.Fatalf("expected event 3 after the resume point, got %d", id)
+	}
+}
+
+func TestSubscription_WaitsForTransactionsInFlight(t *testing.T) {
+	svc := &fakeService{}
+	broker := NewBroker(svc, time.Hour)
+	if err := broker.poll(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	sub, err := broker.Subscribe(context.Background(), Filter{}, 0)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	// Event 1 commits after event 2; reading event 2 first would skip it.
+	xid := svc.begin(model.EventCreated, "c1")
+	svc.add(model.EventCreated, "c2")
+	if err := broker.poll(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	svc.commit(xid)
+	if err := broker.poll(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+
+	if id := nextID(t, sub); id != 1 {
+		t.Fatalf("expected event 1 once its transaction finished, got %d", id)
+	}
+	if id := nextID(t, sub); id != 2 {
+		t.Fatalf("expected event 2, got %d", id)
+	}
+}
+
+func TestSubscription_RejectsUnknownLastEventID(t *testing.T) {
+	broker := NewBroker(&fakeService{}, time.Hour)
+	if err := broker.poll(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if _, err := broker.Subscribe(context.Background(), Filter{}, 7); !errors.Is(err, service.ErrEventNotFound) {
+		t.Fatalf("expected ErrEventNotFound, got %v", err)
+	}
+}
+
+func TestSubscription_DropsSlowConsumer(t *testing.T) {
+	svc := &fakeService{}
+	broker := NewBroker(svc, time.Hour)
+	if err := broker.poll(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	sub, err := broker.Subscribe(context.Background(), Filter{Types: []model.OrderEventType{model.EventCreated}}, 0)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	for i := 0; i <= bufferSize; i++ {
+		svc.add(model.EventCreated, "c1")
+	}
+	if err := broker.poll(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+
+	for i := 0; ; i++ {
+		if _, err := sub.Next(context.Background()); err != nil {
+			if !errors.Is(err, ErrSlowConsumer) {
+				t.Fatalf("expected ErrSlowConsumer, got %v", err)
+			}
+			break
+		}
+		if i > bufferSize {
+			t.Fatal("expected the subscriber to be dropped")
+		}
+	}
+}
+
+func TestBroker_CloseEndsSubscriptions(t *testing.T) {
+	broker := NewBroker(&fakeService{}, time.Hour)
+	if err := broker.poll(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	sub, err := broker.Subscribe(context.Background(), Filter{}, 0)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	broker.Close()
+	if _, err := sub.Next(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+	if _, err := broker.Subscribe(context.Background(), Filter{}, 0); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed for a new subscription, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Violations flattens a validation failure into per-field violations. Struct
+// tag failures are reported with the tag as the rule, business rule failures
+// as they are. It returns nil for any other error.
+func Violations(err error) []Violation {
+	var violationsErr *ViolationsError
+	if errors.As(err, &violationsErr) {
+		return violationsErr.Violations
+	}
+
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		return nil
+	}
+	violations := make([]Violation, len(fieldErrors))
+	for i, fe := range fieldErrors {
+		violations[i] = Violation{
+			Rule:    fe.Tag(),
+			Field:   fieldPath(fe),
+			Message: tagMessage(fe),
+		}
+	}
+	return violations
+}
+
+// IsValidationError reports whether err is a struct tag or business rule
+// failure.
+func IsValidationError(err error) bool {
+	return Violations(err) != nil
+}
+
+// fieldPath drops the root struct name from the namespace, which is built from
+// JSON names: Order.items[0].price becomes items[0].price.
+func fieldPath(fe validator.FieldError) string {
+	namespace := fe.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+func tagMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "http_url":
+		return "must be an absolute http or https URL"
+	case "alphanumunicode":
+		return "must contain only letters and digits"
+	case "uppercase":
+		return "must be uppercase"
+	case "oneof":
+		return "must be one of: " + fe.Param()
+	case "len":
+		return lengthMessage(fe, "exactly")
+	case "min":
+		return lengthMessage(fe, "at least")
+	case "max":
+		return lengthMessage(fe, "at most")
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte":
+		return "must be greater than or equal to " + fe.Param()
+	case "lt":
+		return "must be less than " + fe.Param()
+	case "lte":
+		return "must be less than or equal to " + fe.Param()
+	default:
+		return fmt.Sprintf("failed the %q check", fe.Tag())
+	}
+}
+
+// lengthMessage phrases len, min and max, which bound the length of strings
+// and slices but the value of numbers.
+func lengthMessage(fe validator.FieldError, bound string) string {
+	switch fe.Kind().String() {
+	case "string":
+		return fmt.Sprintf("must be %s %s characters long", bound, fe.Param())
+	case "slice", "array", "map":
+		return fmt.Sprintf("must contain %s %s elements", bound, fe.Param())
+	default:
+		return fmt.Sprintf("must be %s %s", bound, fe.Param())
+	}
+}
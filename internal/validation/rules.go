@@ -0,0 +1,137 @@
+package validation
+
+import (
+	"fmt"
+	"math"
+	"myapp/internal/model"
+	"strings"
+	"time"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+)
+
+const (
+	RuleItemTotalPrice  = "item_total_price"
+	RuleItemTrackNumber = "item_track_number"
+	RuleGoodsTotal      = "goods_total"
+	RulePaymentAmount   = "payment_amount"
+	RuleCurrency        = "currency_code"
+	RuleLocale          = "locale_code"
+	RulePaymentDT       = "payment_dt"
+)
+
+// earliestPaymentDT and paymentDTClockSkew bound a plausible payment time.
+var earliestPaymentDT = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const paymentDTClockSkew = 24 * time.Hour
+
+func DefaultRules() []Rule {
+	return []Rule{
+		NewRule(RuleItemTotalPrice, checkItemTotalPrice),
+		NewRule(RuleItemTrackNumber, checkItemTrackNumber),
+		NewRule(RuleGoodsTotal, checkGoodsTotal),
+		NewRule(RulePaymentAmount, checkPaymentAmount),
+		NewRule(RuleCurrency, checkCurrency),
+		NewRule(RuleLocale, checkLocale),
+		NewRule(RulePaymentDT, checkPaymentDT),
+	}
+}
+
+// checkItemTotalPrice allows the discounted price to be rounded either way.
+func checkItemTotalPrice(order *model.Order) []Violation {
+	var violations []Violation
+	for i, item := range order.Items {
+		expected := float64(item.Price) * float64(100-item.Sale) / 100
+		if math.Abs(float64(item.TotalPrice)-expected) >= 1 {
+			violations = append(violations, Violation{
+				Rule:    RuleItemTotalPrice,
+				Field:   fmt.Sprintf("items[%d].total_price", i),
+				Message: fmt.Sprintf("total price %d does not match price %d with %d%% sale", item.TotalPrice, item.Price, item.Sale),
+			})
+		}
+	}
+	return violations
+}
+
+func checkItemTrackNumber(order *model.Order) []Violation {
+	var violations []Violation
+	for i, item := range order.Items {
+		if item.TrackNumber != order.TrackNumber {
+			violations = append(violations, Violation{
+				Rule:    RuleItemTrackNumber,
+				Field:   fmt.Sprintf("items[%d].track_number", i),
+				Message: fmt.Sprintf("track number %q does not match order track number %q", item.TrackNumber, order.TrackNumber),
+			})
+		}
+	}
+	return violations
+}
+
+func checkGoodsTotal(order *model.Order) []Violation {
+	total := 0
+	for _, item := range order.Items {
+		total += item.TotalPrice
+	}
+	if order.Payment.GoodsTotal != total {
+		return []Violation{{
+			Rule:    RuleGoodsTotal,
+			Field:   "payment.goods_total",
+			Message: fmt.Sprintf("goods total %d does not match the item total %d", order.Payment.GoodsTotal, total),
+		}}
+	}
+	return nil
+}
+
+func checkPaymentAmount(order *model.Order) []Violation {
+	p := order.Payment
+	if expected := p.GoodsTotal + p.DeliveryCost + p.CustomFee; p.Amount != expected {
+		return []Violation{{
+			Rule:    RulePaymentAmount,
+			Field:   "payment.amount",
+			Message: fmt.Sprintf("amount %d does not equal goods total + delivery cost + custom fee (%d)", p.Amount, expected),
+		}}
+	}
+	return nil
+}
+
+func checkCurrency(order *model.Order) []Violation {
+	if _, err := currency.ParseISO(order.Payment.Currency); err != nil {
+		return []Violation{{
+			Rule:    RuleCurrency,
+			Field:   "payment.currency",
+			Message: fmt.Sprintf("%q is not an ISO 4217 currency code", order.Payment.Currency),
+		}}
+	}
+	return nil
+}
+
+// checkLocale accepts an ISO 639 language, optionally followed by an ISO 3166
+// region: en, en-US or en_US.
+func checkLocale(order *model.Order) []Violation {
+	base, region, hasRegion := strings.Cut(strings.Replace(order.Locale, "_", "-", 1), "-")
+	_, err := language.ParseBase(base)
+	if err == nil && hasRegion {
+		_, err = language.ParseRegion(region)
+	}
+	if err != nil {
+		return []Violation{{
+			Rule:    RuleLocale,
+			Field:   "locale",
+			Message: fmt.Sprintf("%q is not a known locale code", order.Locale),
+		}}
+	}
+	return nil
+}
+
+func checkPaymentDT(order *model.Order) []Violation {
+	paidAt := time.Unix(order.Payment.PaymentDT, 0)
+	if paidAt.Before(earliestPaymentDT) || paidAt.After(time.Now().Add(paymentDTClockSkew)) {
+		return []Violation{{
+			Rule:    RulePaymentDT,
+			Field:   "payment.payment_dt",
+			Message: fmt.Sprintf("payment time %s is not plausible", paidAt.UTC().Format(time.RFC3339)),
+		}}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package validation
+
+import (
+	"fmt"
+	"myapp/internal/model"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Violation is a broken business rule, in a form clients can act on. Field is
+// the JSON path of the offending value, such as items[0].total_price.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ViolationsError is returned by Validate for an order that is well-formed
+// but breaks business rules.
+type ViolationsError struct {
+	Violations []Violation
+}
+
+func (e *ViolationsError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = fmt.Sprintf("%s: %s", v.Field, v.Message)
+	}
+	return "business rule violations: " + strings.Join(messages, "; ")
+}
+
+// Rule checks one cross-field invariant of an order.
+type Rule interface {
+	Name() string
+	Check(order *model.Order) []Violation
+}
+
+type ruleFunc struct {
+	name  string
+	check func(order *model.Order) []Violation
+}
+
+// NewRule builds a Rule from a function.
+func NewRule(name string, check func(order *model.Order) []Violation) Rule {
+	return ruleFunc{name: name, check: check}
+}
+
+func (r ruleFunc) Name() string                         { return r.name }
+func (r ruleFunc) Check(order *model.Order) []Violation { return r.check(order) }
+
+// Validator checks struct tags with a single shared go-playground validator,
+// then runs the enabled business rules.
+type Validator struct {
+	structs  *validator.Validate
+	rules    []Rule
+	disabled map[string]bool
+}
+
+type Option func(*Validator)
+
+// WithRules adds rules after the default ones.
+func WithRules(rules ...Rule) Option {
+	return func(v *Validator) {
+		v.rules = append(v.rules, rules...)
+	}
+}
+
+// WithDisabledRules turns off rules by name. Names that match no rule are
+// reported by CheckDisabledRules.
+func WithDisabledRules(names ...string) Option {
+	return func(v *Validator) {
+		for _, name := range names {
+			v.disabled[name] = true
+		}
+	}
+}
+
+func New(opts ...Option) *Validator {
+	structs := validator.New(validator.WithRequiredStructEnabled())
+	structs.RegisterTagNameFunc(jsonFieldName)
+
+	v := &Validator{
+		structs:  structs,
+		rules:    DefaultRules(),
+		disabled: make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// Validate returns validator.ValidationErrors if the order breaks its struct
+// tags, or *ViolationsError if it breaks business rules.
+func (v *Validator) Validate(order *model.Order) error {
+	if err := v.structs.Struct(order); err != nil {
+		return err
+	}
+
+	var violations []Violation
+	for _, rule := range v.rules {
+		if v.disabled[rule.Name()] {
+			continue
+		}
+		violations = append(violations, rule.Check(order)...)
+	}
+	if len(violations) > 0 {
+		return &ViolationsError{Violations: violations}
+	}
+	return nil
+}
+
+// ValidateStruct checks only the struct tags of s, such as a single item.
+func (v *Validator) ValidateStruct(s interface{}) error {
+	return v.structs.Struct(s)
+}
+
+// CheckDisabledRules returns an error naming every disabled rule that does not
+// exist, so a typo in configuration is caught at startup instead of leaving
+// the rule silently enabled.
+func (v *Validator) CheckDisabledRules() error {
+	known := v.Rules()
+	var unknown []string
+	for name := range v.disabled {
+		if _, ok := known[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("unknown validation rules: %s", strings.Join(unknown, ", "))
+}
+
+// Rules lists the names of all rules and whether each is enabled.
+func (v *Validator) Rules() map[string]bool {
+	rules := make(map[string]bool, len(v.rules))
+	for _, rule := range v.rules {
+		rules[rule.Name()] = !v.disabled[rule.Name()]
+	}
+	return rules
+}
+
+// jsonFieldName makes field errors carry the names clients send.
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
@@ -0,0 +1,113 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"myapp/internal/model/modeltest"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func TestValidate_SampleOrderPasses(t *testing.T) {
+	if err := New().Validate(modeltest.Order()); err != nil {
+		t.Fatalf("expected sample order to be valid, got %v", err)
+	}
+}
+
+func TestValidate_ReportsViolations(t *testing.T) {
+	order := modeltest.Order()
+	order.Items[0].TotalPrice = 400
+	order.Items[0].TrackNumber = "OTHER"
+	order.Payment.Currency = "XYZ"
+	order.Locale = "zz"
+
+	err := New().Validate(order)
+	var violations *ViolationsError
+	if !errors.As(err, &violations) {
+		t.Fatalf("expected ViolationsError, got %v", err)
+	}
+
+	got := map[string]string{}
+	for _, v := range violations.Violations {
+		got[v.Rule] = v.Field
+	}
+	want := map[string]string{
+		RuleItemTotalPrice:  "items[0].total_price",
+		RuleItemTrackNumber: "items[0].track_number",
+		RuleGoodsTotal:      "payment.goods_total",
+		RuleCurrency:        "payment.currency",
+		RuleLocale:          "locale",
+	}
+	for rule, field := range want {
+		if got[rule] != field {
+			t.Fatalf("expected %s violation on %s, got %+v", rule, field, violations.Violations)
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected violations: %+v", violations.Violations)
+	}
+}
+
+func TestValidate_DisabledRulesAreSkipped(t *testing.T) {
+	order := modeltest.Order()
+	order.Payment.PaymentDT = time.Now().Add(48 * time.Hour).Unix()
+
+	if err := New().Validate(order); err == nil {
+		t.Fatal("expected payment_dt violation")
+	}
+	v := New(WithDisabledRules(RulePaymentDT))
+	if err := v.Validate(order); err != nil {
+		t.Fatalf("expected disabled rule to be skipped, got %v", err)
+	}
+	if v.Rules()[RulePaymentDT] {
+		t.Fatal("expected payment_dt to be reported as disabled")
+	}
+}
+
+func TestCheckDisabledRules_RejectsUnknownNames(t *testing.T) {
+	if err := New(WithDisabledRules(RulePaymentDT)).CheckDisabledRules(); err != nil {
+		t.Fatalf("expected known rule to pass, got %v", err)
+	}
+	err := New(WithDisabledRules(RulePaymentDT, "paymnet_dt")).CheckDisabledRules()
+	if err == nil || !strings.Contains(err.Error(), "paymnet_dt") {
+		t.Fatalf("expected unknown rule to be reported, got %v", err)
+	}
+}
+
+func TestValidate_StructTagsBeforeRules(t *testing.T) {
+	order := modeltest.Order()
+	order.Delivery.Phone = ""
+
+	var validationErrors validator.ValidationErrors
+	if err := New().Validate(order); !errors.As(err, &validationErrors) {
+		t.Fatalf("expected validator.ValidationErrors, got %v", err)
+	}
+}
+
+func TestViolations_TranslatesFieldErrors(t *testing.T) {
+	order := modeltest.Order()
+	order.Items[0].Price = -5
+	order.Delivery.Email = "not-an-email"
+
+	violations := Violations(New().Validate(order))
+
+	got := map[string]string{}
+	for _, v := range violations {
+		got[v.Field] = v.Rule
+	}
+	want := map[string]string{
+		"items[0].price": "gt",
+		"delivery.email": "email",
+	}
+	for field, rule := range want {
+		if got[field] != rule {
+			t.Fatalf("expected %s violation on %s, got %+v", rule, field, violations)
+		}
+	}
+	if Violations(errors.New("boom")) != nil {
+		t.Fatal("expected no violations for an unrelated error")
+	}
+}
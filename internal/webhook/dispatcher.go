@@ -0,0 +1,281 @@
+// Package webhook sends queued order events to webhook subscribers.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"myapp/internal/model"
+	"myapp/internal/service"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultMaxAttempts  = 8
+	DefaultDisableAfter = 20
+	DefaultTimeout      = 10 * time.Second
+
+	// batchSize is how many deliveries are claimed and sent concurrently.
+	batchSize = 20
+	// Retries back off exponentially from baseBackoff up to maxBackoff.
+	baseBackoff = 10 * time.Second
+	maxBackoff  = time.Hour
+	// maxErrorLength bounds the response excerpt kept in the delivery log.
+	maxErrorLength = 512
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Sign returns the signature header value for body sent at timestamp: the
+// hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook secret.
+// Receivers recompute it and should reject stale timestamps.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ErrForbiddenTarget is returned for a delivery whose URL resolves to an
+// address the service must not reach on a subscriber's behalf.
+var ErrForbiddenTarget = errors.New("webhook target is a loopback, private or link-local address")
+
+// Dispatcher polls the delivery queue and POSTs each delivery to its
+// webhook. Any number of instances may run one; claims do not overlap.
+type Dispatcher struct {
+	service      service.WebhookService
+	client       *http.Client
+	interval     time.Duration
+	maxAttempts  int
+	disableAfter int
+	allowPrivate bool
+}
+
+type Option func(*Dispatcher)
+
+// WithTimeout bounds a single delivery request.
+func WithTimeout(timeout time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.client.Timeout = timeout
+	}
+}
+
+// WithMaxAttempts sets how many times a delivery is tried before it is
+// marked failed.
+func WithMaxAttempts(n int) Option {
+	return func(d *Dispatcher) {
+		d.maxAttempts = n
+	}
+}
+
+// WithDisableAfter sets how many consecutive dispatch rounds in which every
+// attempt failed disable a webhook.
+func WithDisableAfter(n int) Option {
+	return func(d *Dispatcher) {
+		d.disableAfter = n
+	}
+}
+
+// WithPrivateNetworks allows deliveries to loopback, private and link-local
+// addresses, for receivers running next to the service in development.
+func WithPrivateNetworks(allow bool) Option {
+	return func(d *Dispatcher) {
+		d.allowPrivate = allow
+	}
+}
+
+func NewDispatcher(service service.WebhookService, interval time.Duration, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		service:      service,
+		interval:     interval,
+		maxAttempts:  DefaultMaxAttempts,
+		disableAfter: DefaultDisableAfter,
+	}
+	// Webhook URLs come from API clients, so the target is checked after
+	// DNS resolution, on every connection. Redirects are not followed and
+	// no proxy is used, as either would take the request past that check.
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: d.checkTarget}
+	d.client = &http.Client{
+		Timeout: DefaultTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// checkTarget is the dialer's Control hook: it sees the resolved address
+// that is about to be connected to.
+func (d *Dispatcher) checkTarget(network, address string, _ syscall.RawConn) error {
+	if d.allowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return fmt.Errorf("%w: %s", ErrForbiddenTarget, addr)
+	}
+	return nil
+}
+
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for ctx.Err() == nil {
+				sent, err := d.dispatch(ctx)
+				if err != nil {
+					log.Printf("Failed to dispatch webhooks: %v", err)
+				}
+				if sent < batchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// dispatch sends one batch of due deliveries and returns its size.
+func (d *Dispatcher) dispatch(ctx context.Context) (int, error) {
+	// The lease outlasts the request, so a delivery is only claimed again
+	// if this instance died while sending it.
+	jobs, err := d.service.ClaimWebhookJobs(ctx, batchSize, 2*d.client.Timeout)
+	if err != nil {
+		return 0, err
+	}
+
+	results := make([]model.WebhookResult, len(jobs))
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Add(1)
+		go func(i int, job model.WebhookJob) {
+			defer wg.Done()
+			results[i] = d.send(ctx, job)
+		}(i, job)
+	}
+	wg.Wait()
+
+	// Results are recorded together so that the concurrent deliveries of
+	// one webhook count as a single failure towards disabling it.
+	if len(results) > 0 {
+		if err := d.service.RecordWebhookResults(ctx, results, d.disableAfter); err != nil {
+			return len(jobs), fmt.Errorf("failed to record webhook deliveries: %w", err)
+		}
+	}
+	return len(jobs), nil
+}
+
+func (d *Dispatcher) send(ctx context.Context, job model.WebhookJob) model.WebhookResult {
+	result := model.WebhookResult{DeliveryID: job.DeliveryID, WebhookID: job.Webhook.ID}
+
+	status, err := d.post(ctx, job)
+	result.ResponseStatus = status
+	if err == nil {
+		result.Succeeded = true
+		webhookDeliveriesTotal.WithLabelValues("succeeded").Inc()
+		return result
+	}
+
+	result.Error = err.Error()
+	if len(result.Error) > maxErrorLength {
+		result.Error = result.Error[:maxErrorLength]
+	}
+	if job.Attempt < d.maxAttempts {
+		retryAt := time.Now().Add(backoff(job.Attempt))
+		result.RetryAt = &retryAt
+		webhookDeliveriesTotal.WithLabelValues("retried").Inc()
+	} else {
+		webhookDeliveriesTotal.WithLabelValues("failed").Inc()
+	}
+	log.Printf("Webhook delivery %d to %s failed (attempt %d): %v", job.DeliveryID, job.Webhook.URL, job.Attempt, err)
+	return result
+}
+
+// post sends the signed payload and treats any 2xx response as delivered.
+func (d *Dispatcher) post(ctx context.Context, job model.WebhookJob) (int, error) {
+	body, err := json.Marshal(job.Payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "order-service-webhooks/1.0")
+	req.Header.Set(HeaderEvent, string(job.Payload.Type))
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(job.DeliveryID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(job.Webhook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorLength))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, excerpt)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay before the attempt after the given one, with up
+// to 10% jitter so failed deliveries do not retry in lockstep.
+func backoff(attempt int) time.Duration {
+	delay := maxBackoff
+	if attempt < 20 {
+		if d := baseBackoff << (attempt - 1); d < maxBackoff {
+			delay = d
+		}
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/10+1))
+}
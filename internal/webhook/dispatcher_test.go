@@ -0,0 +1,175 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"myapp/internal/model"
+	"myapp/internal/service"
+)
+
+// fakeService hands out queued jobs once and records results; the embedded
+// interface panics on anything else.
+type fakeService struct {
+	service.WebhookService
+	jobs []model.WebhookJob
+
+	mu      sync.Mutex
+	results []model.WebhookResult
+	rounds  int
+}
+
+func (f *fakeService) ClaimWebhookJobs(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookJob, error) {
+	jobs := f.jobs
+	f.jobs = nil
+	return jobs, nil
+}
+
+func (f *fakeService) RecordWebhookResults(ctx context.Context, results []model.WebhookResult, disableAfter int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results = append(f.results, results...)
+	f.rounds++
+	return nil
+}
+
+func testJob(url string, attempt int) model.WebhookJob {
+	return model.WebhookJob{
+		DeliveryID: 42,
+		Attempt:    attempt,
+		Webhook:    model.Webhook{ID: 1, URL: url, Secret: "0123456789abcdef"},
+		Payload:    model.WebhookPayload{ID: 7, Type: model.EventCreated, OrderUID: "uid1", Order: []byte(`{"order_uid":"uid1"}`)},
+	}
+}
+
+func TestDispatch_SignsPayload(t *testing.T) {
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	svc := &fakeService{jobs: []model.WebhookJob{testJob(server.URL, 1)}}
+	if _, err := NewDispatcher(svc, time.Second, WithPrivateNetworks(true)).dispatch(context.Background()); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid timestamp header %q", header.Get(HeaderTimestamp))
+	}
+	if got, want := header.Get(HeaderSignature), Sign("0123456789abcdef", timestamp, body); got != want {
+		t.Fatalf("signature %q does not match %q", got, want)
+	}
+	if header.Get(HeaderEvent) != "created" || header.Get(HeaderDelivery) != "42" {
+		t.Fatalf("unexpected headers: %v", header)
+	}
+	if len(svc.results) != 1 || !svc.results[0].Succeeded || svc.results[0].ResponseStatus != http.StatusNoContent {
+		t.Fatalf("unexpected results: %+v", svc.results)
+	}
+}
+
+func TestDispatch_RetriesUntilMaxAttempts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(nil, time.Second, WithMaxAttempts(3), WithPrivateNetworks(true))
+	for attempt, wantRetry := range map[int]bool{1: true, 2: true, 3: false} {
+		svc := &fakeService{jobs: []model.WebhookJob{testJob(server.URL, attempt)}}
+		d.service = svc
+		if _, err := d.dispatch(context.Background()); err != nil {
+			t.Fatalf("dispatch: %v", err)
+		}
+
+		result := svc.results[0]
+		if result.Succeeded || result.ResponseStatus != http.StatusServiceUnavailable || result.Error == "" {
+			t.Fatalf("attempt %d: unexpected result %+v", attempt, result)
+		}
+		if (result.RetryAt != nil) != wantRetry {
+			t.Fatalf("attempt %d: expected retry %v, got %v", attempt, wantRetry, result.RetryAt)
+		}
+	}
+}
+
+func TestDispatch_RecordsResultsOncePerRound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	first, second := testJob(server.URL, 1), testJob(server.URL, 1)
+	second.DeliveryID = 43
+	svc := &fakeService{jobs: []model.WebhookJob{first, second}}
+	if _, err := NewDispatcher(svc, time.Second, WithPrivateNetworks(true)).dispatch(context.Background()); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if svc.rounds != 1 || len(svc.results) != 2 {
+		t.Fatalf("expected both results in one round, got %d results in %d rounds", len(svc.results), svc.rounds)
+	}
+}
+
+func TestDispatch_RefusesPrivateTargets(t *testing.T) {
+	var hits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer server.Close()
+
+	svc := &fakeService{jobs: []model.WebhookJob{testJob(server.URL, 1)}}
+	if _, err := NewDispatcher(svc, time.Second).dispatch(context.Background()); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if hits != 0 {
+		t.Fatal("expected the loopback receiver not to be reached")
+	}
+	if result := svc.results[0]; result.Succeeded || !strings.Contains(result.Error, ErrForbiddenTarget.Error()) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestDispatch_DoesNotFollowRedirects(t *testing.T) {
+	var redirected bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			redirected = true
+			return
+		}
+		http.Redirect(w, r, "/moved", http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	svc := &fakeService{jobs: []model.WebhookJob{testJob(server.URL, 1)}}
+	if _, err := NewDispatcher(svc, time.Second, WithPrivateNetworks(true)).dispatch(context.Background()); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if redirected {
+		t.Fatal("expected the redirect not to be followed")
+	}
+	if result := svc.results[0]; result.Succeeded || result.ResponseStatus != http.StatusTemporaryRedirect {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestBackoff_GrowsAndCaps(t *testing.T) {
+	if d := backoff(1); d < baseBackoff || d > baseBackoff+baseBackoff/10 {
+		t.Fatalf("first backoff out of range: %v", d)
+	}
+	if d := backoff(3); d < 4*baseBackoff {
+		t.Fatalf("expected exponential growth, got %v", d)
+	}
+	if d := backoff(50); d < maxBackoff || d > maxBackoff+maxBackoff/10 {
+		t.Fatalf("expected capped backoff, got %v", d)
+	}
+}
@@ -0,0 +1,11 @@
+package webhook
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var webhookDeliveriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "webhook_deliveries_total",
+	Help: "Total number of webhook delivery attempts by outcome",
+}, []string{"outcome"})
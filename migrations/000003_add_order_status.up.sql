@@ -0,0 +1,4 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'created'
+    CHECK (status IN ('created', 'paid', 'assembling', 'shipped', 'delivered', 'cancelled', 'returned'));
+
+CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS order_events (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid VARCHAR(255) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    actor JSONB NOT NULL DEFAULT '{}',
+    before JSONB,
+    after JSONB,
+    diff JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_events_order_uid ON order_events(order_uid, id);
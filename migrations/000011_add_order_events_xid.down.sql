@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_order_events_xid;
+
+ALTER TABLE order_events DROP COLUMN IF EXISTS xid;
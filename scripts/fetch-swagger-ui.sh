@@ -0,0 +1,30 @@
+#!/bin/sh
+# Vendors the Swagger UI stylesheet and script served under /api/v1/docs into
+# the given directory. The version is pinned in <dir>/VERSION, and the npm
+# tarball is checked against the sha512 integrity the registry publishes for
+# it before anything is extracted.
+set -eu
+
+dir=${1:?usage: fetch-swagger-ui.sh <dir>}
+version=$(cat "$dir/VERSION")
+registry=https://registry.npmjs.org/swagger-ui-dist
+
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+integrity=$(curl -fsSL "$registry/$version" | sed -n 's/.*"integrity":"sha512-\([^"]*\)".*/\1/p')
+if [ -z "$integrity" ]; then
+	echo "no integrity published for swagger-ui-dist $version" >&2
+	exit 1
+fi
+
+curl -fsSL "$registry/-/swagger-ui-dist-$version.tgz" -o "$tmp/dist.tgz"
+actual=$(openssl dgst -sha512 -binary "$tmp/dist.tgz" | base64 | tr -d '\n')
+if [ "$actual" != "$integrity" ]; then
+	echo "swagger-ui-dist $version does not match its published integrity" >&2
+	exit 1
+fi
+
+tar -xzf "$tmp/dist.tgz" -C "$tmp" package/swagger-ui.css package/swagger-ui-bundle.js package/LICENSE
+cp "$tmp/package/swagger-ui.css" "$tmp/package/swagger-ui-bundle.js" "$tmp/package/LICENSE" "$dir/"
+echo "Vendored swagger-ui-dist $version into $dir"